@@ -0,0 +1,16 @@
+#!/bin/bash
+
+# 基准测试脚本 - 对比各种字符串拼接实现的耗时和内存分配
+# 输出为 benchstat 可以直接读取的格式，例如：
+#   ./bench.sh > new.txt
+#   benchstat -col /strategy new.txt
+#   benchstat old.txt new.txt
+
+set -e
+
+SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
+cd "$SCRIPT_DIR"
+
+COUNT=${COUNT:-10}
+
+go test -run '^$' -bench 'BenchmarkConcat' -benchmem -count "$COUNT" ./concat "$@"
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/capture"
+)
+
+var (
+	targets      = flag.String("targets", "bad=./bad_server,good=./good_server", "comma separated name=path list; path is a binary or a Go package directory")
+	profiles     = flag.String("profiles", "cpu=30s,heap,allocs,goroutine,mutex=10s,block=10s", "comma separated profiles to capture, name[=duration]")
+	outDir       = flag.String("out", "profiles", "output directory for profiles, logs and manifest.json")
+	warmup       = flag.Duration("warmup", 3*time.Second, "wait after the server is ready before capturing")
+	readyTimeout = flag.Duration("ready-timeout", 30*time.Second, "max time to wait for the pprof endpoint to become ready")
+	stopTimeout  = flag.Duration("stop-timeout", 5*time.Second, "max time to wait for a server to exit before escalating")
+	fetchSlack   = flag.Duration("fetch-slack", 15*time.Second, "extra timeout for each profile request beyond its duration")
+)
+
+func main() {
+	flag.Parse()
+
+	targetList, err := capture.ParseTargets(*targets)
+	if err != nil {
+		log.Fatalf("invalid -targets: %v", err)
+	}
+	profileList, err := capture.ParseProfiles(*profiles)
+	if err != nil {
+		log.Fatalf("invalid -profiles: %v", err)
+	}
+
+	// SIGINT/SIGTERM 时取消采集，Run 会负责停止子进程
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Println("========================================================================")
+	log.Println("CPU Profile Capture for Bad Server and Good Server")
+	log.Println("========================================================================")
+
+	m, err := capture.Run(ctx, capture.Config{
+		Targets:      targetList,
+		Profiles:     profileList,
+		OutDir:       *outDir,
+		Warmup:       *warmup,
+		ReadyTimeout: *readyTimeout,
+		StopTimeout:  *stopTimeout,
+		FetchSlack:   *fetchSlack,
+		// mutex/block profile 默认关闭，这里打开采样
+		ExtraArgs: []string{"-mutex-profile-fraction", "5", "-block-profile-rate", "10000"},
+	})
+	if m != nil {
+		fmt.Println()
+		fmt.Println("Generated files:")
+		for _, t := range m.Targets {
+			for _, r := range t.Profiles {
+				if r.File != "" {
+					fmt.Printf("  - %s\n", filepath.Join(*outDir, r.File))
+				}
+			}
+		}
+		fmt.Printf("  - %s\n", filepath.Join(*outDir, "manifest.json"))
+		printAnalyzeHints(targetList, profileList)
+	}
+	if err != nil {
+		log.Fatalf("capture failed: %v", err)
+	}
+	log.Println("✅ All profiles captured successfully!")
+}
+
+// printAnalyzeHints 按实际采集的 target 输出分析命令，优先使用 CPU profile
+func printAnalyzeHints(targetList []capture.Target, profileList []capture.Profile) {
+	if len(targetList) == 0 || len(profileList) == 0 {
+		return
+	}
+	p := profileList[0]
+	for _, candidate := range profileList {
+		if candidate.Name == "cpu" {
+			p = candidate
+			break
+		}
+	}
+	var files []string
+	for _, t := range targetList {
+		files = append(files, filepath.Join(*outDir, p.FileName(t.Name)))
+	}
+
+	fmt.Println()
+	fmt.Println("Analyze the profiles with:")
+	for _, f := range files {
+		fmt.Printf("  go tool pprof -top %s\n", f)
+	}
+	if len(files) >= 2 {
+		fmt.Printf("  go tool pprof -base %s %s  # Compare\n", files[0], files[1])
+	}
+}
@@ -0,0 +1,91 @@
+// Package concat 收集 cpu_analyze 中用到的各种字符串拼接实现，
+// 供 bad_server、good_server、server 共用，并可以被基准测试覆盖。
+package concat
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ItemSizeEstimate 每项 "item_%d," 的估算字节数，GoodStringBuilder 用它预分配容量
+const ItemSizeEstimate = 12
+
+// Strategies 所有可选的拼接实现，key 为 server 的 -strategy 参数值
+var Strategies = map[string]func(n int) string{
+	"plus":         BadStringConcat,
+	"builder":      BuilderConcat,
+	"builder-grow": GoodStringBuilder,
+	"buffer":       BufferConcat,
+	"join":         JoinConcat,
+	"appendint":    AppendIntConcat,
+}
+
+// Names 返回排序后的实现名称
+func Names() []string {
+	names := make([]string, 0, len(Strategies))
+	for name := range Strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BadStringConcat BadExample: 使用+操作符拼接字符串，每次都分配新字符串并拷贝
+func BadStringConcat(n int) string {
+	result := ""
+	for i := 0; i < n; i++ {
+		result += fmt.Sprintf("item_%d,", i)
+	}
+	return result
+}
+
+// GoodStringBuilder GoodExample1: 使用strings.Builder，并预分配容量
+func GoodStringBuilder(n int) string {
+	var builder strings.Builder
+	builder.Grow(n * ItemSizeEstimate) // 预分配容量（估算每项约12字节）
+	for i := 0; i < n; i++ {
+		builder.WriteString(fmt.Sprintf("item_%d,", i))
+	}
+	return builder.String()
+}
+
+// BuilderConcat strings.Builder，不预分配容量
+func BuilderConcat(n int) string {
+	var builder strings.Builder
+	for i := 0; i < n; i++ {
+		builder.WriteString(fmt.Sprintf("item_%d,", i))
+	}
+	return builder.String()
+}
+
+// BufferConcat bytes.Buffer
+func BufferConcat(n int) string {
+	var buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		buf.WriteString(fmt.Sprintf("item_%d,", i))
+	}
+	return buf.String()
+}
+
+// JoinConcat 先收集到切片，再用 strings.Join 一次拼接
+func JoinConcat(n int) string {
+	parts := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		parts = append(parts, fmt.Sprintf("item_%d,", i))
+	}
+	return strings.Join(parts, "")
+}
+
+// AppendIntConcat 直接用 strconv.AppendInt 写入字节切片，完全避免 fmt.Sprintf 的中间字符串
+func AppendIntConcat(n int) string {
+	buf := make([]byte, 0, n*ItemSizeEstimate)
+	for i := 0; i < n; i++ {
+		buf = append(buf, "item_"...)
+		buf = strconv.AppendInt(buf, int64(i), 10)
+		buf = append(buf, ',')
+	}
+	return string(buf)
+}
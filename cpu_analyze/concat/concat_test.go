@@ -0,0 +1,98 @@
+package concat
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+var sizes = []int{10, 100, 500, 1000, 5000}
+
+// sink 防止编译器把结果优化掉
+var sink string
+
+func TestStrategiesProduceSameOutput(t *testing.T) {
+	for _, n := range append([]int{0, 1}, sizes...) {
+		want := BadStringConcat(n)
+		for _, name := range Names() {
+			if got := Strategies[name](n); got != want {
+				t.Errorf("%s(%d): output differs from BadStringConcat (len %d vs %d)", name, n, len(got), len(want))
+			}
+		}
+	}
+}
+
+// Grow(n * ItemSizeEstimate) 必须能容纳全部输出，否则 strings.Builder 会再次扩容；
+// 同时也不应该比实际输出大太多
+func TestGrowEstimate(t *testing.T) {
+	for _, n := range append([]int{1}, sizes...) {
+		size := len(GoodStringBuilder(n))
+		estimate := n * ItemSizeEstimate
+		if size > estimate {
+			t.Errorf("n=%d: output is %d bytes, exceeds Grow estimate %d", n, size, estimate)
+		}
+		if size*2 < estimate {
+			t.Errorf("n=%d: output is %d bytes, Grow estimate %d wastes more than half", n, size, estimate)
+		}
+	}
+}
+
+// fmt.Sprintf 本身的分配次数，作为 Sprintf 系列实现的基线
+func sprintfAllocs(n int) float64 {
+	return testing.AllocsPerRun(20, func() {
+		for i := 0; i < n; i++ {
+			sink = fmt.Sprintf("item_%d,", i)
+		}
+	})
+}
+
+// 好的实现除了 fmt.Sprintf 之外，最多只能多出这么多次分配
+const (
+	goodStringBuilderExtraAllocs = 1 // Grow 一次，之后不再扩容
+	appendIntMaxAllocs           = 2 // make 切片 + string 转换
+)
+
+func TestGoodStringBuilderAllocs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping allocation test in short mode")
+	}
+	for _, n := range sizes {
+		base := sprintfAllocs(n)
+		got := testing.AllocsPerRun(20, func() { sink = GoodStringBuilder(n) })
+		if extra := got - base; extra > goodStringBuilderExtraAllocs {
+			t.Errorf("n=%d: GoodStringBuilder allocates %.0f times, %.0f more than fmt.Sprintf alone (limit %d)",
+				n, got, extra, goodStringBuilderExtraAllocs)
+		}
+	}
+}
+
+func TestAppendIntAllocs(t *testing.T) {
+	for _, n := range sizes {
+		got := testing.AllocsPerRun(20, func() { sink = AppendIntConcat(n) })
+		if got > appendIntMaxAllocs {
+			t.Errorf("n=%d: AppendIntConcat allocates %.0f times, limit %d", n, got, appendIntMaxAllocs)
+		}
+	}
+}
+
+// BenchmarkConcat 输出形如 BenchmarkConcat/strategy=plus/n=500 的名称，可以直接交给 benchstat：
+//
+//	go test -run '^$' -bench Concat -count 10 ./concat > new.txt
+//	benchstat -col /strategy new.txt
+func BenchmarkConcat(b *testing.B) {
+	for _, name := range Names() {
+		fn := Strategies[name]
+		for _, n := range sizes {
+			if name == "plus" && n > 1000 {
+				// + 拼接是 O(n^2)，太大的 n 只会拖慢整个基准测试
+				continue
+			}
+			b.Run("strategy="+name+"/n="+strconv.Itoa(n), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					sink = fn(n)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"regexp"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/profdiff"
+)
+
+var (
+	goodProfile = flag.String("good", "profiles/good_cpu.prof", "CPU profile of good_server (baseline)")
+	badProfile  = flag.String("bad", "profiles/bad_cpu.prof", "CPU profile of bad_server")
+	format      = flag.String("format", "text", "output format: text, json or markdown")
+	sampleType  = flag.String("sample-type", "cpu", "sample type to compare (cpu or samples)")
+	top         = flag.Int("top", 20, "max number of functions to show (0 for all)")
+	minDelta    = flag.Float64("min-delta", 0.5, "hide functions whose flat and cum share both changed less than this many percentage points")
+	focus       = flag.String("focus", "", "only count samples whose stack contains a function matching this regexp, e.g. StringConcat|StringBuilder")
+)
+
+func main() {
+	flag.Parse()
+
+	var focusRE *regexp.Regexp
+	if *focus != "" {
+		re, err := regexp.Compile(*focus)
+		if err != nil {
+			log.Fatalf("invalid -focus: %v", err)
+		}
+		focusRE = re
+	}
+
+	good, err := profdiff.LoadSummary(*goodProfile, *sampleType, focusRE)
+	if err != nil {
+		log.Fatalf("failed to load good profile: %v", err)
+	}
+	bad, err := profdiff.LoadSummary(*badProfile, *sampleType, focusRE)
+	if err != nil {
+		log.Fatalf("failed to load bad profile: %v", err)
+	}
+
+	// good 作为基线，正的变化表示 bad_server 中该函数占比更高
+	report := profdiff.Diff(good, bad, "good", "bad", profdiff.Options{
+		MinDelta: *minDelta / 100,
+		Top:      *top,
+	})
+	if err := report.Write(os.Stdout, *format); err != nil {
+		log.Fatalf("failed to write report: %v", err)
+	}
+}
@@ -1,3 +1,9 @@
 module github.com/gangcheng1030/ai_production_troubleshooting/cpu_analyze
 
 go 1.23.9
+
+require github.com/gangcheng1030/ai_production_troubleshooting/diagnostics v0.0.0
+
+require github.com/google/pprof v0.0.0-20241210010833-40e02aabc2ad // indirect
+
+replace github.com/gangcheng1030/ai_production_troubleshooting/diagnostics => ../diagnostics
@@ -1,49 +1,34 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"net/http"
-	_ "net/http/pprof"
-	"os"
+	"log"
 	"strings"
-	"time"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/cpu_analyze/concat"
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/admin"
 )
 
-// Case 3: 频繁的字符串拼接导致CPU和内存问题
+var adminOpts = admin.Flags(flag.CommandLine, admin.Options{Addr: "localhost:6060"})
 
-// GoodExample1: 使用strings.Builder
-func goodStringBuilder(n int) string {
-	var builder strings.Builder
-	builder.Grow(n * 12) // 预分配容量（估算每项约12字节）
-	for i := 0; i < n; i++ {
-		builder.WriteString(fmt.Sprintf("item_%d,", i))
-	}
-	return builder.String()
-}
+// Case 3: 频繁的字符串拼接导致CPU和内存问题
 
 func continuousGoodConcat(n int) {
 	for {
-		_ = goodStringBuilder(n)
+		_ = concat.GoodStringBuilder(n)
 	}
 }
 
 func main() {
-	// 启动pprof HTTP服务器
-	fmt.Println("Starting pprof server on http://localhost:6060")
-	fmt.Println("Access the following endpoints:")
-	fmt.Println("  - http://localhost:6060/debug/pprof/")
-	fmt.Println("  - http://localhost:6060/debug/pprof/profile?seconds=30")
-	fmt.Println("  - http://localhost:6060/debug/pprof/heap")
-	fmt.Println("")
+	flag.Parse()
 
-	go func() {
-		if err := http.ListenAndServe("localhost:6060", nil); err != nil {
-			fmt.Printf("pprof server error: %v\n", err)
-		}
-	}()
-
-	// 等待pprof服务器启动
-	time.Sleep(1 * time.Second)
+	// 启动管理端口（pprof、/exit、/healthz 等）
+	adm := admin.New(*adminOpts)
+	if err := adm.Start(); err != nil {
+		log.Fatalf("failed to start admin server: %v", err)
+	}
+	pprofAddr := adm.Addr().String()
 
 	fmt.Println("\n" + strings.Repeat("=", 70))
 	fmt.Println("Starting continuous workload for CPU profiling...")
@@ -58,7 +43,7 @@ func main() {
 
 	fmt.Println("\nTip: Use the following commands to capture and analyze CPU profile:")
 	fmt.Println("  1. Capture 30s CPU profile:")
-	fmt.Println("     curl http://localhost:6060/debug/pprof/profile?seconds=30 -o cpu.prof")
+	fmt.Printf("     curl http://%s/debug/pprof/profile?seconds=30 -o cpu.prof\n", pprofAddr)
 	fmt.Println("")
 	fmt.Println("  2. Analyze with pprof:")
 	fmt.Println("     go tool pprof cpu.prof")
@@ -66,12 +51,12 @@ func main() {
 	fmt.Println("  3. View in browser:")
 	fmt.Println("     go tool pprof -http=:8080 cpu.prof")
 	fmt.Println("")
+	fmt.Println("  4. Stop the server:")
+	fmt.Printf("     curl -X POST http://%s/exit\n", pprofAddr)
+	fmt.Println("")
 
-	http.ListenAndServe(":8080", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/exit" {
-			os.Exit(0)
-		}
-		// 其它请求返回404
-		http.NotFound(w, r)
-	}))
+	adm.SetReady(true)
+	if err := adm.Wait(); err != nil {
+		log.Printf("shutdown error: %v", err)
+	}
 }
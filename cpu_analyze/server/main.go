@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/cpu_analyze/concat"
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/admin"
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/metrics"
+)
+
+// Case 3: 频繁的字符串拼接导致CPU和内存问题
+// 与 bad_server/good_server 不同，这个 server 可以在运行时切换拼接方式、数据量和 worker 数量，
+// 从而在同一个进程、同一个 pprof 端点上对比所有实现。
+
+var (
+	strategy  = flag.String("strategy", "plus", "concatenation strategy: "+strings.Join(concat.Names(), ", "))
+	items     = flag.Int("n", 500, "number of items concatenated per iteration")
+	workers   = flag.Int("workers", 1, "number of worker goroutines running the workload")
+	adminOpts = admin.Flags(flag.CommandLine, admin.Options{Addr: "localhost:6060"})
+)
+
+// 管理端口 /metrics 中按拼接方式统计的迭代次数，切换配置后不清零，可以直接用 rate() 对比吞吐
+var iterationsTotal = metrics.Default.NewCounterVec("concat_iterations_total",
+	"Total number of concatenation iterations completed by strategy.", "strategy")
+
+// workloadConfig 当前负载的配置
+type workloadConfig struct {
+	Strategy string `json:"strategy"`
+	N        int    `json:"n"`
+	Workers  int    `json:"workers"`
+}
+
+// 上限：worker 只在两次拼接之间检查是否需要停止，n 过大时 plus 等 O(n²) 的实现单次就要很久，
+// 切换配置和退出都会被拖住；worker 过多只会让调度开销淹没拼接本身
+const (
+	maxItems   = 10000
+	maxWorkers = 256
+)
+
+func (c workloadConfig) validate() error {
+	if _, ok := concat.Strategies[c.Strategy]; !ok {
+		return fmt.Errorf("unknown strategy %q, expected one of %v", c.Strategy, concat.Names())
+	}
+	if c.N <= 0 || c.N > maxItems {
+		return fmt.Errorf("n must be between 1 and %d, got %d", maxItems, c.N)
+	}
+	if c.Workers < 0 || c.Workers > maxWorkers {
+		return fmt.Errorf("workers must be between 0 and %d, got %d", maxWorkers, c.Workers)
+	}
+	return nil
+}
+
+// generation 一次配置对应的一组 worker
+type generation struct {
+	cfg    workloadConfig
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	since  time.Time
+
+	iterations atomic.Int64
+}
+
+// workload 管理运行拼接任务的 worker goroutine，配置变化时停止旧 worker 再启动新 worker
+type workload struct {
+	mu  sync.Mutex
+	cur *generation
+}
+
+// current 返回当前的配置
+func (w *workload) current() *generation {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.cur
+}
+
+// apply 切换到新的配置。锁只用于替换当前配置，等待旧 worker 退出在锁外进行，
+// 期间 GET /workload 和退出不会被阻塞
+func (w *workload) apply(cfg workloadConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g := &generation{cfg: cfg, cancel: cancel, since: time.Now()}
+	// 先 Add 再发布，stop 拿到 g 后等待的一定包含这些 worker
+	g.wg.Add(cfg.Workers)
+
+	w.mu.Lock()
+	old := w.cur
+	w.cur = g
+	w.mu.Unlock()
+
+	// 旧 worker 全部退出后再启动新 worker，避免两种配置的 CPU 消耗混在同一段 profile 里
+	if old != nil {
+		old.cancel()
+		old.wg.Wait()
+	}
+
+	fn := concat.Strategies[cfg.Strategy]
+	total := iterationsTotal.With(cfg.Strategy)
+	for i := 0; i < cfg.Workers; i++ {
+		go func() {
+			defer g.wg.Done()
+			for ctx.Err() == nil {
+				_ = fn(cfg.N)
+				g.iterations.Add(1)
+				total.Inc()
+			}
+		}()
+	}
+	log.Printf("Workload: strategy=%s n=%d workers=%d", cfg.Strategy, cfg.N, cfg.Workers)
+	return nil
+}
+
+// stop 停止所有 worker，最多等到 ctx 结束
+func (w *workload) stop(ctx context.Context) error {
+	g := w.current()
+	if g == nil {
+		return nil
+	}
+	// 更早的配置在被替换时已经取消，只需要取消当前这一组
+	g.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("workers did not stop: %w", ctx.Err())
+	}
+}
+
+type workloadStatus struct {
+	workloadConfig
+	Strategies    []string `json:"strategies"`
+	Iterations    int64    `json:"iterations"`
+	Seconds       float64  `json:"seconds"`
+	IterationsSec float64  `json:"iterations_per_second"`
+}
+
+// ServeHTTP GET 返回当前配置和吞吐；POST 通过查询参数 strategy、n、workers 修改配置，
+// 未给出的参数保持不变，例如：
+//
+//	curl -X POST 'http://localhost:6060/workload?strategy=builder-grow&workers=4'
+func (w *workload) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		cfg := w.current().cfg
+
+		q := r.URL.Query()
+		if s := q.Get("strategy"); s != "" {
+			cfg.Strategy = s
+		}
+		for name, dst := range map[string]*int{"n": &cfg.N, "workers": &cfg.Workers} {
+			if s := q.Get(name); s != "" {
+				v, err := strconv.Atoi(s)
+				if err != nil {
+					http.Error(rw, fmt.Sprintf("invalid %s: %v", name, err), http.StatusBadRequest)
+					return
+				}
+				*dst = v
+			}
+		}
+		if err := w.apply(cfg); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	g := w.current()
+	st := workloadStatus{
+		workloadConfig: g.cfg,
+		Strategies:     concat.Names(),
+		Iterations:     g.iterations.Load(),
+		Seconds:        time.Since(g.since).Seconds(),
+	}
+	if st.Seconds > 0 {
+		st.IterationsSec = float64(st.Iterations) / st.Seconds
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(st)
+}
+
+func main() {
+	flag.Parse()
+
+	wl := &workload{}
+	if err := wl.apply(workloadConfig{Strategy: *strategy, N: *items, Workers: *workers}); err != nil {
+		log.Fatalf("invalid workload: %v", err)
+	}
+
+	// 启动管理端口（pprof、/exit、/healthz 等），并挂上负载控制端点
+	adm := admin.New(*adminOpts)
+	adm.Handle("/workload", wl)
+	adm.OnShutdown(wl.stop)
+	if err := adm.Start(); err != nil {
+		log.Fatalf("failed to start admin server: %v", err)
+	}
+	pprofAddr := adm.Addr().String()
+
+	fmt.Println("\n" + strings.Repeat("=", 70))
+	fmt.Println("Starting switchable workload for CPU profiling...")
+	fmt.Println("Press Ctrl+C to stop")
+	fmt.Println(strings.Repeat("=", 70) + "\n")
+
+	fmt.Println("Tip: Use the following commands to switch and profile the workload:")
+	fmt.Println("  1. Show current workload and throughput:")
+	fmt.Printf("     curl http://%s/workload\n", pprofAddr)
+	fmt.Println("")
+	fmt.Println("  2. Switch strategy / item count / worker count:")
+	fmt.Printf("     curl -X POST 'http://%s/workload?strategy=builder-grow&n=1000&workers=4'\n", pprofAddr)
+	fmt.Printf("     strategies: %s\n", strings.Join(concat.Names(), ", "))
+	fmt.Println("")
+	fmt.Println("  3. Capture 30s CPU profile:")
+	fmt.Printf("     curl http://%s/debug/pprof/profile?seconds=30 -o cpu.prof\n", pprofAddr)
+	fmt.Println("")
+
+	adm.SetReady(true)
+	if err := adm.Wait(); err != nil {
+		log.Printf("shutdown error: %v", err)
+	}
+}
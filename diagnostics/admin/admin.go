@@ -0,0 +1,304 @@
+// Package admin 为所有 demo server 提供统一的诊断管理端口：
+// pprof、/exit、/gc、/healthz、/readyz、expvar、runtime/metrics、Prometheus /metrics 以及优雅退出。
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	prom "github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/metrics"
+)
+
+var (
+	startTime   = time.Now()
+	publishOnce sync.Once
+)
+
+// Server 管理端口服务
+type Server struct {
+	opts Options
+	mux  *http.ServeMux
+	srv  *http.Server
+	ln   net.Listener
+
+	ready    atomic.Bool
+	exitOnce sync.Once
+	exitCh   chan struct{}
+
+	mu    sync.Mutex
+	hooks []func(ctx context.Context) error
+}
+
+// New 创建管理端口服务，并注册所有内置端点
+func New(opts Options) *Server {
+	if opts.ShutdownTimeout == 0 {
+		opts.ShutdownTimeout = 5 * time.Second
+	}
+	s := &Server{
+		opts:   opts,
+		mux:    http.NewServeMux(),
+		exitCh: make(chan struct{}),
+	}
+
+	publishOnce.Do(func() {
+		expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+		expvar.Publish("uptime_seconds", expvar.Func(func() any { return time.Since(startTime).Seconds() }))
+		prom.RegisterRuntime(prom.Default, startTime)
+	})
+
+	s.mux.HandleFunc("/debug/pprof/", pprof.Index)
+	s.mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	s.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	s.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	s.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	s.mux.Handle("/debug/vars", expvar.Handler())
+	s.mux.HandleFunc("/debug/runtime-metrics", runtimeMetricsHandler)
+	s.mux.Handle("/metrics", prom.Default)
+	s.mux.HandleFunc("/healthz", s.healthzHandler)
+	s.mux.HandleFunc("/readyz", s.readyzHandler)
+	s.mux.HandleFunc("/gc", s.gcHandler)
+	s.mux.HandleFunc("/exit", s.exitHandler)
+
+	s.srv = &http.Server{
+		Handler:           s.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+// Handle 在管理端口上注册额外的端点
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleFunc 在管理端口上注册额外的端点
+func (s *Server) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	s.mux.HandleFunc(pattern, handler)
+}
+
+// OnShutdown 注册优雅退出时执行的回调（例如关闭业务 server），按注册的逆序执行
+func (s *Server) OnShutdown(fn func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, fn)
+}
+
+// SetReady 设置 /readyz 的返回状态
+func (s *Server) SetReady(ready bool) {
+	s.ready.Store(ready)
+}
+
+// Addr 返回实际监听的地址，在 Start 之后有效
+func (s *Server) Addr() net.Addr {
+	if s.ln == nil {
+		return nil
+	}
+	return s.ln.Addr()
+}
+
+// Start 监听管理端口并在后台提供服务
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.opts.Addr)
+	if err != nil {
+		return fmt.Errorf("admin listen %s: %w", s.opts.Addr, err)
+	}
+	s.ln = ln
+
+	if s.opts.MutexProfileFraction > 0 {
+		runtime.SetMutexProfileFraction(s.opts.MutexProfileFraction)
+	}
+	if s.opts.BlockProfileRate > 0 {
+		runtime.SetBlockProfileRate(s.opts.BlockProfileRate)
+	}
+
+	s.logf("Admin server listening on http://%s", ln.Addr())
+	s.logf("  pprof:   http://%s/debug/pprof/", ln.Addr())
+	s.logf("  expvar:  http://%s/debug/vars, http://%s/debug/runtime-metrics", ln.Addr(), ln.Addr())
+	s.logf("  metrics: http://%s/metrics", ln.Addr())
+	s.logf("  health:  http://%s/healthz, http://%s/readyz", ln.Addr(), ln.Addr())
+	s.logf("  control: POST http://%s/gc, POST http://%s/exit", ln.Addr(), ln.Addr())
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logf("admin server error: %v", err)
+		}
+	}()
+
+	if s.opts.GoroutineLogInterval > 0 {
+		go s.logGoroutines()
+	}
+	return nil
+}
+
+// Exit 请求优雅退出，可以被多次调用
+func (s *Server) Exit() {
+	s.exitOnce.Do(func() { close(s.exitCh) })
+}
+
+// Done 在收到退出请求（/exit 或信号）后关闭
+func (s *Server) Done() <-chan struct{} {
+	return s.exitCh
+}
+
+// Wait 阻塞直到收到 SIGINT/SIGTERM 或 /exit 请求，然后执行优雅退出
+func (s *Server) Wait() error {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	select {
+	case sig := <-sigCh:
+		s.logf("Received signal %v, shutting down...", sig)
+	case <-s.exitCh:
+		s.logf("Exit requested, shutting down...")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.ShutdownTimeout)
+	defer cancel()
+	return s.Shutdown(ctx)
+}
+
+// Shutdown 依次执行退出回调，最后关闭管理端口
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.SetReady(false)
+	s.Exit()
+
+	s.mu.Lock()
+	hooks := append([]func(ctx context.Context) error(nil), s.hooks...)
+	s.mu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i](ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := s.srv.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("admin shutdown: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// StopFunc 把不接受 context 的停止函数（如 fasthttp.Server.Shutdown）适配成 OnShutdown 回调，
+// 超时后不再等待
+func StopFunc(stop func() error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		done := make(chan error, 1)
+		go func() { done <- stop() }()
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *Server) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"status":"ok","uptime_seconds":%.0f}`, time.Since(startTime).Seconds())
+}
+
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !s.ready.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"status":"not ready"}`)
+		return
+	}
+	fmt.Fprint(w, `{"status":"ready"}`)
+}
+
+// /debug/runtime-metrics 以 JSON 返回所有标量 runtime/metrics 指标和进程 PID，
+// 供外部的 timeline 记录器采样
+func runtimeMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	descs := metrics.All()
+	samples := make([]metrics.Sample, len(descs))
+	for i, d := range descs {
+		samples[i].Name = d.Name
+	}
+	metrics.Read(samples)
+
+	values := make(map[string]any, len(samples))
+	for _, s := range samples {
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			values[s.Name] = s.Value.Uint64()
+		case metrics.KindFloat64:
+			values[s.Name] = s.Value.Float64()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"pid":     os.Getpid(),
+		"time":    time.Now(),
+		"metrics": values,
+	})
+}
+
+// /gc 触发一次 GC，带 ?free=1 时同时把内存归还给操作系统；只接受 POST
+func (s *Server) gcHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if r.URL.Query().Get("free") == "1" {
+		debug.FreeOSMemory()
+	} else {
+		runtime.GC()
+	}
+	runtime.ReadMemStats(&after)
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"status":"gc triggered","heap_inuse_before":%d,"heap_inuse_after":%d}`,
+		before.HeapInuse, after.HeapInuse)
+}
+
+// /exit 优雅退出；只接受 POST，避免浏览器预取或爬虫的 GET 关掉进程
+func (s *Server) exitHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, `{"status":"exit"}`)
+	s.Exit()
+}
+
+func (s *Server) logGoroutines() {
+	ticker := time.NewTicker(s.opts.GoroutineLogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.logf("Current goroutines: %d", runtime.NumGoroutine())
+		case <-s.exitCh:
+			return
+		}
+	}
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.opts.Name != "" {
+		format = "[" + s.opts.Name + "] " + format
+	}
+	log.Printf(format, args...)
+}
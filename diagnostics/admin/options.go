@@ -0,0 +1,36 @@
+package admin
+
+import (
+	"flag"
+	"time"
+)
+
+// Options 管理端口的配置，所有 demo server 共用同一组 flag
+type Options struct {
+	// Addr 管理端口监听地址（pprof、/exit、/gc、/healthz 等）
+	Addr string
+	// Name 日志前缀，用于区分不同的 server
+	Name string
+	// ShutdownTimeout 优雅退出的最长等待时间
+	ShutdownTimeout time.Duration
+	// GoroutineLogInterval 定期打印 goroutine 数量的间隔，0 表示不打印
+	GoroutineLogInterval time.Duration
+	// MutexProfileFraction 传给 runtime.SetMutexProfileFraction，0 表示不采集 mutex profile
+	MutexProfileFraction int
+	// BlockProfileRate 传给 runtime.SetBlockProfileRate（纳秒），0 表示不采集 block profile
+	BlockProfileRate int
+}
+
+// Flags 在 fs 上注册管理端口相关的 flag，defaults 提供各 server 自己的默认值
+func Flags(fs *flag.FlagSet, defaults Options) *Options {
+	opts := defaults
+	if opts.ShutdownTimeout == 0 {
+		opts.ShutdownTimeout = 5 * time.Second
+	}
+	fs.StringVar(&opts.Addr, "admin", opts.Addr, "admin HTTP server address (pprof, /exit, /gc, /healthz, /readyz, /debug/vars)")
+	fs.DurationVar(&opts.ShutdownTimeout, "shutdown-timeout", opts.ShutdownTimeout, "graceful shutdown timeout")
+	fs.DurationVar(&opts.GoroutineLogInterval, "goroutine-log-interval", opts.GoroutineLogInterval, "interval for logging goroutine count (0 disables)")
+	fs.IntVar(&opts.MutexProfileFraction, "mutex-profile-fraction", opts.MutexProfileFraction, "runtime.SetMutexProfileFraction value (0 disables)")
+	fs.IntVar(&opts.BlockProfileRate, "block-profile-rate", opts.BlockProfileRate, "runtime.SetBlockProfileRate value in nanoseconds (0 disables)")
+	return &opts
+}
@@ -0,0 +1,202 @@
+// Package capture 负责从 demo server 的管理端口抓取 pprof profile，
+// 以及按顺序启动、采集、停止一组 good/bad server。
+package capture
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Profile 描述一次 profile 采集：名称与采样时长
+type Profile struct {
+	// Name pprof 的 profile 名称：cpu、heap、allocs、goroutine、mutex、block、trace
+	Name string
+	// Duration 采样时长；cpu/trace 必须大于 0，heap/allocs/mutex/block 大于 0 时采集增量 profile
+	Duration time.Duration
+}
+
+// DefaultProfiles 默认采集的 profile 列表
+var DefaultProfiles = []Profile{
+	{Name: "cpu", Duration: 30 * time.Second},
+	{Name: "heap"},
+	{Name: "allocs"},
+	{Name: "goroutine"},
+	{Name: "mutex", Duration: 10 * time.Second},
+	{Name: "block", Duration: 10 * time.Second},
+}
+
+var knownProfiles = map[string]bool{
+	"cpu": true, "heap": true, "allocs": true, "goroutine": true,
+	"mutex": true, "block": true, "threadcreate": true, "trace": true,
+}
+
+// ParseProfiles 解析形如 "cpu=30s,heap,goroutine,mutex=10s" 的 profile 列表
+func ParseProfiles(s string) ([]Profile, error) {
+	var profiles []Profile
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, dur, hasDur := strings.Cut(item, "=")
+		if !knownProfiles[name] {
+			return nil, fmt.Errorf("unknown profile %q", name)
+		}
+		p := Profile{Name: name}
+		if hasDur {
+			d, err := time.ParseDuration(dur)
+			if err != nil {
+				return nil, fmt.Errorf("profile %s: invalid duration %q: %w", name, dur, err)
+			}
+			// pprof 的 seconds 参数只接受整数秒，不足 1 秒会取整成 0，而 0 被当作默认的 30 秒
+			if d < time.Second {
+				return nil, fmt.Errorf("profile %s: duration %v is shorter than 1s", name, d)
+			}
+			p.Duration = d
+		}
+		if (name == "cpu" || name == "trace") && p.Duration <= 0 {
+			return nil, fmt.Errorf("profile %s requires a duration, e.g. %s=30s", name, name)
+		}
+		profiles = append(profiles, p)
+	}
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no profiles specified")
+	}
+	return profiles, nil
+}
+
+// Path 返回该 profile 在 pprof 端点下的路径（含查询参数）
+func (p Profile) Path() string {
+	name := p.Name
+	if name == "cpu" {
+		name = "profile"
+	}
+	path := "/debug/pprof/" + name
+	if p.Duration > 0 {
+		path += fmt.Sprintf("?seconds=%d", int(p.Duration.Round(time.Second)/time.Second))
+	}
+	return path
+}
+
+// FileName 返回保存该 profile 的文件名，例如 bad_cpu.prof
+func (p Profile) FileName(target string) string {
+	ext := ".prof"
+	if p.Name == "trace" {
+		ext = ".trace"
+	}
+	return target + "_" + p.Name + ext
+}
+
+// Result 单个 profile 的采集结果，会写入 manifest
+type Result struct {
+	Profile   string        `json:"profile"`
+	URL       string        `json:"url"`
+	File      string        `json:"file,omitempty"`
+	Duration  time.Duration `json:"duration_ns,omitempty"`
+	Bytes     int64         `json:"bytes"`
+	StartedAt time.Time     `json:"started_at"`
+	Elapsed   time.Duration `json:"elapsed_ns"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Fetch 从 baseURL（例如 http://127.0.0.1:6060）采集一个 profile 并写入 dst。
+// 请求超时为采样时长加上 slack，避免像 curl 那样无限等待。
+func Fetch(ctx context.Context, client *http.Client, baseURL string, p Profile, dst string, slack time.Duration) (Result, error) {
+	res := Result{
+		Profile:   p.Name,
+		URL:       strings.TrimRight(baseURL, "/") + p.Path(),
+		Duration:  p.Duration,
+		StartedAt: time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.Duration+slack)
+	defer cancel()
+
+	fail := func(err error) (Result, error) {
+		res.Error = err.Error()
+		res.Elapsed = time.Since(res.StartedAt)
+		return res, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, res.URL, nil)
+	if err != nil {
+		return fail(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fail(fmt.Errorf("fetch %s: %w", p.Name, err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fail(fmt.Errorf("fetch %s: unexpected status %d: %s", p.Name, resp.StatusCode, strings.TrimSpace(string(body))))
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return fail(err)
+	}
+	n, err := io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	res.Bytes = n
+	if err != nil {
+		// 不留下截断的 profile，免得之后被当成完整的文件分析
+		os.Remove(dst)
+		return fail(fmt.Errorf("write %s: %w", dst, err))
+	}
+	res.File = dst
+	res.Elapsed = time.Since(res.StartedAt)
+	return res, nil
+}
+
+// WaitReady 轮询 baseURL 的 /readyz 直到返回 200（没有 /readyz 的 server 退回检查 pprof 首页），或者 ctx 结束
+func WaitReady(ctx context.Context, client *http.Client, baseURL string, interval time.Duration) error {
+	base := strings.TrimRight(baseURL, "/")
+	probe := func(path string) (int, error) {
+		reqCtx, cancel := context.WithTimeout(ctx, interval)
+		defer cancel()
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, base+path, nil)
+		if err != nil {
+			return 0, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		code, err := probe("/readyz")
+		if err == nil && code == http.StatusNotFound {
+			code, err = probe("/debug/pprof/")
+		}
+		switch {
+		case err != nil:
+			lastErr = err
+		case code == http.StatusOK:
+			return nil
+		default:
+			lastErr = fmt.Errorf("status %d", code)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for %s: %w (last error: %v)", base, ctx.Err(), lastErr)
+		case <-ticker.C:
+		}
+	}
+}
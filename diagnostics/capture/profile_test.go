@@ -0,0 +1,113 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseProfiles(t *testing.T) {
+	tests := []struct {
+		in       string
+		want     []Profile
+		wantFail bool
+	}{
+		{in: "cpu=30s, heap,goroutine", want: []Profile{{"cpu", 30 * time.Second}, {"heap", 0}, {"goroutine", 0}}},
+		{in: "mutex=1s,trace=1500ms", want: []Profile{{"mutex", time.Second}, {"trace", 1500 * time.Millisecond}}},
+		{in: "", wantFail: true},
+		{in: "cpu", wantFail: true},
+		{in: "heap,leaks", wantFail: true},
+		{in: "block=abc", wantFail: true},
+		// 不足 1 秒会变成 ?seconds=0，pprof 按默认的 30 秒采集
+		{in: "cpu=500ms", wantFail: true},
+		{in: "heap=999ms", wantFail: true},
+		{in: "mutex=-1s", wantFail: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseProfiles(tt.in)
+		if tt.wantFail {
+			if err == nil {
+				t.Errorf("ParseProfiles(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseProfiles(%q): %v", tt.in, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseProfiles(%q) = %v, want %v", tt.in, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ParseProfiles(%q)[%d] = %v, want %v", tt.in, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestProfilePath(t *testing.T) {
+	tests := []struct {
+		p    Profile
+		want string
+	}{
+		{Profile{"cpu", 30 * time.Second}, "/debug/pprof/profile?seconds=30"},
+		{Profile{"trace", 1500 * time.Millisecond}, "/debug/pprof/trace?seconds=2"},
+		{Profile{"heap", 0}, "/debug/pprof/heap"},
+	}
+	for _, tt := range tests {
+		if got := tt.p.Path(); got != tt.want {
+			t.Errorf("%v.Path() = %q, want %q", tt.p, got, tt.want)
+		}
+	}
+}
+
+// 响应体在中途断开时不留下截断的文件
+func TestFetchRemovesPartialFile(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1024")
+		w.Write([]byte("partial profile"))
+	}))
+	defer ts.Close()
+
+	dst := filepath.Join(t.TempDir(), "bad_heap.prof")
+	res, err := Fetch(context.Background(), ts.Client(), ts.URL, Profile{Name: "heap"}, dst, 5*time.Second)
+	if err == nil || res.Error == "" || res.File != "" {
+		t.Fatalf("Fetch = %+v, %v; want an error", res, err)
+	}
+	if _, err := os.Stat(dst); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("partial file left behind: stat err = %v", err)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/debug/pprof/heap" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("heap profile"))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "good_heap.prof")
+	res, err := Fetch(context.Background(), ts.Client(), ts.URL+"/", Profile{Name: "heap"}, dst, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "heap profile" || res.Bytes != 12 || res.File != dst {
+		t.Errorf("Fetch = %+v, file %q", res, data)
+	}
+
+	if _, err := Fetch(context.Background(), ts.Client(), ts.URL, Profile{Name: "goroutine"}, filepath.Join(dir, "x.prof"), time.Second); err == nil {
+		t.Error("Fetch of a missing profile should fail")
+	}
+}
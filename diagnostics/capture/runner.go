@@ -0,0 +1,337 @@
+package capture
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Target 一个待采集的 server：名称（如 bad、good）与可执行文件或 Go 包目录
+type Target struct {
+	Name string `json:"name"`
+	// Path 可执行文件路径；如果是目录，则先 go build 该目录
+	Path string `json:"path"`
+	// Args 额外传给 server 的参数
+	Args []string `json:"args,omitempty"`
+}
+
+// ParseTargets 解析形如 "bad=./bad_server,good=./good_server" 的目标列表
+func ParseTargets(s string) ([]Target, error) {
+	var targets []Target
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, path, ok := strings.Cut(item, "=")
+		if !ok || name == "" || path == "" {
+			return nil, fmt.Errorf("invalid target %q, expected name=path", item)
+		}
+		targets = append(targets, Target{Name: name, Path: path})
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets specified")
+	}
+	return targets, nil
+}
+
+// Config 采集流程的配置
+type Config struct {
+	Targets  []Target
+	Profiles []Profile
+	// OutDir 输出目录，profile、server 日志和 manifest.json 都写在这里
+	OutDir string
+	// Warmup server 就绪后、开始采集前的等待时间，让负载稳定下来
+	Warmup time.Duration
+	// ReadyTimeout 等待 server 就绪的最长时间
+	ReadyTimeout time.Duration
+	// StopTimeout 发出退出请求后等待进程结束的时间，超时后强制 kill
+	StopTimeout time.Duration
+	// FetchSlack 每个 profile 请求在采样时长之外允许的额外时间
+	FetchSlack time.Duration
+	// AdminFlag 传递管理端口地址给 server 的 flag 名称
+	AdminFlag string
+	// ExtraArgs 传给每个 server 的公共参数
+	ExtraArgs []string
+}
+
+// TargetManifest 单个 server 的采集记录
+type TargetManifest struct {
+	Target
+	Binary    string    `json:"binary"`
+	AdminAddr string    `json:"admin_addr"`
+	Log       string    `json:"log"` // 相对于 OutDir
+	PID       int       `json:"pid,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	StoppedAt time.Time `json:"stopped_at"`
+	Profiles  []Result  `json:"profiles"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Manifest 整次采集的记录，写入 OutDir/manifest.json
+type Manifest struct {
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt time.Time        `json:"finished_at"`
+	Host       string           `json:"host"`
+	Targets    []TargetManifest `json:"targets"`
+}
+
+// Run 依次启动每个 target，等待就绪后采集 profile，再停止进程。
+// 无论成功、失败还是 ctx 被取消（例如 SIGINT），子进程都会被清理。
+func Run(ctx context.Context, cfg Config) (*Manifest, error) {
+	if cfg.AdminFlag == "" {
+		cfg.AdminFlag = "admin"
+	}
+	if err := os.MkdirAll(cfg.OutDir, 0o755); err != nil {
+		return nil, err
+	}
+	binDir, err := os.MkdirTemp("", "capture-bin-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(binDir)
+
+	host, _ := os.Hostname()
+	m := &Manifest{StartedAt: time.Now(), Host: host}
+	client := &http.Client{}
+
+	var errs []error
+	for _, t := range cfg.Targets {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+		tm, err := runTarget(ctx, client, cfg, t, binDir)
+		if err != nil {
+			tm.Error = err.Error()
+			errs = append(errs, fmt.Errorf("%s: %w", t.Name, err))
+			log.Printf("❌ %s: %v", t.Name, err)
+		}
+		m.Targets = append(m.Targets, tm)
+	}
+
+	m.FinishedAt = time.Now()
+	if err := WriteManifest(filepath.Join(cfg.OutDir, "manifest.json"), m); err != nil {
+		errs = append(errs, err)
+	}
+	return m, errors.Join(errs...)
+}
+
+func runTarget(ctx context.Context, client *http.Client, cfg Config, t Target, binDir string) (tm TargetManifest, err error) {
+	tm = TargetManifest{Target: t, StartedAt: time.Now()}
+	defer func() { tm.StoppedAt = time.Now() }()
+
+	bin, err := resolveBinary(ctx, t, binDir)
+	if err != nil {
+		return tm, err
+	}
+	tm.Binary = bin
+
+	adminAddr, err := FreeAddr()
+	if err != nil {
+		return tm, err
+	}
+	tm.AdminAddr = adminAddr
+	baseURL := "http://" + adminAddr
+
+	tm.Log = t.Name + ".log"
+	logFile, err := os.Create(filepath.Join(cfg.OutDir, tm.Log))
+	if err != nil {
+		return tm, err
+	}
+	defer logFile.Close()
+
+	args := append([]string{"-" + cfg.AdminFlag, adminAddr}, cfg.ExtraArgs...)
+	args = append(args, t.Args...)
+	proc, err := StartProcess(bin, args, logFile, cfg.StopTimeout)
+	if err != nil {
+		return tm, err
+	}
+	tm.PID = proc.Pid()
+	log.Printf("🚀 %s started (PID %d, admin %s)", t.Name, tm.PID, adminAddr)
+	defer func() {
+		if err := proc.Stop(client, baseURL); err != nil {
+			log.Printf("⚠️  %s: %v", t.Name, err)
+		}
+		log.Printf("🧹 %s stopped", t.Name)
+	}()
+
+	readyCtx, cancel := context.WithTimeout(ctx, cfg.ReadyTimeout)
+	err = waitReadyOrExit(readyCtx, client, baseURL, proc)
+	cancel()
+	if err != nil {
+		return tm, err
+	}
+	log.Printf("✅ %s is ready", t.Name)
+
+	if cfg.Warmup > 0 {
+		log.Printf("⏳ Warming up %s for %v...", t.Name, cfg.Warmup)
+		select {
+		case <-time.After(cfg.Warmup):
+		case <-ctx.Done():
+			return tm, ctx.Err()
+		case <-proc.Exited():
+			return tm, fmt.Errorf("process exited during warmup: %v", proc.Err())
+		}
+	}
+
+	var errs []error
+	for _, p := range cfg.Profiles {
+		dst := filepath.Join(cfg.OutDir, p.FileName(t.Name))
+		log.Printf("📸 Capturing %s profile from %s (%v)...", p.Name, t.Name, p.Duration)
+		res, err := Fetch(ctx, client, baseURL, p, dst, cfg.FetchSlack)
+		if res.File != "" {
+			res.File = filepath.Base(res.File)
+		}
+		tm.Profiles = append(tm.Profiles, res)
+		if err != nil {
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		log.Printf("   saved %s (%d bytes)", dst, res.Bytes)
+	}
+	return tm, errors.Join(errs...)
+}
+
+func waitReadyOrExit(ctx context.Context, client *http.Client, baseURL string, proc *Process) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-proc.Exited():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	err := WaitReady(ctx, client, baseURL, 200*time.Millisecond)
+	select {
+	case <-proc.Exited():
+		return fmt.Errorf("process exited before becoming ready: %v", proc.Err())
+	default:
+	}
+	return err
+}
+
+// resolveBinary 如果 Path 是目录则编译它，否则直接使用该可执行文件
+func resolveBinary(ctx context.Context, t Target, binDir string) (string, error) {
+	info, err := os.Stat(t.Path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return filepath.Abs(t.Path)
+	}
+
+	bin := filepath.Join(binDir, t.Name)
+	log.Printf("📦 Compiling %s from %s...", t.Name, t.Path)
+	cmd := exec.CommandContext(ctx, "go", "build", "-o", bin, ".")
+	cmd.Dir = t.Path
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("go build %s: %w", t.Path, err)
+	}
+	return bin, nil
+}
+
+// FreeAddr 向内核申请一个空闲的本地端口，避免与已占用的 6060 冲突
+func FreeAddr() (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer ln.Close()
+	return ln.Addr().String(), nil
+}
+
+// Process 被采集的子进程
+type Process struct {
+	cmd         *exec.Cmd
+	stopTimeout time.Duration
+	exited      chan struct{}
+	err         error
+}
+
+// StartProcess 启动子进程，标准输出和标准错误写入 logFile
+func StartProcess(bin string, args []string, logFile *os.File, stopTimeout time.Duration) (*Process, error) {
+	cmd := exec.Command(bin, args...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p := &Process{cmd: cmd, stopTimeout: stopTimeout, exited: make(chan struct{})}
+	go func() {
+		p.err = cmd.Wait()
+		close(p.exited)
+	}()
+	return p, nil
+}
+
+// Pid 子进程 PID
+func (p *Process) Pid() int { return p.cmd.Process.Pid }
+
+// Exited 子进程退出后关闭
+func (p *Process) Exited() <-chan struct{} { return p.exited }
+
+// Err 子进程退出的错误，仅在 Exited 关闭后有效
+func (p *Process) Err() error { return p.err }
+
+// Stop 先通过 /exit 请求优雅退出，再发 SIGTERM，最后 SIGKILL
+func (p *Process) Stop(client *http.Client, baseURL string) error {
+	select {
+	case <-p.exited:
+		return nil
+	default:
+	}
+
+	wait := func(d time.Duration) bool {
+		select {
+		case <-p.exited:
+			return true
+		case <-time.After(d):
+			return false
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+"/exit", nil)
+	if resp, err := client.Do(req); err == nil {
+		resp.Body.Close()
+	}
+	cancel()
+	if wait(p.stopTimeout) {
+		return nil
+	}
+
+	p.cmd.Process.Signal(syscall.SIGTERM)
+	if wait(p.stopTimeout) {
+		return nil
+	}
+
+	p.cmd.Process.Kill()
+	<-p.exited
+	return fmt.Errorf("process %d did not exit in time, killed", p.Pid())
+}
+
+// WriteManifest 以缩进 JSON 格式写入 manifest
+func WriteManifest(path string, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,196 @@
+// collector 持续采集 demo server 的 profile，并按时间戳查询、对比快照。
+//
+//	collector run -targets cpu=localhost:6060,grpc=localhost:50052,memory=localhost:6061
+//	collector list -target grpc
+//	collector query -target grpc -profile goroutine -from -10m -to latest
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/capture"
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/collector"
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/profdiff"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: collector <command> [flags]
+
+Commands:
+  run     scrape profiles from targets on a schedule
+  list    list stored snapshots
+  query   pick two snapshots by timestamp and compare them
+
+Run "collector <command> -h" for command flags.
+`)
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, args := os.Args[1], os.Args[2:]
+	switch cmd {
+	case "run":
+		runCmd(args)
+	case "list":
+		listCmd(args)
+	case "query":
+		queryCmd(args)
+	default:
+		usage()
+	}
+}
+
+func runCmd(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	dir := fs.String("dir", "profiles-collected", "snapshot directory")
+	targets := fs.String("targets", "cpu=localhost:6060,grpc=localhost:50052", "comma separated name=admin-addr list")
+	profiles := fs.String("profiles", "cpu=10s,heap,goroutine", "comma separated profiles to scrape, name[=duration]")
+	interval := fs.Duration("interval", time.Minute, "scrape interval per target")
+	retention := fs.Duration("retention", 24*time.Hour, "delete snapshots older than this (0 keeps all)")
+	maxSnapshots := fs.Int("max-snapshots", 500, "max snapshots kept per target and profile (0 for unlimited)")
+	fetchSlack := fs.Duration("fetch-slack", 15*time.Second, "extra timeout for each profile request beyond its duration")
+	fs.Parse(args)
+
+	targetList, err := collector.ParseTargets(*targets)
+	if err != nil {
+		log.Fatalf("invalid -targets: %v", err)
+	}
+	profileList, err := capture.ParseProfiles(*profiles)
+	if err != nil {
+		log.Fatalf("invalid -profiles: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := &collector.Collector{
+		Store:        &collector.Store{Dir: *dir},
+		Targets:      targetList,
+		Profiles:     profileList,
+		Interval:     *interval,
+		Retention:    *retention,
+		MaxSnapshots: *maxSnapshots,
+		FetchSlack:   *fetchSlack,
+	}
+	log.Printf("Collector writing snapshots to %s (retention %v, max %d per profile)", *dir, *retention, *maxSnapshots)
+	c.Run(ctx)
+	log.Printf("Collector stopped")
+}
+
+func listCmd(args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	dir := fs.String("dir", "profiles-collected", "snapshot directory")
+	target := fs.String("target", "", "only list this target")
+	profile := fs.String("profile", "", "only list this profile")
+	fs.Parse(args)
+
+	store := &collector.Store{Dir: *dir}
+	targets := []string{*target}
+	if *target == "" {
+		var err error
+		if targets, err = store.Targets(); err != nil {
+			log.Fatalf("failed to list targets: %v", err)
+		}
+	}
+	for _, t := range targets {
+		profiles := []string{*profile}
+		if *profile == "" {
+			var err error
+			if profiles, err = store.Profiles(t); err != nil {
+				log.Fatalf("failed to list profiles: %v", err)
+			}
+		}
+		for _, p := range profiles {
+			snaps, err := store.List(t, p)
+			if err != nil {
+				log.Fatalf("failed to list snapshots: %v", err)
+			}
+			for _, s := range snaps {
+				fmt.Printf("%s\t%s\t%s\t%d\t%s\n", s.Target, s.Profile, s.Time.Local().Format(time.RFC3339), s.Size, s.Path)
+			}
+		}
+	}
+}
+
+func queryCmd(args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	dir := fs.String("dir", "profiles-collected", "snapshot directory")
+	target := fs.String("target", "", "target name (required)")
+	profile := fs.String("profile", "heap", "profile name")
+	from := fs.String("from", "earliest", "time of the base snapshot: RFC3339, HH:MM:SS, relative like -10m, earliest or latest")
+	to := fs.String("to", "latest", "time of the target snapshot, same formats as -from")
+	format := fs.String("format", "text", "output format: text, json or markdown")
+	top := fs.Int("top", 15, "max rows in the comparison (0 for all)")
+	pathsOnly := fs.Bool("paths", false, "only print the two snapshot paths")
+	fs.Parse(args)
+
+	if *target == "" {
+		log.Fatalf("-target is required")
+	}
+	now := time.Now()
+	fromTime, err := collector.ParseTime(*from, now)
+	if err != nil {
+		log.Fatalf("invalid -from: %v", err)
+	}
+	toTime, err := collector.ParseTime(*to, now)
+	if err != nil {
+		log.Fatalf("invalid -to: %v", err)
+	}
+
+	store := &collector.Store{Dir: *dir}
+	base, err := store.Nearest(*target, *profile, fromTime)
+	if err != nil {
+		log.Fatalf("failed to find base snapshot: %v", err)
+	}
+	next, err := store.Nearest(*target, *profile, toTime)
+	if err != nil {
+		log.Fatalf("failed to find target snapshot: %v", err)
+	}
+	if *pathsOnly {
+		fmt.Println(base.Path)
+		fmt.Println(next.Path)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "base:   %s (%s)\n", base.Path, base.Time.Local().Format(time.RFC3339))
+	fmt.Fprintf(os.Stderr, "target: %s (%s)\n", next.Path, next.Time.Local().Format(time.RFC3339))
+	fmt.Fprintf(os.Stderr, "pprof:  go tool pprof -base %s %s\n\n", base.Path, next.Path)
+
+	baseLabel, nextLabel := base.Time.Local().Format("15:04:05"), next.Time.Local().Format("15:04:05")
+	if *profile == "heap" || *profile == "allocs" {
+		report, err := profdiff.LoadHeapDiff(base.Path, next.Path, baseLabel, nextLabel, profdiff.HeapOptions{
+			Top:       *top,
+			FlagShare: 0.2,
+		})
+		if err != nil {
+			log.Fatalf("failed to compare snapshots: %v", err)
+		}
+		if err := report.Write(os.Stdout, *format); err != nil {
+			log.Fatalf("failed to write report: %v", err)
+		}
+		return
+	}
+
+	baseSummary, err := profdiff.LoadSummary(base.Path, "", nil)
+	if err != nil {
+		log.Fatalf("failed to load base snapshot: %v", err)
+	}
+	nextSummary, err := profdiff.LoadSummary(next.Path, "", nil)
+	if err != nil {
+		log.Fatalf("failed to load target snapshot: %v", err)
+	}
+	report := profdiff.Diff(baseSummary, nextSummary, baseLabel, nextLabel, profdiff.Options{Top: *top, MinDelta: 0.005})
+	if err := report.Write(os.Stdout, *format); err != nil {
+		log.Fatalf("failed to write report: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+// timeline 按固定间隔记录一个进程的 RSS 和 Go runtime/metrics，输出 CSV、JSON 和 HTML 图表。
+//
+//	timeline -admin localhost:6060 -out bad_server_timeline
+//	timeline -pid 12345 -interval 200ms -duration 1m
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/timeline"
+)
+
+var (
+	pid      = flag.Int("pid", 0, "process to read /proc/<pid>/status from (0 uses the pid reported by -admin)")
+	adminURL = flag.String("admin", "", "admin address serving /debug/runtime-metrics, e.g. localhost:6060")
+	interval = flag.Duration("interval", 500*time.Millisecond, "sampling interval")
+	duration = flag.Duration("duration", 0, "stop after this long (0 records until the target exits or Ctrl+C)")
+	out      = flag.String("out", "timeline", "output path prefix; writes <out>.csv, <out>.json and <out>.html")
+	title    = flag.String("title", "", "HTML report title (defaults to the output name)")
+	quiet    = flag.Bool("q", false, "do not log each sample")
+)
+
+func main() {
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	rec := &timeline.Recorder{
+		Source:   timeline.Source{PID: *pid, Admin: *adminURL},
+		Interval: *interval,
+	}
+	if !*quiet {
+		rec.OnSample = func(s timeline.Sample) {
+			log.Printf("%6.1fs rss=%.1fMB heap=%.1fMB unused=%.1fMB free=%.1fMB released=%.1fMB stacks=%.1fMB goroutines=%d threads=%d gc=%d",
+				s.Elapsed.Seconds(), mb(s.RSS), mb(s.HeapObjects), mb(s.HeapUnused), mb(s.HeapFree), mb(s.HeapReleased),
+				mb(s.Stacks), s.Goroutines, s.Threads, s.GCCycles)
+		}
+	}
+
+	log.Printf("Recording timeline (pid=%d admin=%q interval=%v)...", *pid, *adminURL, *interval)
+	samples, err := rec.Record(ctx)
+	if err != nil {
+		log.Fatalf("failed to record: %v", err)
+	}
+	log.Printf("Recorded %d samples", len(samples))
+
+	name := *title
+	if name == "" {
+		name = filepath.Base(*out)
+	}
+	for ext, write := range map[string]func(*os.File) error{
+		".csv":  func(f *os.File) error { return timeline.WriteCSV(f, samples) },
+		".json": func(f *os.File) error { return timeline.WriteJSON(f, samples) },
+		".html": func(f *os.File) error { return timeline.WriteHTML(f, name, samples) },
+	} {
+		if err := writeFile(*out+ext, write); err != nil {
+			log.Fatalf("failed to write %s: %v", *out+ext, err)
+		}
+		fmt.Println(*out + ext)
+	}
+}
+
+func writeFile(path string, write func(*os.File) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func mb(v uint64) float64 { return float64(v) / (1 << 20) }
@@ -0,0 +1,154 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/capture"
+)
+
+// Target 一个被定期采集的 server 管理端口
+type Target struct {
+	Name string
+	// Addr 管理端口地址，例如 localhost:6060
+	Addr string
+}
+
+// BaseURL 管理端口的 URL
+func (t Target) BaseURL() string {
+	if strings.HasPrefix(t.Addr, "http://") || strings.HasPrefix(t.Addr, "https://") {
+		return t.Addr
+	}
+	if strings.HasPrefix(t.Addr, ":") {
+		return "http://localhost" + t.Addr
+	}
+	return "http://" + t.Addr
+}
+
+// ParseTargets 解析形如 "cpu=localhost:6060,grpc=:50052,memory" 的列表；
+// 省略名称时用地址生成名称
+func ParseTargets(s string) ([]Target, error) {
+	var targets []Target
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, addr, ok := strings.Cut(item, "=")
+		if !ok {
+			addr = name
+			name = strings.NewReplacer(":", "_", "/", "_").Replace(strings.TrimLeft(addr, ":"))
+		}
+		if name == "" || addr == "" {
+			return nil, fmt.Errorf("invalid target %q, expected name=addr or addr", item)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate target name %q", name)
+		}
+		seen[name] = true
+		targets = append(targets, Target{Name: name, Addr: addr})
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets specified")
+	}
+	return targets, nil
+}
+
+// Collector 定期采集所有 target 的 profile 并清理过期快照
+type Collector struct {
+	Store    *Store
+	Targets  []Target
+	Profiles []capture.Profile
+	// Interval 两轮采集的间隔；CPU 采样时长大于间隔时会连续采集
+	Interval time.Duration
+	// Retention 快照最长保留时间，0 表示不按时间清理
+	Retention time.Duration
+	// MaxSnapshots 每个 target/profile 最多保留的快照数，0 表示不限制
+	MaxSnapshots int
+	// FetchSlack 每个 profile 请求在采样时长之外允许的额外时间
+	FetchSlack time.Duration
+	Client     *http.Client
+}
+
+// Run 为每个 target 启动一个采集循环，直到 ctx 结束
+func (c *Collector) Run(ctx context.Context) error {
+	if c.Client == nil {
+		c.Client = &http.Client{}
+	}
+	var wg sync.WaitGroup
+	for _, t := range c.Targets {
+		wg.Add(1)
+		go func(t Target) {
+			defer wg.Done()
+			c.loop(ctx, t)
+		}(t)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (c *Collector) loop(ctx context.Context, t Target) {
+	log.Printf("[%s] collecting %d profiles from %s every %v", t.Name, len(c.Profiles), t.BaseURL(), c.Interval)
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		c.CollectOnce(ctx, t)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CollectOnce 采集一个 target 的所有 profile，然后执行保留策略
+func (c *Collector) CollectOnce(ctx context.Context, t Target) {
+	for _, p := range c.Profiles {
+		if ctx.Err() != nil {
+			return
+		}
+		snap, err := c.collect(ctx, t, p)
+		if err != nil {
+			log.Printf("[%s] %s: %v", t.Name, p.Name, err)
+			continue
+		}
+		log.Printf("[%s] saved %s (%d bytes)", t.Name, snap.Path, snap.Size)
+
+		removed, err := c.Store.Prune(t.Name, p.Name, c.Retention, c.MaxSnapshots, time.Now())
+		if err != nil {
+			log.Printf("[%s] %s: prune: %v", t.Name, p.Name, err)
+		} else if removed > 0 {
+			log.Printf("[%s] %s: pruned %d old snapshots", t.Name, p.Name, removed)
+		}
+	}
+}
+
+func (c *Collector) collect(ctx context.Context, t Target, p capture.Profile) (Snapshot, error) {
+	// 以采集开始时间作为快照时间；CPU profile 对应 [start, start+duration] 区间
+	start := time.Now()
+	path := c.Store.Path(t.Name, p.Name, start)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return Snapshot{}, err
+	}
+
+	// 先写临时文件再改名，避免 query 读到不完整的 profile
+	tmp := path + ".tmp"
+	res, err := capture.Fetch(ctx, c.Client, t.BaseURL(), p, tmp, c.FetchSlack)
+	if err != nil {
+		os.Remove(tmp)
+		return Snapshot{}, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return Snapshot{}, err
+	}
+	return Snapshot{Target: t.Name, Profile: p.Name, Time: start.UTC(), Path: path, Size: res.Bytes}, nil
+}
@@ -0,0 +1,171 @@
+// Package collector 定时从多个 demo server 的管理端口抓取 profile，
+// 按时间保存在本地目录中，并支持按时间戳取出任意两份快照做对比。
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// timeLayout 快照文件名中的时间格式，按字典序排序即按时间排序
+const timeLayout = "20060102T150405.000Z"
+
+// Snapshot 一份保存在本地的 profile
+type Snapshot struct {
+	Target  string    `json:"target"`
+	Profile string    `json:"profile"`
+	Time    time.Time `json:"time"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+}
+
+// Store 快照目录，布局为 <Dir>/<target>/<profile>/<UTC 时间>.pb.gz
+type Store struct {
+	Dir string
+}
+
+// Path 返回某个时间点的快照路径
+func (s *Store) Path(target, profile string, t time.Time) string {
+	return filepath.Join(s.Dir, target, profile, t.UTC().Format(timeLayout)+".pb.gz")
+}
+
+// Targets 返回目录中已有的 target
+func (s *Store) Targets() ([]string, error) {
+	return listDirs(s.Dir)
+}
+
+// Profiles 返回某个 target 已有的 profile 类型
+func (s *Store) Profiles(target string) ([]string, error) {
+	return listDirs(filepath.Join(s.Dir, target))
+}
+
+// List 按时间顺序返回某个 target/profile 的所有快照
+func (s *Store) List(target, profile string) ([]Snapshot, error) {
+	dir := filepath.Join(s.Dir, target, profile)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var snaps []Snapshot
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".pb.gz")
+		if !ok || e.IsDir() {
+			continue
+		}
+		t, err := time.Parse(timeLayout, name)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		snaps = append(snaps, Snapshot{
+			Target:  target,
+			Profile: profile,
+			Time:    t,
+			Path:    filepath.Join(dir, e.Name()),
+			Size:    info.Size(),
+		})
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].Time.Before(snaps[j].Time) })
+	return snaps, nil
+}
+
+// Nearest 返回时间上离 t 最近的快照
+func (s *Store) Nearest(target, profile string, t time.Time) (Snapshot, error) {
+	snaps, err := s.List(target, profile)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if len(snaps) == 0 {
+		return Snapshot{}, fmt.Errorf("no %s snapshots for target %s in %s", profile, target, s.Dir)
+	}
+	best := snaps[0]
+	for _, snap := range snaps[1:] {
+		if absDuration(snap.Time.Sub(t)) < absDuration(best.Time.Sub(t)) {
+			best = snap
+		}
+	}
+	return best, nil
+}
+
+// Prune 删除超过 maxAge 的快照，并且只保留最新的 maxCount 份；0 表示不限制
+func (s *Store) Prune(target, profile string, maxAge time.Duration, maxCount int, now time.Time) (int, error) {
+	snaps, err := s.List(target, profile)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for i, snap := range snaps {
+		tooOld := maxAge > 0 && now.Sub(snap.Time) > maxAge
+		tooMany := maxCount > 0 && len(snaps)-i > maxCount
+		if !tooOld && !tooMany {
+			continue
+		}
+		if err := os.Remove(snap.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func listDirs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// ParseTime 解析查询用的时间：RFC3339 时间、"latest"、"earliest"，
+// 或者相对当前时间的时长，例如 "-10m" 表示 10 分钟前
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	switch s {
+	case "latest", "now", "":
+		return now, nil
+	case "earliest", "first":
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(d), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "15:04:05"} {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err != nil {
+			continue
+		}
+		if layout == "15:04:05" {
+			y, m, d := now.Date()
+			t = time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: use RFC3339, HH:MM:SS, a relative duration like -10m, latest or earliest", s)
+}
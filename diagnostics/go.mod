@@ -0,0 +1,5 @@
+module github.com/gangcheng1030/ai_production_troubleshooting/diagnostics
+
+go 1.23.9
+
+require github.com/google/pprof v0.0.0-20241210010833-40e02aabc2ad
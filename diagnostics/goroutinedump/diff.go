@@ -0,0 +1,235 @@
+package goroutinedump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// GroupDiff 同一个调用栈在两次 dump 中的数量对比
+type GroupDiff struct {
+	Top       string  `json:"top"`
+	Origin    string  `json:"origin"`
+	CreatedBy string  `json:"created_by,omitempty"`
+	States    string  `json:"states,omitempty"`
+	Base      int     `json:"base"`
+	Target    int     `json:"target"`
+	Delta     int     `json:"delta"`
+	Growth    float64 `json:"growth,omitempty"` // Target/Base，Base 为 0 时不计算
+	Frames    []Frame `json:"frames"`
+}
+
+// OriginDiff 按归因函数（created by / 入口函数）汇总的数量对比
+type OriginDiff struct {
+	Origin string  `json:"origin"`
+	Groups int     `json:"groups"`
+	Base   int     `json:"base"`
+	Target int     `json:"target"`
+	Delta  int     `json:"delta"`
+	Growth float64 `json:"growth,omitempty"`
+}
+
+// Report 两次 goroutine dump 的对比结果
+type Report struct {
+	BaseLabel   string       `json:"base_label"`
+	TargetLabel string       `json:"target_label"`
+	BaseTotal   int          `json:"base_total"`
+	TargetTotal int          `json:"target_total"`
+	Groups      []GroupDiff  `json:"groups"`
+	Origins     []OriginDiff `json:"origins"`
+}
+
+// Options 控制对比结果的筛选
+type Options struct {
+	// MinDelta 数量增长小于该值的组会被忽略
+	MinDelta int
+	// Top 最多保留的组数，0 表示不限制
+	Top int
+}
+
+// Diff 对比两次 dump，按数量增长从大到小排列调用栈分组，并按 created by 汇总。
+// 分组只按函数名序列匹配，因此 debug=1 和 debug=2 的 dump 也可以互相对比。
+func Diff(base, target *Dump, baseLabel, targetLabel string, opts Options) *Report {
+	r := &Report{
+		BaseLabel:   baseLabel,
+		TargetLabel: targetLabel,
+		BaseTotal:   base.Total,
+		TargetTotal: target.Total,
+	}
+
+	type pair struct {
+		base, target *Group
+		bn, tn       int
+	}
+	pairs := make(map[string]*pair)
+	get := func(g *Group) *pair {
+		k := stackKey(g)
+		p := pairs[k]
+		if p == nil {
+			p = &pair{}
+			pairs[k] = p
+		}
+		return p
+	}
+	for _, g := range base.Groups {
+		p := get(g)
+		p.bn += g.Count
+		if p.base == nil || g.Count > p.base.Count {
+			p.base = g
+		}
+	}
+	for _, g := range target.Groups {
+		p := get(g)
+		p.tn += g.Count
+		if p.target == nil || g.Count > p.target.Count {
+			p.target = g
+		}
+	}
+
+	origins := make(map[string]*OriginDiff)
+	for _, p := range pairs {
+		g := p.target
+		if g == nil {
+			g = p.base
+		}
+		createdBy := g.CreatedBy
+		if createdBy == "" && p.base != nil {
+			createdBy = p.base.CreatedBy
+		}
+		d := GroupDiff{
+			Top:       g.Top(),
+			Origin:    g.Origin(),
+			CreatedBy: createdBy,
+			States:    g.StateSummary(),
+			Base:      p.bn,
+			Target:    p.tn,
+			Delta:     p.tn - p.bn,
+			Growth:    growth(p.bn, p.tn),
+			Frames:    g.Frames,
+		}
+		if createdBy != "" {
+			d.Origin = createdBy
+		}
+
+		o := origins[d.Origin]
+		if o == nil {
+			o = &OriginDiff{Origin: d.Origin}
+			origins[d.Origin] = o
+		}
+		o.Groups++
+		o.Base += d.Base
+		o.Target += d.Target
+
+		if d.Delta < opts.MinDelta {
+			continue
+		}
+		r.Groups = append(r.Groups, d)
+	}
+
+	sort.Slice(r.Groups, func(i, j int) bool {
+		if r.Groups[i].Delta != r.Groups[j].Delta {
+			return r.Groups[i].Delta > r.Groups[j].Delta
+		}
+		return r.Groups[i].Top < r.Groups[j].Top
+	})
+	if opts.Top > 0 && len(r.Groups) > opts.Top {
+		r.Groups = r.Groups[:opts.Top]
+	}
+
+	for _, o := range origins {
+		o.Delta = o.Target - o.Base
+		o.Growth = growth(o.Base, o.Target)
+		if o.Delta < opts.MinDelta {
+			continue
+		}
+		r.Origins = append(r.Origins, *o)
+	}
+	sort.Slice(r.Origins, func(i, j int) bool {
+		if r.Origins[i].Delta != r.Origins[j].Delta {
+			return r.Origins[i].Delta > r.Origins[j].Delta
+		}
+		return r.Origins[i].Origin < r.Origins[j].Origin
+	})
+	return r
+}
+
+// Write 按 format（text 或 json）输出报告
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "text", "":
+		return r.WriteText(w)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	default:
+		return fmt.Errorf("unknown format %q, expected text or json", format)
+	}
+}
+
+// WriteText 以表格输出报告，并附上增长最多的调用栈
+func (r *Report) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "Total goroutines: %s=%d, %s=%d (%+d, %s)\n\n",
+		r.BaseLabel, r.BaseTotal, r.TargetLabel, r.TargetTotal, r.TargetTotal-r.BaseTotal, formatGrowth(r.BaseTotal, r.TargetTotal))
+
+	fmt.Fprintln(w, "Growth by stack group:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "  %s\t%s\tdelta\tgrowth\ttop function\tcreated by / entry\tstates\n", r.BaseLabel, r.TargetLabel)
+	for _, g := range r.Groups {
+		fmt.Fprintf(tw, "  %d\t%d\t%+d\t%s\t%s\t%s\t%s\n", g.Base, g.Target, g.Delta, formatGrowth(g.Base, g.Target), g.Top, g.Origin, g.States)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Growth by creator:")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "  %s\t%s\tdelta\tgrowth\tgroups\tcreated by / entry\n", r.BaseLabel, r.TargetLabel)
+	for _, o := range r.Origins {
+		fmt.Fprintf(tw, "  %d\t%d\t%+d\t%s\t%d\t%s\n", o.Base, o.Target, o.Delta, formatGrowth(o.Base, o.Target), o.Groups, o.Origin)
+	}
+	tw.Flush()
+
+	for i, g := range r.Groups {
+		if i >= 3 {
+			break
+		}
+		fmt.Fprintf(w, "\n#%d %+d goroutines (%d -> %d):\n", i+1, g.Delta, g.Base, g.Target)
+		for _, f := range g.Frames {
+			fmt.Fprintf(w, "    %s\n", f.Func)
+		}
+		if g.CreatedBy != "" {
+			fmt.Fprintf(w, "    created by %s\n", g.CreatedBy)
+		}
+	}
+	return nil
+}
+
+// stackKey 只由函数名组成的分组键，用于跨格式匹配
+func stackKey(g *Group) string {
+	names := make([]string, len(g.Frames))
+	for i, f := range g.Frames {
+		names[i] = f.Func
+	}
+	return strings.Join(names, "\n")
+}
+
+func growth(base, target int) float64 {
+	if base == 0 {
+		return 0
+	}
+	return float64(target) / float64(base)
+}
+
+func formatGrowth(base, target int) string {
+	switch {
+	case base == 0 && target > 0:
+		return "new"
+	case base == 0:
+		return "-"
+	default:
+		return fmt.Sprintf("%.1f×", growth(base, target))
+	}
+}
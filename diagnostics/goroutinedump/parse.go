@@ -0,0 +1,349 @@
+// Package goroutinedump 解析 /debug/pprof/goroutine 的文本输出，
+// 支持 debug=1（按调用栈分组计数）和 debug=2（每个 goroutine 单独输出，带等待原因和时长）两种格式，
+// 并把 goroutine 按调用栈分组，供 Diff 对比两次 dump。
+package goroutinedump
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frame 调用栈中的一帧
+type Frame struct {
+	Func string `json:"func"`
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+}
+
+// Group 调用栈（函数名序列）相同的一组 goroutine
+type Group struct {
+	// Key 分组依据：从栈顶到栈底的函数名，以换行分隔
+	Key    string  `json:"-"`
+	Count  int     `json:"count"`
+	Frames []Frame `json:"frames"`
+	// CreatedBy 创建该 goroutine 的函数（仅 debug=2 有）
+	CreatedBy string `json:"created_by,omitempty"`
+	// States 等待原因（如 "IO wait"、"select"）到数量的映射（仅 debug=2 有）
+	States map[string]int `json:"states,omitempty"`
+	// MaxWait 组内最长的等待时长，runtime 只在等待超过 1 分钟时输出（仅 debug=2 有）
+	MaxWait time.Duration `json:"max_wait_ns,omitempty"`
+}
+
+// Entry 栈底的函数，即 goroutine 的入口函数
+func (g *Group) Entry() string {
+	if len(g.Frames) == 0 {
+		return ""
+	}
+	return g.Frames[len(g.Frames)-1].Func
+}
+
+// Origin 归因用的函数：优先使用 created by，debug=1 没有该信息时退回入口函数
+func (g *Group) Origin() string {
+	if g.CreatedBy != "" {
+		return g.CreatedBy
+	}
+	return g.Entry()
+}
+
+// Top 第一个不属于 runtime 等底层包的函数，通常能说明 goroutine 在做什么
+func (g *Group) Top() string {
+	for _, f := range g.Frames {
+		if !isRuntimeFunc(f.Func) {
+			return f.Func
+		}
+	}
+	if len(g.Frames) > 0 {
+		return g.Frames[0].Func
+	}
+	return ""
+}
+
+// StateSummary 以 "IO wait×500, select×2" 的形式返回等待原因
+func (g *Group) StateSummary() string {
+	type kv struct {
+		state string
+		n     int
+	}
+	var list []kv
+	for s, n := range g.States {
+		list = append(list, kv{s, n})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].n != list[j].n {
+			return list[i].n > list[j].n
+		}
+		return list[i].state < list[j].state
+	})
+	parts := make([]string, len(list))
+	for i, e := range list {
+		parts[i] = fmt.Sprintf("%s×%d", e.state, e.n)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Dump 一次 goroutine dump 的解析结果
+type Dump struct {
+	// Debug 输入格式：1 或 2
+	Debug  int      `json:"debug"`
+	Total  int      `json:"total"`
+	Groups []*Group `json:"groups"`
+}
+
+// ParseFile 解析 goroutine dump 文件，自动识别 debug=1/debug=2 格式
+func ParseFile(path string) (*Dump, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return d, nil
+}
+
+// Parse 解析 goroutine dump，自动识别 debug=1/debug=2 格式
+func Parse(r io.Reader) (*Dump, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var lines []string
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "goroutine profile: total "):
+			return parseDebug1(lines)
+		case strings.HasPrefix(line, "goroutine ") && strings.HasSuffix(line, ":"):
+			return parseDebug2(lines)
+		}
+	}
+	return nil, fmt.Errorf("unrecognized goroutine dump format")
+}
+
+// parseDebug1 解析如下格式：
+//
+//	goroutine profile: total 1508
+//	501 @ 0x43e8ae 0x4373b7 ...
+//	#	0x7d1f2a	google.golang.org/grpc/internal/transport.(*http2Server).HandleStreams+0x8a	/path/http2_server.go:637
+func parseDebug1(lines []string) (*Dump, error) {
+	b := newBuilder(1)
+	var cur *Group
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "goroutine profile: total "):
+			n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "goroutine profile: total ")))
+			if err != nil {
+				return nil, fmt.Errorf("invalid total line %q", line)
+			}
+			b.dump.Total = n
+		case strings.Contains(line, " @ ") && !strings.HasPrefix(line, "#"):
+			b.add(cur)
+			countStr, _, _ := strings.Cut(line, " @ ")
+			n, err := strconv.Atoi(strings.TrimSpace(countStr))
+			if err != nil {
+				return nil, fmt.Errorf("invalid group line %q", line)
+			}
+			cur = &Group{Count: n}
+		case strings.HasPrefix(line, "#") && cur != nil:
+			// 标签行（# labels: {...}）没有地址字段
+			// runtime 用 tabwriter 对齐各列，列之间可能有多个制表符
+			fields := strings.FieldsFunc(strings.TrimPrefix(line, "#"), func(r rune) bool { return r == '\t' })
+			if len(fields) < 2 || !strings.HasPrefix(fields[0], "0x") {
+				continue
+			}
+			fr := Frame{Func: fields[1]}
+			if i := strings.LastIndex(fr.Func, "+0x"); i > 0 {
+				fr.Func = fr.Func[:i]
+			}
+			if len(fields) >= 3 {
+				fr.File, fr.Line = splitFileLine(fields[2])
+			}
+			cur.Frames = append(cur.Frames, fr)
+		}
+	}
+	b.add(cur)
+	return b.finish(), nil
+}
+
+// parseDebug2 解析如下格式：
+//
+//	goroutine 42 [IO wait, 3 minutes]:
+//	internal/poll.runtime_pollWait(0x7f..., 0x72)
+//		/usr/local/go/src/runtime/netpoll.go:351 +0x85
+//	created by google.golang.org/grpc/internal/transport.NewServerTransport in goroutine 40
+//		/path/http2_server.go:336 +0x1a5e
+func parseDebug2(lines []string) (*Dump, error) {
+	b := newBuilder(2)
+	var (
+		cur     *Group
+		state   string
+		wait    time.Duration
+		pending *Frame
+	)
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		cur.States = map[string]int{state: 1}
+		cur.MaxWait = wait
+		b.add(cur)
+		cur = nil
+	}
+
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "goroutine ") && strings.HasSuffix(line, ":"):
+			flush()
+			cur = &Group{Count: 1}
+			state, wait = parseHeader(line)
+			b.dump.Total++
+			pending = nil
+		case cur == nil:
+			continue
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, "\t"):
+			if pending != nil {
+				pending.File, pending.Line = splitFileLine(strings.TrimSpace(line))
+				pending = nil
+			}
+		case strings.HasPrefix(line, "created by "):
+			name := strings.TrimPrefix(line, "created by ")
+			if i := strings.Index(name, " in goroutine "); i > 0 {
+				name = name[:i]
+			}
+			cur.CreatedBy = name
+			pending = nil
+		case strings.HasPrefix(line, "...") && strings.HasSuffix(line, "..."):
+			// "...additional frames elided..."
+			continue
+		default:
+			cur.Frames = append(cur.Frames, Frame{Func: trimArgs(line)})
+			pending = &cur.Frames[len(cur.Frames)-1]
+		}
+	}
+	flush()
+	return b.finish(), nil
+}
+
+// parseHeader 从 "goroutine 42 [IO wait, 3 minutes, locked to thread]:" 中解析等待原因和时长
+func parseHeader(line string) (string, time.Duration) {
+	open, end := strings.Index(line, "["), strings.LastIndex(line, "]")
+	if open < 0 || end < open {
+		return "unknown", 0
+	}
+	parts := strings.Split(line[open+1:end], ", ")
+	state := parts[0]
+	var wait time.Duration
+	for _, p := range parts[1:] {
+		if n, ok := strings.CutSuffix(p, " minutes"); ok {
+			if m, err := strconv.Atoi(n); err == nil {
+				wait = time.Duration(m) * time.Minute
+			}
+		}
+	}
+	return state, wait
+}
+
+// trimArgs 去掉函数调用行末尾的参数列表，例如 "main.main()" -> "main.main"
+func trimArgs(line string) string {
+	line = strings.TrimSpace(line)
+	if strings.HasSuffix(line, ")") {
+		if i := strings.LastIndex(line, "("); i > 0 {
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitFileLine 解析 "/path/file.go:123 +0x1a" 为文件和行号
+func splitFileLine(s string) (string, int) {
+	if i := strings.Index(s, " "); i > 0 {
+		s = s[:i]
+	}
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return s, 0
+	}
+	n, err := strconv.Atoi(s[i+1:])
+	if err != nil {
+		return s, 0
+	}
+	return s[:i], n
+}
+
+// isRuntimeFunc 判断是否为 runtime、同步原语、网络轮询等底层函数
+func isRuntimeFunc(name string) bool {
+	for _, prefix := range []string{"runtime.", "internal/", "sync.", "syscall.", "time.Sleep", "net.", "bufio.", "io."} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type builder struct {
+	dump   *Dump
+	groups map[string]*Group
+}
+
+func newBuilder(debug int) *builder {
+	return &builder{dump: &Dump{Debug: debug}, groups: make(map[string]*Group)}
+}
+
+// add 合并函数名序列相同的组：debug=1 中 PC 不同但函数相同的栈也会合并
+func (b *builder) add(g *Group) {
+	if g == nil {
+		return
+	}
+	names := make([]string, len(g.Frames))
+	for i, f := range g.Frames {
+		names[i] = f.Func
+	}
+	g.Key = strings.Join(names, "\n")
+	if g.CreatedBy != "" {
+		g.Key += "\ncreated by " + g.CreatedBy
+	}
+
+	existing := b.groups[g.Key]
+	if existing == nil {
+		b.groups[g.Key] = g
+		b.dump.Groups = append(b.dump.Groups, g)
+		return
+	}
+	existing.Count += g.Count
+	for s, n := range g.States {
+		if existing.States == nil {
+			existing.States = make(map[string]int)
+		}
+		existing.States[s] += n
+	}
+	if g.MaxWait > existing.MaxWait {
+		existing.MaxWait = g.MaxWait
+	}
+}
+
+func (b *builder) finish() *Dump {
+	if b.dump.Total == 0 {
+		for _, g := range b.dump.Groups {
+			b.dump.Total += g.Count
+		}
+	}
+	sort.SliceStable(b.dump.Groups, func(i, j int) bool {
+		return b.dump.Groups[i].Count > b.dump.Groups[j].Count
+	})
+	return b.dump
+}
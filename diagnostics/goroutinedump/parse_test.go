@@ -0,0 +1,166 @@
+package goroutinedump
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const handleStreams = "google.golang.org/grpc/internal/transport.(*http2Server).HandleStreams"
+
+// findGroup 按 Top() 查找分组
+func findGroup(t *testing.T, d *Dump, top string) *Group {
+	t.Helper()
+	for _, g := range d.Groups {
+		if g.Top() == top {
+			return g
+		}
+	}
+	t.Fatalf("no group with top function %q", top)
+	return nil
+}
+
+// testdata/debug2.txt 是 goroutine_analyze/server 在 bad_client 运行时的 debug=2 dump（节选）
+func TestParseDebug2(t *testing.T) {
+	d, err := ParseFile("testdata/debug2.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Debug != 2 {
+		t.Errorf("Debug = %d, want 2", d.Debug)
+	}
+	if d.Total != 7 {
+		t.Errorf("Total = %d, want 7", d.Total)
+	}
+	// 两个 HandleStreams 的参数和 created by 的 goroutine ID 不同，仍应合并为一组
+	if len(d.Groups) != 6 {
+		t.Fatalf("got %d groups, want 6", len(d.Groups))
+	}
+
+	g := d.Groups[0]
+	if g.Top() != handleStreams {
+		t.Errorf("largest group top = %q, want %q", g.Top(), handleStreams)
+	}
+	if g.Count != 2 {
+		t.Errorf("HandleStreams count = %d, want 2", g.Count)
+	}
+	if g.CreatedBy != "google.golang.org/grpc.(*Server).serveStreams" {
+		t.Errorf("CreatedBy = %q, \" in goroutine N\" should be stripped", g.CreatedBy)
+	}
+	if g.Origin() != g.CreatedBy {
+		t.Errorf("Origin = %q, want created by %q", g.Origin(), g.CreatedBy)
+	}
+	// 一个 goroutine 没有时长（不足 1 分钟），另一个是 [IO wait, 2 minutes]
+	if g.States["IO wait"] != 2 {
+		t.Errorf("States = %v, want IO wait×2", g.States)
+	}
+	if g.MaxWait != 2*time.Minute {
+		t.Errorf("MaxWait = %v, want 2m", g.MaxWait)
+	}
+	top := g.Frames[0]
+	if top.Func != "internal/poll.runtime_pollWait" || top.File != "/usr/local/go/src/runtime/netpoll.go" || top.Line != 351 {
+		t.Errorf("top frame = %+v", top)
+	}
+
+	serve := findGroup(t, d, "google.golang.org/grpc.(*Server).Serve")
+	if serve.MaxWait != 12*time.Minute || serve.States["IO wait"] != 1 {
+		t.Errorf("Serve: MaxWait = %v, States = %v, want 12m and IO wait×1", serve.MaxWait, serve.States)
+	}
+	if serve.CreatedBy != "main.main" {
+		t.Errorf("Serve CreatedBy = %q, want main.main", serve.CreatedBy)
+	}
+
+	// [syscall, 12 minutes, locked to thread]：只有 runtime 帧时 Top 退回第一帧
+	locked := findGroup(t, d, "runtime.goexit")
+	if locked.States["syscall"] != 1 || locked.MaxWait != 12*time.Minute {
+		t.Errorf("locked: States = %v, MaxWait = %v", locked.States, locked.MaxWait)
+	}
+
+	// main.main 没有 created by，归因于入口函数
+	main := findGroup(t, d, "main.main")
+	if main.CreatedBy != "" || main.Origin() != "main.main" {
+		t.Errorf("main: CreatedBy = %q, Origin = %q", main.CreatedBy, main.Origin())
+	}
+
+	// "...additional frames elided..." 不是调用帧
+	running := findGroup(t, d, "runtime/pprof.writeGoroutineStacks")
+	if len(running.Frames) != 1 {
+		t.Errorf("running goroutine has %d frames, want 1: %+v", len(running.Frames), running.Frames)
+	}
+	if running.CreatedBy != "net/http.(*Server).Serve" {
+		t.Errorf("running CreatedBy = %q", running.CreatedBy)
+	}
+}
+
+func TestParseDebug1(t *testing.T) {
+	d, err := ParseFile("testdata/debug1.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Debug != 1 || d.Total != 4 {
+		t.Errorf("Debug = %d, Total = %d, want 1 and 4", d.Debug, d.Total)
+	}
+	// PC 不同但函数相同的两组合并
+	if len(d.Groups) != 2 {
+		t.Fatalf("got %d groups, want 2", len(d.Groups))
+	}
+	g := d.Groups[0]
+	if g.Count != 3 || g.Top() != handleStreams {
+		t.Errorf("largest group: count %d top %q, want 3 %q", g.Count, g.Top(), handleStreams)
+	}
+	// tabwriter 对齐产生的多个制表符不影响文件和行号
+	if f := g.Frames[4]; f.Line != 637 || !strings.HasSuffix(f.File, "/internal/transport/http2_server.go") {
+		t.Errorf("frame = %+v, want http2_server.go:637", f)
+	}
+	// 标签行不是调用帧
+	if m := d.Groups[1]; len(m.Frames) != 1 || m.Frames[0].Func != "main.main" {
+		t.Errorf("main group frames = %+v", m.Frames)
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		line  string
+		state string
+		wait  time.Duration
+	}{
+		{"goroutine 1 [running]:", "running", 0},
+		{"goroutine 42 [IO wait, 3 minutes]:", "IO wait", 3 * time.Minute},
+		{"goroutine 7 [syscall, 12 minutes, locked to thread]:", "syscall", 12 * time.Minute},
+		{"goroutine 9 [chan receive (nil chan), 1 minutes]:", "chan receive (nil chan)", time.Minute},
+		{"goroutine 9:", "unknown", 0},
+	}
+	for _, tt := range tests {
+		state, wait := parseHeader(tt.line)
+		if state != tt.state || wait != tt.wait {
+			t.Errorf("parseHeader(%q) = %q, %v; want %q, %v", tt.line, state, wait, tt.state, tt.wait)
+		}
+	}
+}
+
+func TestParseUnknownFormat(t *testing.T) {
+	if _, err := Parse(strings.NewReader("not a goroutine dump\n")); err == nil {
+		t.Error("expected error for unrecognized input")
+	}
+}
+
+func TestDiffAcrossFormats(t *testing.T) {
+	base, err := ParseFile("testdata/debug1.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := ParseFile("testdata/debug2.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Diff(base, target, "base", "target", Options{MinDelta: 1})
+	// HandleStreams：debug=1 有 3 个，debug=2 有 2 个，不应出现在增长列表中
+	for _, g := range r.Groups {
+		if g.Top == handleStreams {
+			t.Errorf("HandleStreams reported as growth: %+v", g)
+		}
+	}
+	if len(r.Groups) == 0 || r.Groups[0].Base != 0 || r.Groups[0].Delta != 1 {
+		t.Errorf("expected new groups with delta 1, got %+v", r.Groups)
+	}
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// HTTPMetrics 按路由统计的 HTTP 请求指标，net/http 和 fasthttp 的 server 共用
+type HTTPMetrics struct {
+	requests CounterVec
+	duration HistogramVec
+	inFlight GaugeVec
+	received CounterVec
+
+	conns      atomic.Int64
+	connsTotal atomic.Uint64
+}
+
+// NewHTTPMetrics 在 r 中注册 <prefix>_requests_total、<prefix>_request_duration_seconds、
+// <prefix>_requests_in_flight 和 <prefix>_received_bytes_total，prefix 例如 "http_server"
+func NewHTTPMetrics(r *Registry, prefix string) *HTTPMetrics {
+	m := &HTTPMetrics{
+		requests: r.NewCounterVec(prefix+"_requests_total", "Total number of HTTP requests by route and status code.", "route", "code"),
+		duration: r.NewHistogramVec(prefix+"_request_duration_seconds", "HTTP request latency by route.", nil, "route"),
+		inFlight: r.NewGaugeVec(prefix+"_requests_in_flight", "Number of HTTP requests currently being served by route.", "route"),
+		received: r.NewCounterVec(prefix+"_received_bytes_total", "Total request body bytes read by route.", "route"),
+	}
+	r.NewGaugeFunc(prefix+"_open_connections", "Number of currently open client connections.",
+		func() float64 { return float64(m.conns.Load()) })
+	r.NewCounterFunc(prefix+"_connections_total", "Total number of accepted client connections.",
+		func() float64 { return float64(m.connsTotal.Load()) })
+	return m
+}
+
+// Start 记录一个请求开始，返回的函数在请求结束时以状态码调用；fasthttp 的 handler 使用这种方式
+func (m *HTTPMetrics) Start(route string) func(code int) {
+	start := time.Now()
+	inFlight := m.inFlight.With(route)
+	inFlight.Inc()
+	return func(code int) {
+		inFlight.Dec()
+		m.duration.With(route).Observe(time.Since(start).Seconds())
+		m.requests.With(route, strconv.Itoa(code)).Inc()
+	}
+}
+
+// AddReceived 累加某个路由读取的请求体字节数
+func (m *HTTPMetrics) AddReceived(route string, n int64) {
+	if n > 0 {
+		m.received.With(route).Add(float64(n))
+	}
+}
+
+// Wrap 包装 net/http 的 handler，统计请求数、延迟和并发数。
+// 请求体字节数和 fasthttp 一样由 handler 调用 AddReceived 记录：Wrap 不替换 r.Body，
+// 而 http.MaxBytesReader 需要原始的 ResponseWriter 才能在 413 后关闭连接，应当套在 Wrap 外层
+func (m *HTTPMetrics) Wrap(route string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		done := m.Start(route)
+		rw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		defer func() { done(rw.code) }()
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// ConnOpened 记录一个新连接
+func (m *HTTPMetrics) ConnOpened() {
+	m.conns.Add(1)
+	m.connsTotal.Add(1)
+}
+
+// ConnClosed 记录一个连接关闭
+func (m *HTTPMetrics) ConnClosed() {
+	m.conns.Add(-1)
+}
+
+// ConnState 可以直接赋值给 http.Server.ConnState
+func (m *HTTPMetrics) ConnState(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		m.ConnOpened()
+	case http.StateHijacked, http.StateClosed:
+		m.ConnClosed()
+	}
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	code  int
+	wrote bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wrote {
+		w.code, w.wrote = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap 让 http.ResponseController 能找到底层的 ResponseWriter
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
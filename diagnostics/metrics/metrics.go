@@ -0,0 +1,402 @@
+// Package metrics 是一个很小的 Prometheus 文本格式指标库：计数器、仪表盘、直方图和带标签的向量，
+// 由 admin 管理端口的 /metrics 输出。只实现 demo 需要的部分，不引入 client_golang 依赖。
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Default 默认的指标注册表，admin 的 /metrics 输出它的内容
+var Default = NewRegistry()
+
+// DefBuckets 默认的延迟直方图桶（秒）
+var DefBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+// Registry 指标注册表，按注册顺序输出
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+	names    map[string]bool
+}
+
+// family 同名指标的集合，负责输出 HELP、TYPE 和所有样本
+type family interface {
+	name() string
+	write(w io.Writer)
+}
+
+// NewRegistry 创建空的注册表
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[f.name()] {
+		panic("metrics: duplicate metric " + f.name())
+	}
+	r.names[f.name()] = true
+	r.families = append(r.families, f)
+}
+
+// WriteText 以 Prometheus 文本格式输出所有指标
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := append([]family(nil), r.families...)
+	r.mu.Unlock()
+
+	bw := &errWriter{w: w}
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.err
+}
+
+// ServeHTTP 实现 /metrics 端点
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteText(w)
+}
+
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := e.w.Write(p)
+	e.err = err
+	return n, err
+}
+
+// desc 指标的名称、说明、类型和标签名
+type desc struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels []string
+}
+
+func (d *desc) name() string { return d.Name }
+
+func (d *desc) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.Name, escapeHelp(d.Help), d.Name, d.Type)
+}
+
+// labelPairs 生成 {a="x",b="y"} 形式的标签，extra 追加在最后（用于直方图的 le）
+func (d *desc) labelPairs(values []string, extra ...string) string {
+	if len(d.Labels) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range d.Labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		writeLabel(&b, l, values[i])
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		writeLabel(&b, extra[i], extra[i+1])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// writeLabel 写入 name="value"。文本格式的标签值只转义反斜杠、双引号和换行，
+// 不能用 %q：它会把非 ASCII 和控制字符转义成 Prometheus 不认识的 \u、\x 序列
+func writeLabel(b *strings.Builder, name, value string) {
+	b.WriteString(name)
+	b.WriteString(`="`)
+	labelEscaper.WriteString(b, value)
+	b.WriteByte('"')
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// value 以原子方式保存的 float64
+type value struct {
+	bits atomic.Uint64
+}
+
+func (v *value) Add(delta float64) {
+	for {
+		old := v.bits.Load()
+		if v.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+func (v *value) Set(x float64) { v.bits.Store(math.Float64bits(x)) }
+func (v *value) Get() float64  { return math.Float64frombits(v.bits.Load()) }
+
+// Counter 只增不减的计数器
+type Counter struct{ v value }
+
+// Inc 加 1
+func (c *Counter) Inc() { c.v.Add(1) }
+
+// Add 增加 delta，delta 必须非负
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.v.Add(delta)
+}
+
+// Value 当前值
+func (c *Counter) Value() float64 { return c.v.Get() }
+
+// Gauge 可增可减的值
+type Gauge struct{ v value }
+
+// Set 设置当前值
+func (g *Gauge) Set(x float64) { g.v.Set(x) }
+
+// Add 增加 delta，可以为负数
+func (g *Gauge) Add(delta float64) { g.v.Add(delta) }
+
+// Inc 加 1
+func (g *Gauge) Inc() { g.v.Add(1) }
+
+// Dec 减 1
+func (g *Gauge) Dec() { g.v.Add(-1) }
+
+// Value 当前值
+func (g *Gauge) Value() float64 { return g.v.Get() }
+
+// Histogram 累积直方图。超过最大上界的观测记在 overflow 中，
+// 输出时 +Inf 和 _count 都由桶的累加和得到，并发 Observe 时也不会小于最后一个有限桶
+type Histogram struct {
+	upper    []float64
+	counts   []atomic.Uint64
+	overflow atomic.Uint64
+	sum      value
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{upper: buckets, counts: make([]atomic.Uint64, len(buckets))}
+}
+
+// Observe 记录一个观测值
+func (h *Histogram) Observe(x float64) {
+	i := sort.SearchFloat64s(h.upper, x)
+	if i < len(h.counts) {
+		h.counts[i].Add(1)
+	} else {
+		h.overflow.Add(1)
+	}
+	h.sum.Add(x)
+}
+
+// vec 按标签值保存子指标
+type vec[T any] struct {
+	desc
+	newChild func() *T
+	mu       sync.Mutex
+	children map[string]*T
+	values   map[string][]string
+}
+
+func newVec[T any](d desc, newChild func() *T) *vec[T] {
+	return &vec[T]{desc: d, newChild: newChild, children: make(map[string]*T), values: make(map[string][]string)}
+}
+
+// With 返回标签值对应的子指标，不存在时创建
+func (v *vec[T]) With(labelValues ...string) *T {
+	if len(labelValues) != len(v.Labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.Name, len(v.Labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.children[key]
+	if !ok {
+		c = v.newChild()
+		v.children[key] = c
+		v.values[key] = append([]string(nil), labelValues...)
+	}
+	return c
+}
+
+// each 按标签值排序遍历子指标
+func (v *vec[T]) each(fn func(values []string, child *T)) {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.children))
+	for k := range v.children {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	type entry struct {
+		values []string
+		child  *T
+	}
+	entries := make([]entry, len(keys))
+	for i, k := range keys {
+		entries[i] = entry{v.values[k], v.children[k]}
+	}
+	v.mu.Unlock()
+	for _, e := range entries {
+		fn(e.values, e.child)
+	}
+}
+
+// CounterVec 带标签的计数器
+type CounterVec struct{ *vec[Counter] }
+
+func (v CounterVec) write(w io.Writer) {
+	v.header(w)
+	v.each(func(values []string, c *Counter) {
+		fmt.Fprintf(w, "%s%s %s\n", v.Name, v.labelPairs(values), formatFloat(c.Value()))
+	})
+}
+
+// GaugeVec 带标签的仪表盘
+type GaugeVec struct{ *vec[Gauge] }
+
+func (v GaugeVec) write(w io.Writer) {
+	v.header(w)
+	v.each(func(values []string, g *Gauge) {
+		fmt.Fprintf(w, "%s%s %s\n", v.Name, v.labelPairs(values), formatFloat(g.Value()))
+	})
+}
+
+// HistogramVec 带标签的直方图
+type HistogramVec struct{ *vec[Histogram] }
+
+func (v HistogramVec) write(w io.Writer) {
+	v.header(w)
+	v.each(func(values []string, h *Histogram) {
+		var cum uint64
+		for i, upper := range h.upper {
+			cum += h.counts[i].Load()
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.Name, v.labelPairs(values, "le", formatFloat(upper)), cum)
+		}
+		cum += h.overflow.Load()
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.Name, v.labelPairs(values, "le", "+Inf"), cum)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.Name, v.labelPairs(values), formatFloat(h.sum.Get()))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.Name, v.labelPairs(values), cum)
+	})
+}
+
+// funcMetric 在输出时调用 fn 取值的指标
+type funcMetric struct {
+	desc
+	fn func() float64
+}
+
+func (f *funcMetric) write(w io.Writer) {
+	f.header(w)
+	fmt.Fprintf(w, "%s %s\n", f.Name, formatFloat(f.fn()))
+}
+
+// NewCounterVec 注册带标签的计数器
+func (r *Registry) NewCounterVec(name, help string, labels ...string) CounterVec {
+	v := CounterVec{newVec(desc{name, help, "counter", labels}, func() *Counter { return &Counter{} })}
+	r.register(v)
+	return v
+}
+
+// NewCounter 注册不带标签的计数器
+func (r *Registry) NewCounter(name, help string) *Counter {
+	return r.NewCounterVec(name, help).With()
+}
+
+// NewGaugeVec 注册带标签的仪表盘
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) GaugeVec {
+	v := GaugeVec{newVec(desc{name, help, "gauge", labels}, func() *Gauge { return &Gauge{} })}
+	r.register(v)
+	return v
+}
+
+// NewGauge 注册不带标签的仪表盘
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	return r.NewGaugeVec(name, help).With()
+}
+
+// NewHistogramVec 注册带标签的直方图，buckets 为升序的上界，nil 时使用 DefBuckets
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	v := HistogramVec{newVec(desc{name, help, "histogram", labels}, func() *Histogram { return newHistogram(buckets) })}
+	r.register(v)
+	return v
+}
+
+// NewGaugeFunc 注册在输出时取值的仪表盘
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&funcMetric{desc{name, help, "gauge", nil}, fn})
+}
+
+// NewCounterFunc 注册在输出时取值的计数器，fn 必须单调不减
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(&funcMetric{desc{name, help, "counter", nil}, fn})
+}
+
+// histogramFunc 在输出时由 fn 给出各个桶计数的直方图
+type histogramFunc struct {
+	desc
+	upper []float64
+	fn    func() (counts []uint64, sum float64)
+}
+
+func (h *histogramFunc) write(w io.Writer) {
+	h.header(w)
+	counts, sum := h.fn()
+	var cum uint64
+	for i, upper := range h.upper {
+		if i < len(counts) {
+			cum += counts[i]
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.Name, h.labelPairs(nil, "le", formatFloat(upper)), cum)
+	}
+	// counts 比桶多出的一项是超过最大上界的数量
+	if len(counts) > len(h.upper) {
+		cum += counts[len(h.upper)]
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", h.Name, h.labelPairs(nil, "le", "+Inf"), cum)
+	fmt.Fprintf(w, "%s_sum %s\n", h.Name, formatFloat(sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.Name, cum)
+}
+
+// NewHistogramFunc 注册在输出时取值的直方图，用于描述某一时刻的分布（例如池中缓冲区的容量）。
+// fn 返回每个桶（非累积）的计数，可以多一项表示超过最大上界的数量，以及所有值的和
+func (r *Registry) NewHistogramFunc(name, help string, buckets []float64, fn func() (counts []uint64, sum float64)) {
+	r.register(&histogramFunc{desc{name, help, "histogram", nil}, buckets, fn})
+}
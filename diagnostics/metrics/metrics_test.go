@@ -0,0 +1,160 @@
+package metrics
+
+import (
+	"flag"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/*.golden with the current output")
+
+// checkGolden 对比 got 与 testdata/<name>.golden；-update 时改为写入
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := "testdata/" + name + ".golden"
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("output differs from %s:\n--- got\n%s--- want\n%s", path, got, want)
+	}
+}
+
+func writeText(t *testing.T, r *Registry) string {
+	t.Helper()
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+
+	c := r.NewCounter("uploads_total", "Total uploads.\nSecond line with a \\ backslash.")
+	c.Inc()
+	c.Add(2.5)
+
+	g := r.NewGauge("inflight_bytes", "Bytes currently being uploaded.")
+	g.Set(1024)
+	g.Dec()
+
+	h := r.NewHistogramVec("request_seconds", "Request latency.", []float64{0.1, 1}, "route")
+	h.With("/upload").Observe(0.05)
+	h.With("/upload").Observe(0.5)
+	h.With("/upload").Observe(3)
+	h.With("/gc").Observe(1)
+
+	v := r.NewCounterVec("requests_total", "Requests by route and code.", "route", "code")
+	v.With("/upload", "200").Add(3)
+	v.With("/exit", "200").Inc()
+
+	gv := r.NewGaugeVec("pool_idle", "Idle buffers by pool.", "pool")
+	gv.With("body").Set(4)
+
+	r.NewGaugeFunc("goroutines", "Number of goroutines.", func() float64 { return 7 })
+	r.NewHistogramFunc("buffer_cap_bytes", "Capacity of pooled buffers.", []float64{1024, 4096},
+		func() ([]uint64, float64) { return []uint64{2, 0, 1}, 9000 })
+
+	checkGolden(t, "registry", writeText(t, r))
+}
+
+// 标签值只转义 \、" 和换行；非 ASCII 字符和其他控制字符原样输出
+func TestLabelEscaping(t *testing.T) {
+	r := NewRegistry()
+	v := r.NewCounterVec("paths_total", "Paths.", "path")
+	v.With(`C:\tmp\"x"`).Inc()
+	v.With("line1\nline2").Inc()
+	v.With("上传/文件\ttab").Inc()
+
+	checkGolden(t, "labels", writeText(t, r))
+}
+
+func TestDuplicateMetricPanics(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("x_total", "x")
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a duplicate metric should panic")
+		}
+	}()
+	r.NewGauge("x_total", "x")
+}
+
+func TestWrongLabelCountPanics(t *testing.T) {
+	r := NewRegistry()
+	v := r.NewCounterVec("y_total", "y", "a", "b")
+	defer func() {
+		if recover() == nil {
+			t.Error("With with the wrong number of label values should panic")
+		}
+	}()
+	v.With("only-one")
+}
+
+// 并发 Observe 时输出的桶必须单调不减，且 +Inf 与 _count 相等
+func TestHistogramConsistentUnderObserve(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 2}, "route").With("/upload")
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for x := 0.5; ; x += 1 {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				h.Observe(math.Mod(x, 4))
+			}
+		}()
+	}
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	for i := 0; i < 1000; i++ {
+		var last, inf, count uint64
+		for _, line := range strings.Split(writeText(t, r), "\n") {
+			name, val, ok := strings.Cut(line, " ")
+			if !ok || strings.HasPrefix(line, "#") {
+				continue
+			}
+			n, err := strconv.ParseUint(val, 10, 64)
+			if err != nil {
+				continue
+			}
+			switch {
+			case strings.Contains(name, `le="+Inf"`):
+				inf = n
+			case strings.HasPrefix(name, "latency_seconds_bucket"):
+				if n < last {
+					t.Fatalf("bucket %s = %d, smaller than the previous bucket %d", name, n, last)
+				}
+				last = n
+			case strings.HasPrefix(name, "latency_seconds_count"):
+				count = n
+			}
+		}
+		if inf < last || inf != count {
+			t.Fatalf("+Inf = %d, last bucket = %d, _count = %d", inf, last, count)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runtimeMetric 一个由 runtime/metrics 指标换算出的 Prometheus 指标
+type runtimeMetric struct {
+	name, help, typ string
+	// sources 相加得到最终值的 runtime/metrics 指标
+	sources []string
+}
+
+var runtimeMetrics = []runtimeMetric{
+	{"go_goroutines", "Number of live goroutines.", "gauge", []string{"/sched/goroutines:goroutines"}},
+	{"go_gomaxprocs", "Current GOMAXPROCS setting.", "gauge", []string{"/sched/gomaxprocs:threads"}},
+	{"go_gc_cycles_total", "Number of completed GC cycles.", "counter", []string{"/gc/cycles/total:gc-cycles"}},
+	{"go_gc_heap_goal_bytes", "Heap size target for the end of the GC cycle.", "gauge", []string{"/gc/heap/goal:bytes"}},
+	{"go_gc_heap_live_bytes", "Heap memory occupied by live objects marked by the previous GC.", "gauge", []string{"/gc/heap/live:bytes"}},
+	{"go_gc_heap_objects", "Number of objects, live or unswept, occupying heap memory.", "gauge", []string{"/gc/heap/objects:objects"}},
+	{"go_gc_heap_allocs_bytes_total", "Cumulative bytes allocated to the heap.", "counter", []string{"/gc/heap/allocs:bytes"}},
+	{"go_gc_memory_limit_bytes", "Go runtime memory limit (GOMEMLIMIT / debug.SetMemoryLimit).", "gauge", []string{"/gc/gomemlimit:bytes"}},
+	{"go_memory_heap_objects_bytes", "Memory occupied by live and not yet freed heap objects.", "gauge", []string{"/memory/classes/heap/objects:bytes"}},
+	{"go_memory_heap_unused_bytes", "Heap memory reserved for objects but not currently used (fragmentation).", "gauge", []string{"/memory/classes/heap/unused:bytes"}},
+	{"go_memory_heap_free_bytes", "Free heap memory not yet returned to the OS.", "gauge", []string{"/memory/classes/heap/free:bytes"}},
+	{"go_memory_heap_released_bytes", "Free heap memory returned to the OS.", "gauge", []string{"/memory/classes/heap/released:bytes"}},
+	{"go_memory_stacks_bytes", "Memory used by goroutine and OS thread stacks.", "gauge", []string{"/memory/classes/heap/stacks:bytes", "/memory/classes/os-stacks:bytes"}},
+	{"go_memory_total_bytes", "All memory mapped by the Go runtime.", "gauge", []string{"/memory/classes/total:bytes"}},
+	{"go_cpu_gc_seconds_total", "Estimated CPU time spent in the garbage collector.", "counter", []string{"/cpu/classes/gc/total:cpu-seconds"}},
+	{"go_cpu_total_seconds_total", "Estimated total CPU time available to the Go runtime.", "counter", []string{"/cpu/classes/total:cpu-seconds"}},
+}
+
+// runtimeCollector 每次输出时读取一次 runtime/metrics 和 /proc/self，生成 Go 运行时与进程指标
+type runtimeCollector struct {
+	samples []metrics.Sample
+	index   map[string]int
+	start   time.Time
+}
+
+// RegisterRuntime 在 r 中注册 Go 运行时和进程指标（go_*、process_*）
+func RegisterRuntime(r *Registry, start time.Time) {
+	supported := make(map[string]bool)
+	for _, d := range metrics.All() {
+		supported[d.Name] = true
+	}
+	c := &runtimeCollector{index: make(map[string]int), start: start}
+	for _, m := range runtimeMetrics {
+		for _, src := range m.sources {
+			if _, ok := c.index[src]; ok || !supported[src] {
+				continue
+			}
+			c.index[src] = len(c.samples)
+			c.samples = append(c.samples, metrics.Sample{Name: src})
+		}
+	}
+	r.register(c)
+}
+
+func (c *runtimeCollector) name() string { return "go_" }
+
+func (c *runtimeCollector) write(w io.Writer) {
+	// 输出可能并发发生，每次使用独立的 Sample 切片
+	samples := append([]metrics.Sample(nil), c.samples...)
+	metrics.Read(samples)
+
+	for _, m := range runtimeMetrics {
+		var v float64
+		ok := false
+		for _, src := range m.sources {
+			i, found := c.index[src]
+			if !found {
+				continue
+			}
+			switch samples[i].Value.Kind() {
+			case metrics.KindUint64:
+				v += float64(samples[i].Value.Uint64())
+				ok = true
+			case metrics.KindFloat64:
+				v += samples[i].Value.Float64()
+				ok = true
+			}
+		}
+		if !ok {
+			continue
+		}
+		writeSingle(w, m.name, m.help, m.typ, v)
+	}
+
+	writeSingle(w, "go_threads", "Number of OS threads created.", "gauge", float64(threadCount()))
+	writeSingle(w, "go_info", "Go version, exported as a label.", "gauge", 1, "version", runtime.Version())
+	if rss, err := residentMemory(); err == nil {
+		writeSingle(w, "process_resident_memory_bytes", "Resident memory size in bytes.", "gauge", float64(rss))
+	}
+	writeSingle(w, "process_start_time_seconds", "Start time of the process since unix epoch in seconds.", "gauge",
+		float64(c.start.UnixNano())/1e9)
+}
+
+func writeSingle(w io.Writer, name, help, typ string, v float64, labels ...string) {
+	d := desc{Name: name, Help: help, Type: typ}
+	d.header(w)
+	fmt.Fprintf(w, "%s%s %s\n", name, d.labelPairs(nil, labels...), formatFloat(v))
+}
+
+// threadCount 进程当前的线程数，读取 /proc/self/status 失败时返回 0
+func threadCount() int {
+	data, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, "Threads:"); ok {
+			n, _ := strconv.Atoi(strings.TrimSpace(v))
+			return n
+		}
+	}
+	return 0
+}
+
+// residentMemory 读取 /proc/self/statm 的常驻页数，只支持 Linux
+func residentMemory() (uint64, error) {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("unexpected /proc/self/statm: %q", data)
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return pages * uint64(os.Getpagesize()), nil
+}
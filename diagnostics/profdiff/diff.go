@@ -0,0 +1,126 @@
+package profdiff
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Side 报告中一侧 profile 的概要信息
+type Side struct {
+	Label      string        `json:"label"`
+	Path       string        `json:"path"`
+	SampleType string        `json:"sample_type"`
+	Unit       string        `json:"unit"`
+	Total      int64         `json:"total"`
+	Duration   time.Duration `json:"duration_ns"`
+	// TotalRate 每秒的总量，CPU profile 即平均占用核数
+	TotalRate float64 `json:"total_rate,omitempty"`
+}
+
+// Row 一个函数在两个 profile 中的对比
+type Row struct {
+	Func string `json:"func"`
+
+	BaseFlat   int64 `json:"base_flat"`
+	TargetFlat int64 `json:"target_flat"`
+	BaseCum    int64 `json:"base_cum"`
+	TargetCum  int64 `json:"target_cum"`
+
+	// *Share 占该 profile 总量的比例（0~1）
+	BaseFlatShare   float64 `json:"base_flat_share"`
+	TargetFlatShare float64 `json:"target_flat_share"`
+	BaseCumShare    float64 `json:"base_cum_share"`
+	TargetCumShare  float64 `json:"target_cum_share"`
+
+	// *Rate 按采样时长归一化后每秒的量，用于比较采样时长不同的 profile
+	BaseFlatRate   float64 `json:"base_flat_rate,omitempty"`
+	TargetFlatRate float64 `json:"target_flat_rate,omitempty"`
+	BaseCumRate    float64 `json:"base_cum_rate,omitempty"`
+	TargetCumRate  float64 `json:"target_cum_rate,omitempty"`
+}
+
+// DeltaFlatShare target 与 base 的 flat 占比之差
+func (r Row) DeltaFlatShare() float64 { return r.TargetFlatShare - r.BaseFlatShare }
+
+// DeltaCumShare target 与 base 的 cum 占比之差
+func (r Row) DeltaCumShare() float64 { return r.TargetCumShare - r.BaseCumShare }
+
+// score 排序依据：flat 与 cum 占比变化的较大者
+func (r Row) score() float64 {
+	return math.Max(math.Abs(r.DeltaFlatShare()), math.Abs(r.DeltaCumShare()))
+}
+
+// Report 两个 profile 的对比结果
+type Report struct {
+	Base   Side  `json:"base"`
+	Target Side  `json:"target"`
+	Rows   []Row `json:"rows"`
+}
+
+// Options 控制对比结果的筛选
+type Options struct {
+	// MinDelta flat 和 cum 占比变化都小于该值的函数会被忽略（0~1）
+	MinDelta float64
+	// Top 最多保留的行数，0 表示不限制
+	Top int
+}
+
+// Diff 对比 base 与 target，按 flat/cum 占比变化从大到小排序
+func Diff(base, target *Summary, baseLabel, targetLabel string, opts Options) *Report {
+	r := &Report{
+		Base:   side(base, baseLabel),
+		Target: side(target, targetLabel),
+	}
+
+	names := make(map[string]bool, len(base.Funcs)+len(target.Funcs))
+	for name := range base.Funcs {
+		names[name] = true
+	}
+	for name := range target.Funcs {
+		names[name] = true
+	}
+
+	for name := range names {
+		row := Row{Func: name}
+		if fs := base.Funcs[name]; fs != nil {
+			row.BaseFlat, row.BaseCum = fs.Flat, fs.Cum
+		}
+		if fs := target.Funcs[name]; fs != nil {
+			row.TargetFlat, row.TargetCum = fs.Flat, fs.Cum
+		}
+		row.BaseFlatShare, row.BaseCumShare = base.Share(row.BaseFlat), base.Share(row.BaseCum)
+		row.TargetFlatShare, row.TargetCumShare = target.Share(row.TargetFlat), target.Share(row.TargetCum)
+		row.BaseFlatRate, row.BaseCumRate = base.Rate(row.BaseFlat), base.Rate(row.BaseCum)
+		row.TargetFlatRate, row.TargetCumRate = target.Rate(row.TargetFlat), target.Rate(row.TargetCum)
+
+		if row.score() < opts.MinDelta {
+			continue
+		}
+		r.Rows = append(r.Rows, row)
+	}
+
+	sort.Slice(r.Rows, func(i, j int) bool {
+		si, sj := r.Rows[i].score(), r.Rows[j].score()
+		if si != sj {
+			return si > sj
+		}
+		return r.Rows[i].Func < r.Rows[j].Func
+	})
+	if opts.Top > 0 && len(r.Rows) > opts.Top {
+		r.Rows = r.Rows[:opts.Top]
+	}
+	return r
+}
+
+func side(s *Summary, label string) Side {
+	return Side{
+		Label:      label,
+		Path:       s.Path,
+		SampleType: s.SampleType,
+		Unit:       s.Unit,
+		Total:      s.Total,
+		Duration:   s.Duration,
+		TotalRate:  s.Rate(s.Total),
+	}
+}
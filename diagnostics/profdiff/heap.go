@@ -0,0 +1,335 @@
+package profdiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/pprof/profile"
+)
+
+// HeapSampleTypes heap profile 中的四种 sample 类型
+var HeapSampleTypes = []string{"alloc_objects", "alloc_space", "inuse_objects", "inuse_space"}
+
+// HeapTotal 某个 sample 类型在两个 heap profile 中的总量
+type HeapTotal struct {
+	SampleType string  `json:"sample_type"`
+	Unit       string  `json:"unit"`
+	Base       int64   `json:"base"`
+	Target     int64   `json:"target"`
+	Growth     float64 `json:"growth,omitempty"` // Target/Base，Base 为 0 时不计算
+}
+
+// HeapSite 一个分配点（完整调用栈）在两个 heap profile 中的对比
+type HeapSite struct {
+	// Leaf 实际执行分配的函数（栈顶）
+	Leaf string `json:"leaf"`
+	// Path 从栈顶到第一个匹配 HandlerPattern 的调用路径
+	Path []string `json:"path"`
+	// Stack 完整调用栈，栈顶在前
+	Stack []string `json:"stack"`
+	// Base/Target/Delta 按排序所用 sample 类型计算
+	Base   int64 `json:"base"`
+	Target int64 `json:"target"`
+	Delta  int64 `json:"delta"`
+	// Deltas 四种 sample 类型各自的增长量
+	Deltas map[string]int64 `json:"deltas"`
+	// GrowthShare 该分配点占总增长的比例（0~1）
+	GrowthShare float64 `json:"growth_share"`
+	// Flagged 占比超过 FlagShare 的分配点
+	Flagged bool `json:"flagged,omitempty"`
+}
+
+// HeapReport 两个 heap profile 的对比结果
+type HeapReport struct {
+	BaseLabel   string      `json:"base_label"`
+	TargetLabel string      `json:"target_label"`
+	BasePath    string      `json:"base_path"`
+	TargetPath  string      `json:"target_path"`
+	SampleType  string      `json:"sample_type"`
+	Unit        string      `json:"unit"`
+	Totals      []HeapTotal `json:"totals"`
+	// TotalGrowth 所有增长分配点的增长量之和
+	TotalGrowth int64      `json:"total_growth"`
+	FlagShare   float64    `json:"flag_share"`
+	Sites       []HeapSite `json:"sites"`
+}
+
+// HeapOptions 控制 heap 对比
+type HeapOptions struct {
+	// SampleType 用于排序分配点的 sample 类型，默认 inuse_space
+	SampleType string
+	// Top 最多保留的分配点数量，0 表示不限制
+	Top int
+	// FlagShare 增长占比超过该值（0~1）的分配点会被标记
+	FlagShare float64
+	// HandlerPattern 调用路径截断到第一个匹配的函数，例如 "Handler$"；为空时保留完整调用栈
+	HandlerPattern *regexp.Regexp
+}
+
+// heapSite 单个 profile 中按调用栈聚合的值，下标与 HeapSampleTypes 对应
+type heapSite struct {
+	stack  []string
+	values []int64
+}
+
+// DiffHeap 对比两个 heap profile：四种 sample 类型的总量与倍数，以及增长最多的分配点
+func DiffHeap(base, target *profile.Profile, baseLabel, targetLabel string, opts HeapOptions) (*HeapReport, error) {
+	if opts.SampleType == "" {
+		opts.SampleType = "inuse_space"
+	}
+	rank := -1
+	for i, st := range HeapSampleTypes {
+		if st == opts.SampleType {
+			rank = i
+		}
+	}
+	if rank < 0 {
+		return nil, fmt.Errorf("unknown heap sample type %q, expected one of %v", opts.SampleType, HeapSampleTypes)
+	}
+
+	baseSites, baseUnits, err := heapSites(base)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", baseLabel, err)
+	}
+	targetSites, _, err := heapSites(target)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", targetLabel, err)
+	}
+
+	r := &HeapReport{
+		BaseLabel:   baseLabel,
+		TargetLabel: targetLabel,
+		SampleType:  opts.SampleType,
+		Unit:        baseUnits[rank],
+		FlagShare:   opts.FlagShare,
+	}
+	for i, st := range HeapSampleTypes {
+		t := HeapTotal{SampleType: st, Unit: baseUnits[i]}
+		for _, s := range baseSites {
+			t.Base += s.values[i]
+		}
+		for _, s := range targetSites {
+			t.Target += s.values[i]
+		}
+		if t.Base != 0 {
+			t.Growth = float64(t.Target) / float64(t.Base)
+		}
+		r.Totals = append(r.Totals, t)
+	}
+
+	keys := make(map[string]bool)
+	for k := range baseSites {
+		keys[k] = true
+	}
+	for k := range targetSites {
+		keys[k] = true
+	}
+	for k := range keys {
+		b, t := baseSites[k], targetSites[k]
+		site := HeapSite{Deltas: make(map[string]int64, len(HeapSampleTypes))}
+		for i, st := range HeapSampleTypes {
+			var bv, tv int64
+			if b != nil {
+				bv = b.values[i]
+			}
+			if t != nil {
+				tv = t.values[i]
+			}
+			site.Deltas[st] = tv - bv
+			if i == rank {
+				site.Base, site.Target, site.Delta = bv, tv, tv-bv
+			}
+		}
+		if site.Delta <= 0 {
+			continue
+		}
+		if t != nil {
+			site.Stack = t.stack
+		} else {
+			site.Stack = b.stack
+		}
+		site.Leaf = site.Stack[0]
+		site.Path = trimPath(site.Stack, opts.HandlerPattern)
+		r.TotalGrowth += site.Delta
+		r.Sites = append(r.Sites, site)
+	}
+
+	for i := range r.Sites {
+		s := &r.Sites[i]
+		s.GrowthShare = float64(s.Delta) / float64(r.TotalGrowth)
+		s.Flagged = opts.FlagShare > 0 && s.GrowthShare > opts.FlagShare
+	}
+	sort.Slice(r.Sites, func(i, j int) bool {
+		if r.Sites[i].Delta != r.Sites[j].Delta {
+			return r.Sites[i].Delta > r.Sites[j].Delta
+		}
+		return r.Sites[i].Leaf < r.Sites[j].Leaf
+	})
+	if opts.Top > 0 && len(r.Sites) > opts.Top {
+		r.Sites = r.Sites[:opts.Top]
+	}
+	return r, nil
+}
+
+// LoadHeapDiff 读取两个 heap profile 文件并对比
+func LoadHeapDiff(basePath, targetPath, baseLabel, targetLabel string, opts HeapOptions) (*HeapReport, error) {
+	base, err := Load(basePath)
+	if err != nil {
+		return nil, err
+	}
+	target, err := Load(targetPath)
+	if err != nil {
+		return nil, err
+	}
+	r, err := DiffHeap(base, target, baseLabel, targetLabel, opts)
+	if err != nil {
+		return nil, err
+	}
+	r.BasePath, r.TargetPath = basePath, targetPath
+	return r, nil
+}
+
+// heapSites 按完整调用栈聚合 heap profile 的四种 sample 值
+func heapSites(p *profile.Profile) (map[string]*heapSite, []string, error) {
+	idx := make([]int, len(HeapSampleTypes))
+	units := make([]string, len(HeapSampleTypes))
+	for i, st := range HeapSampleTypes {
+		j, err := SampleIndex(p, st)
+		if err != nil {
+			return nil, nil, fmt.Errorf("not a heap profile: %w", err)
+		}
+		idx[i], units[i] = j, p.SampleType[j].Unit
+	}
+
+	sites := make(map[string]*heapSite)
+	for _, sample := range p.Sample {
+		frames := sampleFrames(sample)
+		if len(frames) == 0 {
+			continue
+		}
+		key := strings.Join(frames, "\n")
+		s := sites[key]
+		if s == nil {
+			s = &heapSite{stack: frames, values: make([]int64, len(HeapSampleTypes))}
+			sites[key] = s
+		}
+		for i, j := range idx {
+			s.values[i] += sample.Value[j]
+		}
+	}
+	return sites, units, nil
+}
+
+// trimPath 截取从栈顶到第一个匹配 re 的函数为止的调用路径
+func trimPath(stack []string, re *regexp.Regexp) []string {
+	if re == nil {
+		return stack
+	}
+	for i, f := range stack {
+		if re.MatchString(f) {
+			return stack[:i+1]
+		}
+	}
+	return stack
+}
+
+// Write 按 format（text、json、markdown）输出报告
+func (r *HeapReport) Write(w io.Writer, format string) error {
+	switch format {
+	case "text", "":
+		return r.WriteText(w)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case "markdown", "md":
+		return r.WriteMarkdown(w)
+	default:
+		return fmt.Errorf("unknown format %q, expected one of %v", format, Formats)
+	}
+}
+
+// WriteText 输出总量表、增长最多的分配点以及它们的调用路径
+func (r *HeapReport) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "%s: %s\n%s: %s\n\n", r.BaseLabel, r.BasePath, r.TargetLabel, r.TargetPath)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "sample type\t%s\t%s\tgrowth\t\n", r.BaseLabel, r.TargetLabel)
+	for _, t := range r.Totals {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t\n", t.SampleType, FormatValue(t.Base, t.Unit), FormatValue(t.Target, t.Unit), formatGrowth(t))
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nTop growing allocation sites by %s (total growth %s):\n", r.SampleType, FormatValue(r.TotalGrowth, r.Unit))
+	for i, s := range r.Sites {
+		flag := ""
+		if s.Flagged {
+			flag = fmt.Sprintf("  ⚠️  > %.0f%% of growth", r.FlagShare*100)
+		}
+		fmt.Fprintf(w, "\n#%d %s: %s -> %s (+%s, %.1f%% of growth)%s\n", i+1, s.Leaf,
+			FormatValue(s.Base, r.Unit), FormatValue(s.Target, r.Unit), FormatValue(s.Delta, r.Unit), s.GrowthShare*100, flag)
+		var others []string
+		for _, t := range r.Totals {
+			if t.SampleType != r.SampleType {
+				others = append(others, fmt.Sprintf("%s %s", t.SampleType, formatDelta(s.Deltas[t.SampleType], t.Unit)))
+			}
+		}
+		fmt.Fprintf(w, "    (%s)\n", strings.Join(others, ", "))
+		for j, f := range s.Path {
+			fmt.Fprintf(w, "    %s%s\n", strings.Repeat("  ", j), f)
+		}
+	}
+	return nil
+}
+
+// WriteMarkdown 输出与 cursor_pprof_heap.md 中手工整理的表格相同结构的 Markdown
+func (r *HeapReport) WriteMarkdown(w io.Writer) error {
+	fmt.Fprintf(w, "| sample type | %s | %s | growth |\n", r.BaseLabel, r.TargetLabel)
+	fmt.Fprintln(w, "|---|---:|---:|---:|")
+	for _, t := range r.Totals {
+		fmt.Fprintf(w, "| %s | %s | %s | %s |\n", t.SampleType, FormatValue(t.Base, t.Unit), FormatValue(t.Target, t.Unit), formatGrowth(t))
+	}
+
+	fmt.Fprintf(w, "\n| # | allocation site | %s | %s | growth | share | call path |\n", r.BaseLabel, r.TargetLabel)
+	fmt.Fprintln(w, "|---:|---|---:|---:|---:|---:|---|")
+	for i, s := range r.Sites {
+		leaf := "`" + s.Leaf + "`"
+		if s.Flagged {
+			leaf = "⚠️ " + leaf
+		}
+		path := make([]string, len(s.Path))
+		for j := range s.Path {
+			// 从 handler 往下读更直观
+			path[j] = "`" + s.Path[len(s.Path)-1-j] + "`"
+		}
+		fmt.Fprintf(w, "| %d | %s | %s | %s | +%s | %.1f%% | %s |\n", i+1, leaf,
+			FormatValue(s.Base, r.Unit), FormatValue(s.Target, r.Unit), FormatValue(s.Delta, r.Unit),
+			s.GrowthShare*100, strings.Join(path, " → "))
+	}
+	return nil
+}
+
+func formatGrowth(t HeapTotal) string {
+	if t.Base == 0 {
+		if t.Target == 0 {
+			return "-"
+		}
+		return "new"
+	}
+	if t.Growth < 1 {
+		return fmt.Sprintf("%.2f×", t.Growth)
+	}
+	return fmt.Sprintf("%.1f×", t.Growth)
+}
+
+func formatDelta(v int64, unit string) string {
+	if v < 0 {
+		return "-" + FormatValue(-v, unit)
+	}
+	return "+" + FormatValue(v, unit)
+}
@@ -0,0 +1,270 @@
+package profdiff
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// builder 构造小型的合成 profile；栈以 "leaf;caller;...;root" 表示，栈顶在前
+type builder struct {
+	p     *profile.Profile
+	funcs map[string]*profile.Function
+}
+
+func newBuilder(types ...string) *builder {
+	p := &profile.Profile{}
+	for _, t := range types {
+		typ, unit, _ := strings.Cut(t, "/")
+		p.SampleType = append(p.SampleType, &profile.ValueType{Type: typ, Unit: unit})
+	}
+	return &builder{p: p, funcs: make(map[string]*profile.Function)}
+}
+
+func (b *builder) add(stack string, values ...int64) *builder {
+	s := &profile.Sample{Value: values}
+	for _, name := range strings.Split(stack, ";") {
+		fn := b.funcs[name]
+		if fn == nil {
+			fn = &profile.Function{ID: uint64(len(b.funcs) + 1), Name: name}
+			b.funcs[name] = fn
+			b.p.Function = append(b.p.Function, fn)
+		}
+		loc := &profile.Location{ID: uint64(len(b.p.Location) + 1), Line: []profile.Line{{Function: fn}}}
+		b.p.Location = append(b.p.Location, loc)
+		s.Location = append(s.Location, loc)
+	}
+	b.p.Sample = append(b.p.Sample, s)
+	return b
+}
+
+// cpu 构造 samples/count + cpu/nanoseconds 的 CPU profile
+func cpu(duration time.Duration) *builder {
+	b := newBuilder("samples/count", "cpu/nanoseconds")
+	b.p.DurationNanos = int64(duration)
+	return b
+}
+
+// heap 构造四种 sample 类型的 heap profile；values 依次为 alloc_objects、alloc_space、inuse_objects、inuse_space
+func heap() *builder {
+	return newBuilder("alloc_objects/count", "alloc_space/bytes", "inuse_objects/count", "inuse_space/bytes")
+}
+
+// writeProfile 把 profile 写成 gzip 压缩的 protobuf 文件
+func writeProfile(t *testing.T, p *profile.Profile, name string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := p.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSummarize(t *testing.T) {
+	p := cpu(2*time.Second).
+		add("main.work;main.handler;main.main", 1, 300).
+		add("main.handler;main.main", 1, 100).
+		// 递归：fib 在栈中出现两次，cum 只计一次
+		add("main.fib;main.fib;main.main", 1, 600).p
+
+	s, err := Summarize(p, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.SampleType != "cpu" || s.Unit != "nanoseconds" || s.Total != 1000 {
+		t.Fatalf("summary = %s %s total %d, want cpu nanoseconds 1000", s.SampleType, s.Unit, s.Total)
+	}
+	want := map[string][2]int64{
+		"main.work":    {300, 300},
+		"main.handler": {100, 400},
+		"main.fib":     {600, 600},
+		"main.main":    {0, 1000},
+	}
+	for name, fc := range want {
+		fs := s.Funcs[name]
+		if fs == nil {
+			t.Errorf("%s missing", name)
+			continue
+		}
+		if fs.Flat != fc[0] || fs.Cum != fc[1] {
+			t.Errorf("%s flat/cum = %d/%d, want %d/%d", name, fs.Flat, fs.Cum, fc[0], fc[1])
+		}
+	}
+	if got := s.Share(s.Funcs["main.handler"].Cum); got != 0.4 {
+		t.Errorf("handler cum share = %v, want 0.4", got)
+	}
+	if got := s.Rate(s.Total); got != 500 {
+		t.Errorf("total rate = %v, want 500 ns/s", got)
+	}
+
+	// -focus 只保留栈中包含 handler 的 sample
+	s, err = Summarize(p, "cpu", regexp.MustCompile(`handler$`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Total != 400 || s.Funcs["main.fib"] != nil {
+		t.Errorf("focus: total %d, fib %v; want 400 and no fib", s.Total, s.Funcs["main.fib"])
+	}
+
+	if _, err := Summarize(p, "alloc_space", nil); err == nil || !strings.Contains(err.Error(), "available") {
+		t.Errorf("unknown sample type error = %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	good := cpu(time.Second).
+		add("main.work;main.main", 1, 800).
+		add("main.format;main.main", 1, 200).p
+	bad := cpu(2*time.Second).
+		add("main.work;main.main", 1, 500).
+		add("main.format;main.main", 1, 1500).p
+
+	goodPath := writeProfile(t, good, "good.prof")
+	badPath := writeProfile(t, bad, "bad.prof")
+	gs, err := LoadSummary(goodPath, "cpu", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := LoadSummary(badPath, "cpu", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := Diff(gs, bs, "good", "bad", Options{MinDelta: 0.01})
+	if r.Base.Path != goodPath || r.Target.TotalRate != 1000 {
+		t.Errorf("sides = %+v / %+v", r.Base, r.Target)
+	}
+	// main.main 的 cum 都是 100%，变化为 0，被 MinDelta 过滤
+	if len(r.Rows) != 2 {
+		t.Fatalf("got %d rows, want 2: %+v", len(r.Rows), r.Rows)
+	}
+	// format 和 work 的 flat 占比变化都是 55%，按函数名排序
+	if r.Rows[0].Func != "main.format" || r.Rows[1].Func != "main.work" {
+		t.Errorf("row order = %s, %s", r.Rows[0].Func, r.Rows[1].Func)
+	}
+	f := r.Rows[0]
+	if f.BaseFlatShare != 0.2 || f.TargetFlatShare != 0.75 || f.TargetFlatRate != 750 {
+		t.Errorf("format row = %+v", f)
+	}
+
+	r = Diff(gs, bs, "good", "bad", Options{Top: 1})
+	if len(r.Rows) != 1 {
+		t.Errorf("Top=1 returned %d rows", len(r.Rows))
+	}
+
+	var sb strings.Builder
+	for _, format := range Formats {
+		sb.Reset()
+		if err := r.Write(&sb, format); err != nil {
+			t.Errorf("%s: %v", format, err)
+		}
+		if !strings.Contains(sb.String(), "main.format") {
+			t.Errorf("%s output missing main.format:\n%s", format, sb.String())
+		}
+	}
+	if err := r.Write(&sb, "xml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestDiffHeap(t *testing.T) {
+	base := heap().
+		add("bytes.growSlice;main.cacheHandler;main.main", 10, 1000, 10, 1000).
+		add("main.newBuf;main.readHandler;main.main", 5, 500, 5, 500).
+		add("main.shrink;main.main", 4, 400, 4, 400).p
+	target := heap().
+		// +3000 inuse_space，占增长的 75%
+		add("bytes.growSlice;main.cacheHandler;main.main", 40, 4000, 40, 4000).
+		// +1000 inuse_space，占 25%
+		add("main.newBuf;main.readHandler;main.main", 15, 1500, 15, 1500).
+		// 下降的分配点不出现在报告中
+		add("main.shrink;main.main", 4, 400, 1, 100).p
+
+	r, err := LoadHeapDiff(writeProfile(t, base, "good.heap"), writeProfile(t, target, "bad.heap"), "good", "bad", HeapOptions{
+		FlagShare:      0.25,
+		HandlerPattern: regexp.MustCompile(`Handler$`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.SampleType != "inuse_space" || r.Unit != "bytes" {
+		t.Errorf("sample type = %s %s, want inuse_space bytes", r.SampleType, r.Unit)
+	}
+	totals := map[string][2]int64{
+		"alloc_objects": {19, 59},
+		"alloc_space":   {1900, 5900},
+		"inuse_objects": {19, 56},
+		"inuse_space":   {1900, 5600},
+	}
+	for _, tot := range r.Totals {
+		want := totals[tot.SampleType]
+		if tot.Base != want[0] || tot.Target != want[1] {
+			t.Errorf("%s total = %d -> %d, want %d -> %d", tot.SampleType, tot.Base, tot.Target, want[0], want[1])
+		}
+	}
+	if r.TotalGrowth != 4000 {
+		t.Errorf("TotalGrowth = %d, want 4000", r.TotalGrowth)
+	}
+	if len(r.Sites) != 2 {
+		t.Fatalf("got %d sites, want 2: %+v", len(r.Sites), r.Sites)
+	}
+
+	top := r.Sites[0]
+	if top.Leaf != "bytes.growSlice" || top.Delta != 3000 || top.GrowthShare != 0.75 {
+		t.Errorf("top site = %+v", top)
+	}
+	if got := strings.Join(top.Path, ";"); got != "bytes.growSlice;main.cacheHandler" {
+		t.Errorf("path = %s, should stop at the handler", got)
+	}
+	if top.Deltas["alloc_objects"] != 30 || top.Deltas["inuse_objects"] != 30 {
+		t.Errorf("deltas = %v", top.Deltas)
+	}
+	if !top.Flagged {
+		t.Error("site with 75% of growth should be flagged")
+	}
+	// 占比恰好等于 FlagShare 时不标记
+	if r.Sites[1].GrowthShare != 0.25 || r.Sites[1].Flagged {
+		t.Errorf("site with exactly FlagShare of growth: share %v flagged %v", r.Sites[1].GrowthShare, r.Sites[1].Flagged)
+	}
+
+	var sb strings.Builder
+	if err := r.Write(&sb, "text"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sb.String(), "⚠️  > 25% of growth") || strings.Count(sb.String(), "⚠️") != 1 {
+		t.Errorf("text output should flag only the top site:\n%s", sb.String())
+	}
+
+	// 按 alloc_objects 排序，Top 截断
+	r, err = DiffHeap(base, target, "good", "bad", HeapOptions{SampleType: "alloc_objects", Top: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Sites) != 1 || r.Sites[0].Delta != 30 || r.Unit != "count" {
+		t.Errorf("alloc_objects top site = %+v, unit %s", r.Sites, r.Unit)
+	}
+	if len(r.Sites[0].Path) != 3 {
+		t.Errorf("without HandlerPattern the path should be the full stack, got %v", r.Sites[0].Path)
+	}
+}
+
+func TestDiffHeapErrors(t *testing.T) {
+	h := heap().add("main.f", 1, 1, 1, 1).p
+	if _, err := DiffHeap(h, h, "a", "b", HeapOptions{SampleType: "cpu"}); err == nil {
+		t.Error("expected error for unknown sample type")
+	}
+	c := cpu(time.Second).add("main.f", 1, 1).p
+	if _, err := DiffHeap(c, h, "a", "b", HeapOptions{}); err == nil || !strings.Contains(err.Error(), "not a heap profile") {
+		t.Errorf("CPU profile as base: err = %v", err)
+	}
+}
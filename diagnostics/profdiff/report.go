@@ -0,0 +1,165 @@
+package profdiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Formats 支持的输出格式
+var Formats = []string{"text", "json", "markdown"}
+
+// Write 按 format（text、json、markdown）输出报告
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "text", "":
+		return r.WriteText(w)
+	case "json":
+		return r.WriteJSON(w)
+	case "markdown", "md":
+		return r.WriteMarkdown(w)
+	default:
+		return fmt.Errorf("unknown format %q, expected one of %v", format, Formats)
+	}
+}
+
+// WriteJSON 以 JSON 格式输出报告
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText 以对齐的表格输出报告，适合在终端查看
+func (r *Report) WriteText(w io.Writer) error {
+	for _, s := range []Side{r.Base, r.Target} {
+		fmt.Fprintf(w, "%-8s %s: %s total %s%s\n", s.Label, s.Path, s.SampleType,
+			FormatValue(s.Total, s.Unit), r.rateSuffix(s))
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, strings.Join(r.header(), "\t")+"\t")
+	for _, row := range r.Rows {
+		fmt.Fprintln(tw, strings.Join(r.cells(row), "\t")+"\t")
+	}
+	return tw.Flush()
+}
+
+// WriteMarkdown 以 Markdown 表格输出报告，可以直接贴进分析文档
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	fmt.Fprintf(w, "| | %s | %s |\n", r.Base.Label, r.Target.Label)
+	fmt.Fprintln(w, "|---|---|---|")
+	fmt.Fprintf(w, "| Profile | `%s` | `%s` |\n", r.Base.Path, r.Target.Path)
+	fmt.Fprintf(w, "| Total %s | %s | %s |\n", r.Base.SampleType,
+		FormatValue(r.Base.Total, r.Base.Unit), FormatValue(r.Target.Total, r.Target.Unit))
+	if r.hasRate() {
+		fmt.Fprintf(w, "| Duration | %v | %v |\n", r.Base.Duration.Round(time.Millisecond), r.Target.Duration.Round(time.Millisecond))
+		fmt.Fprintf(w, "| Per second | %s | %s |\n",
+			FormatRate(r.Base.TotalRate, r.Base.Unit), FormatRate(r.Target.TotalRate, r.Target.Unit))
+	}
+	fmt.Fprintln(w)
+
+	header := r.header()
+	fmt.Fprintln(w, "| "+strings.Join(header, " | ")+" |")
+	sep := make([]string, len(header))
+	for i := range sep {
+		sep[i] = "---:"
+	}
+	sep[0] = "---"
+	fmt.Fprintln(w, "|"+strings.Join(sep, "|")+"|")
+	for _, row := range r.Rows {
+		cells := r.cells(row)
+		cells[0] = "`" + cells[0] + "`"
+		fmt.Fprintln(w, "| "+strings.Join(cells, " | ")+" |")
+	}
+	return nil
+}
+
+func (r *Report) hasRate() bool {
+	return r.Base.Duration > 0 && r.Target.Duration > 0
+}
+
+func (r *Report) rateSuffix(s Side) string {
+	if s.Duration <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" over %v (%s)", s.Duration.Round(time.Millisecond), FormatRate(s.TotalRate, s.Unit))
+}
+
+func (r *Report) header() []string {
+	b, t := r.Base.Label, r.Target.Label
+	h := []string{
+		"function",
+		"flat% " + b, "flat% " + t, "Δflat%",
+		"cum% " + b, "cum% " + t, "Δcum%",
+	}
+	if r.hasRate() {
+		h = append(h, "flat/s "+b, "flat/s "+t, "cum/s "+b, "cum/s "+t)
+	}
+	return h
+}
+
+func (r *Report) cells(row Row) []string {
+	c := []string{
+		row.Func,
+		pct(row.BaseFlatShare), pct(row.TargetFlatShare), deltaPct(row.DeltaFlatShare()),
+		pct(row.BaseCumShare), pct(row.TargetCumShare), deltaPct(row.DeltaCumShare()),
+	}
+	if r.hasRate() {
+		c = append(c,
+			FormatRate(row.BaseFlatRate, r.Base.Unit), FormatRate(row.TargetFlatRate, r.Target.Unit),
+			FormatRate(row.BaseCumRate, r.Base.Unit), FormatRate(row.TargetCumRate, r.Target.Unit))
+	}
+	return c
+}
+
+func pct(v float64) string {
+	return fmt.Sprintf("%.2f%%", v*100)
+}
+
+func deltaPct(v float64) string {
+	return fmt.Sprintf("%+.2f%%", v*100)
+}
+
+// FormatValue 按 pprof 的单位格式化数值
+func FormatValue(v int64, unit string) string {
+	switch unit {
+	case "nanoseconds":
+		return time.Duration(v).Round(time.Millisecond).String()
+	case "bytes":
+		return FormatBytes(float64(v))
+	default:
+		return fmt.Sprintf("%d", v)
+	}
+}
+
+// FormatRate 格式化每秒的量；CPU 纳秒/秒 显示为占用的核数
+func FormatRate(v float64, unit string) string {
+	switch unit {
+	case "nanoseconds":
+		return fmt.Sprintf("%.3f cores", v/float64(time.Second))
+	case "bytes":
+		return FormatBytes(v) + "/s"
+	default:
+		return fmt.Sprintf("%.1f/s", v)
+	}
+}
+
+// FormatBytes 以 B/kB/MB/GB 显示字节数，与 pprof 的显示方式一致
+func FormatBytes(v float64) string {
+	const unit = 1024
+	switch {
+	case v >= unit*unit*unit:
+		return fmt.Sprintf("%.2fGB", v/(unit*unit*unit))
+	case v >= unit*unit:
+		return fmt.Sprintf("%.2fMB", v/(unit*unit))
+	case v >= unit:
+		return fmt.Sprintf("%.2fkB", v/unit)
+	default:
+		return fmt.Sprintf("%.0fB", v)
+	}
+}
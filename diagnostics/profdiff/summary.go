@@ -0,0 +1,168 @@
+// Package profdiff 解析 pprof 格式的 profile，按函数聚合 flat/cum，
+// 并对比两个 profile（例如 good 与 bad）找出占比变化最大的函数。
+package profdiff
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// FuncStat 单个函数在 profile 中的 flat/cum 值
+type FuncStat struct {
+	Name string
+	// Flat 函数自身（栈顶）消耗的值
+	Flat int64
+	// Cum 函数及其调用的所有函数消耗的值
+	Cum int64
+}
+
+// Summary 一个 profile 按函数聚合后的结果
+type Summary struct {
+	Path       string
+	SampleType string
+	Unit       string
+	// Total 所选 sample 类型的总值（经过 Focus 过滤后）
+	Total int64
+	// Duration profile 的采样时长，heap 等非时间段 profile 为 0
+	Duration time.Duration
+	Funcs    map[string]*FuncStat
+}
+
+// Load 读取 pprof 格式（gzip 压缩的 protobuf）的 profile 文件
+func Load(path string) (*profile.Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, err := profile.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// SampleIndex 根据名称查找 sample 类型下标；name 为空时使用 profile 的默认类型（通常是最后一个）
+func SampleIndex(p *profile.Profile, name string) (int, error) {
+	if name == "" {
+		name = p.DefaultSampleType
+	}
+	if name == "" {
+		return len(p.SampleType) - 1, nil
+	}
+	for i, st := range p.SampleType {
+		if st.Type == name {
+			return i, nil
+		}
+	}
+	var names []string
+	for _, st := range p.SampleType {
+		names = append(names, st.Type)
+	}
+	return 0, fmt.Errorf("sample type %q not found, available: %v", name, names)
+}
+
+// Summarize 按函数聚合 profile 中指定 sample 类型的值。
+// focus 不为 nil 时只统计调用栈中包含匹配函数的 sample，对应 pprof 的 -focus。
+func Summarize(p *profile.Profile, sampleType string, focus *regexp.Regexp) (*Summary, error) {
+	idx, err := SampleIndex(p, sampleType)
+	if err != nil {
+		return nil, err
+	}
+	s := &Summary{
+		SampleType: p.SampleType[idx].Type,
+		Unit:       p.SampleType[idx].Unit,
+		Duration:   time.Duration(p.DurationNanos),
+		Funcs:      make(map[string]*FuncStat),
+	}
+
+	for _, sample := range p.Sample {
+		v := sample.Value[idx]
+		if v == 0 {
+			continue
+		}
+		frames := sampleFrames(sample)
+		if focus != nil && !matchAny(frames, focus) {
+			continue
+		}
+		s.Total += v
+
+		// 递归调用时同一个函数在栈中出现多次，cum 只计一次
+		seen := make(map[string]bool, len(frames))
+		for i, name := range frames {
+			fs := s.Funcs[name]
+			if fs == nil {
+				fs = &FuncStat{Name: name}
+				s.Funcs[name] = fs
+			}
+			if i == 0 {
+				fs.Flat += v
+			}
+			if !seen[name] {
+				seen[name] = true
+				fs.Cum += v
+			}
+		}
+	}
+	return s, nil
+}
+
+// LoadSummary 读取 profile 文件并聚合
+func LoadSummary(path, sampleType string, focus *regexp.Regexp) (*Summary, error) {
+	p, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Summarize(p, sampleType, focus)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	s.Path = path
+	return s, nil
+}
+
+// Rate 把值按采样时长归一化为每秒的量，例如 CPU 纳秒/秒 即占用的核数
+func (s *Summary) Rate(v int64) float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(v) / s.Duration.Seconds()
+}
+
+// Share 值占总量的比例
+func (s *Summary) Share(v int64) float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(v) / float64(s.Total)
+}
+
+// sampleFrames 返回 sample 的函数名调用栈，下标 0 为栈顶（包含内联展开的函数）
+func sampleFrames(sample *profile.Sample) []string {
+	var frames []string
+	for _, loc := range sample.Location {
+		// Location.Line 中内联的函数排在前面
+		for _, line := range loc.Line {
+			if line.Function != nil {
+				frames = append(frames, line.Function.Name)
+			}
+		}
+		if len(loc.Line) == 0 {
+			frames = append(frames, fmt.Sprintf("0x%x", loc.Address))
+		}
+	}
+	return frames
+}
+
+func matchAny(frames []string, re *regexp.Regexp) bool {
+	for _, f := range frames {
+		if re.MatchString(f) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,277 @@
+package timeline
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var csvHeader = []string{
+	"time", "elapsed_seconds", "rss", "hwm", "threads", "goroutines",
+	"heap_objects", "heap_unused", "heap_free", "heap_released", "stacks", "go_total",
+	"heap_goal", "gc_cycles", "gc_cpu_fraction",
+}
+
+// WriteCSV 以 CSV 输出时间线，内存单位为字节
+func WriteCSV(w io.Writer, samples []Sample) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	u := func(v uint64) string { return strconv.FormatUint(v, 10) }
+	for _, s := range samples {
+		cw.Write([]string{
+			s.Time.Format(time.RFC3339Nano),
+			strconv.FormatFloat(s.Elapsed.Seconds(), 'f', 3, 64),
+			u(s.RSS), u(s.HWM), strconv.Itoa(s.Threads), u(s.Goroutines),
+			u(s.HeapObjects), u(s.HeapUnused), u(s.HeapFree), u(s.HeapReleased), u(s.Stacks), u(s.GoTotal),
+			u(s.HeapGoal), u(s.GCCycles),
+			strconv.FormatFloat(s.GCCPU, 'f', 4, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON 以 JSON 数组输出时间线
+func WriteJSON(w io.Writer, samples []Sample) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(samples)
+}
+
+// series 图表中的一条线
+type series struct {
+	Name  string
+	Color string
+	Value func(Sample) float64
+}
+
+// chart 一张图表；Scale 把原始值换算成显示单位
+type chart struct {
+	Title  string
+	Unit   string
+	Scale  float64
+	Series []series
+}
+
+var charts = []chart{
+	{
+		Title: "Memory", Unit: "MB", Scale: 1 << 20,
+		Series: []series{
+			{"RSS (VmRSS)", "#d62728", func(s Sample) float64 { return float64(s.RSS) }},
+			{"RSS peak (VmHWM)", "#ff9896", func(s Sample) float64 { return float64(s.HWM) }},
+			{"Go total", "#9467bd", func(s Sample) float64 { return float64(s.GoTotal) }},
+			{"heap objects", "#1f77b4", func(s Sample) float64 { return float64(s.HeapObjects) }},
+			{"heap goal", "#aec7e8", func(s Sample) float64 { return float64(s.HeapGoal) }},
+			{"heap unused (fragmentation)", "#ff7f0e", func(s Sample) float64 { return float64(s.HeapUnused) }},
+			{"heap free (retained)", "#2ca02c", func(s Sample) float64 { return float64(s.HeapFree) }},
+			{"heap released to OS", "#98df8a", func(s Sample) float64 { return float64(s.HeapReleased) }},
+			{"stacks", "#8c564b", func(s Sample) float64 { return float64(s.Stacks) }},
+		},
+	},
+	{
+		Title: "Goroutines and threads", Scale: 1,
+		Series: []series{
+			{"goroutines", "#1f77b4", func(s Sample) float64 { return float64(s.Goroutines) }},
+			{"OS threads", "#d62728", func(s Sample) float64 { return float64(s.Threads) }},
+		},
+	},
+	{
+		Title: "GC", Unit: "%", Scale: 0.01,
+		Series: []series{
+			{"GC CPU fraction", "#d62728", func(s Sample) float64 { return s.GCCPU }},
+		},
+	},
+}
+
+const (
+	chartWidth  = 900
+	chartHeight = 260
+	padLeft     = 70
+	padRight    = 20
+	padTop      = 20
+	padBottom   = 30
+)
+
+type svgLine struct {
+	Name   string
+	Color  string
+	Points string
+	Last   string
+}
+
+type svgTick struct {
+	Pos   float64
+	Label string
+}
+
+type svgChart struct {
+	Title   string
+	Lines   []svgLine
+	YTicks  []svgTick
+	XTicks  []svgTick
+	Width   int
+	Height  int
+	PlotX0  int
+	PlotX1  int
+	PlotY0  int
+	PlotY1  int
+	Summary string
+}
+
+// WriteHTML 输出自包含的 HTML 报告：内联 SVG 折线图，不依赖任何外部脚本
+func WriteHTML(w io.Writer, title string, samples []Sample) error {
+	var out []svgChart
+	for _, c := range charts {
+		out = append(out, renderChart(c, samples))
+	}
+	data := struct {
+		Title     string
+		Generated string
+		Count     int
+		Duration  string
+		Charts    []svgChart
+		Peak      string
+	}{
+		Title:     title,
+		Generated: time.Now().Format(time.RFC3339),
+		Count:     len(samples),
+		Charts:    out,
+	}
+	if n := len(samples); n > 0 {
+		data.Duration = samples[n-1].Elapsed.Round(time.Second).String()
+		var peak Sample
+		for _, s := range samples {
+			if s.RSS > peak.RSS {
+				peak = s
+			}
+		}
+		data.Peak = fmt.Sprintf("peak RSS %.1fMB at %v (heap objects %.1fMB, unused %.1fMB, free %.1fMB, released %.1fMB, stacks %.1fMB)",
+			float64(peak.RSS)/(1<<20), peak.Elapsed.Round(time.Second),
+			float64(peak.HeapObjects)/(1<<20), float64(peak.HeapUnused)/(1<<20),
+			float64(peak.HeapFree)/(1<<20), float64(peak.HeapReleased)/(1<<20), float64(peak.Stacks)/(1<<20))
+	}
+	return htmlTemplate.Execute(w, data)
+}
+
+func renderChart(c chart, samples []Sample) svgChart {
+	sc := svgChart{
+		Title:  c.Title,
+		Width:  chartWidth,
+		Height: chartHeight,
+		PlotX0: padLeft,
+		PlotX1: chartWidth - padRight,
+		PlotY0: padTop,
+		PlotY1: chartHeight - padBottom,
+	}
+	if c.Unit != "" {
+		sc.Title += " (" + c.Unit + ")"
+	}
+	if len(samples) == 0 {
+		return sc
+	}
+
+	maxY := 0.0
+	for _, s := range samples {
+		for _, se := range c.Series {
+			maxY = math.Max(maxY, se.Value(s)/c.Scale)
+		}
+	}
+	maxY = niceCeil(maxY)
+	maxX := samples[len(samples)-1].Elapsed.Seconds()
+	if maxX <= 0 {
+		maxX = 1
+	}
+	plotW := float64(sc.PlotX1 - sc.PlotX0)
+	plotH := float64(sc.PlotY1 - sc.PlotY0)
+	x := func(sec float64) float64 { return float64(sc.PlotX0) + sec/maxX*plotW }
+	y := func(v float64) float64 { return float64(sc.PlotY1) - v/maxY*plotH }
+
+	for _, se := range c.Series {
+		var pts strings.Builder
+		for _, s := range samples {
+			fmt.Fprintf(&pts, "%.1f,%.1f ", x(s.Elapsed.Seconds()), y(se.Value(s)/c.Scale))
+		}
+		last := se.Value(samples[len(samples)-1]) / c.Scale
+		sc.Lines = append(sc.Lines, svgLine{Name: se.Name, Color: se.Color, Points: pts.String(), Last: formatTick(last)})
+	}
+	for i := 0; i <= 4; i++ {
+		v := maxY * float64(i) / 4
+		sc.YTicks = append(sc.YTicks, svgTick{Pos: y(v), Label: formatTick(v)})
+	}
+	for i := 0; i <= 6; i++ {
+		sec := maxX * float64(i) / 6
+		sc.XTicks = append(sc.XTicks, svgTick{Pos: x(sec), Label: (time.Duration(sec * float64(time.Second))).Round(time.Second).String()})
+	}
+	return sc
+}
+
+// niceCeil 把坐标轴上限取整到 1、2、5 乘以 10 的幂
+func niceCeil(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	exp := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if v <= m*exp {
+			return m * exp
+		}
+	}
+	return 10 * exp
+}
+
+func formatTick(v float64) string {
+	if v >= 100 || v == math.Trunc(v) {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(v, 'f', 1, 64)
+}
+
+var htmlTemplate = template.Must(template.New("timeline").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 24px; color: #222; }
+h1 { font-size: 20px; }
+h2 { font-size: 16px; margin: 24px 0 4px; }
+.meta { color: #666; font-size: 13px; }
+svg { background: #fafafa; border: 1px solid #ddd; }
+svg text { font-size: 11px; fill: #555; }
+.legend { font-size: 12px; margin: 4px 0 0; }
+.legend span { display: inline-block; margin-right: 16px; }
+.legend i { display: inline-block; width: 12px; height: 3px; margin-right: 4px; vertical-align: middle; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="meta">{{.Count}} samples over {{.Duration}}, generated {{.Generated}}</p>
+{{with .Peak}}<p class="meta">{{.}}</p>{{end}}
+{{range .Charts}}
+<h2>{{.Title}}</h2>
+<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}" xmlns="http://www.w3.org/2000/svg">
+{{- $c := .}}
+{{- range .YTicks}}
+<line x1="{{$c.PlotX0}}" x2="{{$c.PlotX1}}" y1="{{.Pos}}" y2="{{.Pos}}" stroke="#e5e5e5"/>
+<text x="{{$c.PlotX0}}" dx="-6" y="{{.Pos}}" dy="4" text-anchor="end">{{.Label}}</text>
+{{- end}}
+{{- range .XTicks}}
+<text x="{{.Pos}}" y="{{$c.PlotY1}}" dy="16" text-anchor="middle">{{.Label}}</text>
+{{- end}}
+<line x1="{{.PlotX0}}" x2="{{.PlotX0}}" y1="{{.PlotY0}}" y2="{{.PlotY1}}" stroke="#999"/>
+<line x1="{{.PlotX0}}" x2="{{.PlotX1}}" y1="{{.PlotY1}}" y2="{{.PlotY1}}" stroke="#999"/>
+{{- range .Lines}}
+<polyline fill="none" stroke="{{.Color}}" stroke-width="1.5" points="{{.Points}}"><title>{{.Name}}</title></polyline>
+{{- end}}
+</svg>
+<div class="legend">{{range .Lines}}<span><i style="background: {{.Color}}"></i>{{.Name}} (last {{.Last}})</span>{{end}}</div>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,56 @@
+package timeline
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ProcStatus /proc/<pid>/status 中与内存相关的字段
+type ProcStatus struct {
+	// RSS 常驻内存（VmRSS）
+	RSS uint64
+	// HWM 常驻内存峰值（VmHWM）
+	HWM     uint64
+	Threads int
+}
+
+// procDir procfs 的挂载点，测试时替换为 testdata
+var procDir = "/proc"
+
+// ReadProcStatus 读取 /proc/<pid>/status，只支持 Linux
+func ReadProcStatus(pid int) (ProcStatus, error) {
+	var st ProcStatus
+	f, err := os.Open(fmt.Sprintf("%s/%d/status", procDir, pid))
+	if err != nil {
+		return st, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		n, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "VmRSS":
+			st.RSS = n << 10 // kB
+		case "VmHWM":
+			st.HWM = n << 10
+		case "Threads":
+			st.Threads = int(n)
+		}
+	}
+	return st, sc.Err()
+}
@@ -0,0 +1,187 @@
+// Package timeline 定期采样进程的 RSS（/proc/<pid>/status）和 Go runtime/metrics，
+// 生成内存时间线（CSV、JSON 以及自包含的 HTML 图表），
+// 用来观察 heap profile 看不到的 RSS、栈、归还给 OS 的内存和碎片。
+package timeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Sample 时间线上的一个点；内存单位均为字节，拿不到的值为 0
+type Sample struct {
+	Time    time.Time     `json:"time"`
+	Elapsed time.Duration `json:"elapsed"`
+
+	// 来自 /proc/<pid>/status
+	RSS     uint64 `json:"rss"`
+	HWM     uint64 `json:"hwm"`
+	Threads int    `json:"threads"`
+
+	// 来自 runtime/metrics
+	Goroutines   uint64  `json:"goroutines"`
+	HeapObjects  uint64  `json:"heap_objects"`
+	HeapUnused   uint64  `json:"heap_unused"`
+	HeapFree     uint64  `json:"heap_free"`
+	HeapReleased uint64  `json:"heap_released"`
+	Stacks       uint64  `json:"stacks"`
+	GoTotal      uint64  `json:"go_total"`
+	HeapGoal     uint64  `json:"heap_goal"`
+	GCCycles     uint64  `json:"gc_cycles"`
+	GCCPU        float64 `json:"gc_cpu_fraction"`
+
+	gcCPUSeconds    float64
+	totalCPUSeconds float64
+}
+
+// Source 采样来源：PID 和/或管理端口
+type Source struct {
+	// PID 读取 /proc/<pid>/status；0 时使用管理端口返回的 pid（仅限本机进程）
+	PID int
+	// Admin 管理端口地址，例如 localhost:6060；为空时只采集 /proc
+	Admin  string
+	Client *http.Client
+}
+
+// Recorder 按固定间隔采样，直到 ctx 结束或目标进程退出
+type Recorder struct {
+	Source   Source
+	Interval time.Duration
+	// OnSample 每次采样后调用，可以为 nil
+	OnSample func(Sample)
+}
+
+// Record 开始采样并返回采到的所有点；目标进程退出（/proc/<pid> 不存在或管理端口拒绝连接）视为正常结束，
+// 其他错误（例如一次超时）只记录日志并跳过这个点
+func (r *Recorder) Record(ctx context.Context) ([]Sample, error) {
+	if r.Source.PID == 0 && r.Source.Admin == "" {
+		return nil, errors.New("either pid or admin address is required")
+	}
+	if r.Source.Client == nil {
+		r.Source.Client = &http.Client{Timeout: 5 * time.Second}
+	}
+	interval := r.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	var samples []Sample
+	start := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var prev *Sample
+		if len(samples) > 0 {
+			prev = &samples[len(samples)-1]
+		}
+		s, err := r.sample(ctx, prev)
+		switch {
+		case err == nil:
+			s.Elapsed = s.Time.Sub(start)
+			samples = append(samples, s)
+			if r.OnSample != nil {
+				r.OnSample(s)
+			}
+		case len(samples) == 0:
+			return nil, err
+		case ctx.Err() != nil || processGone(err):
+			return samples, nil
+		default:
+			log.Printf("timeline: skipping sample: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return samples, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// processGone 判断采样错误是否说明目标进程已经退出
+func processGone(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+func (r *Recorder) sample(ctx context.Context, prev *Sample) (Sample, error) {
+	s := Sample{Time: time.Now()}
+	pid := r.Source.PID
+	if r.Source.Admin != "" {
+		m, err := fetchRuntimeMetrics(ctx, r.Source.Client, r.Source.Admin)
+		if err != nil {
+			return s, err
+		}
+		if pid == 0 {
+			pid = m.PID
+		}
+		m.fill(&s, prev)
+	}
+	if pid != 0 {
+		st, err := ReadProcStatus(pid)
+		if err != nil {
+			return s, err
+		}
+		s.RSS, s.HWM, s.Threads = st.RSS, st.HWM, st.Threads
+	}
+	return s, nil
+}
+
+type runtimeMetrics struct {
+	PID     int                `json:"pid"`
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+func fetchRuntimeMetrics(ctx context.Context, client *http.Client, addr string) (*runtimeMetrics, error) {
+	base := addr
+	if strings.HasPrefix(base, ":") {
+		base = "localhost" + base
+	}
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(base, "/")+"/debug/runtime-metrics", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", req.URL, resp.Status)
+	}
+	var m runtimeMetrics
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return nil, fmt.Errorf("decode runtime metrics: %w", err)
+	}
+	return &m, nil
+}
+
+func (m *runtimeMetrics) fill(s *Sample, prev *Sample) {
+	u := func(name string) uint64 { return uint64(m.Metrics[name]) }
+	s.Goroutines = u("/sched/goroutines:goroutines")
+	s.HeapObjects = u("/memory/classes/heap/objects:bytes")
+	s.HeapUnused = u("/memory/classes/heap/unused:bytes")
+	s.HeapFree = u("/memory/classes/heap/free:bytes")
+	s.HeapReleased = u("/memory/classes/heap/released:bytes")
+	s.Stacks = u("/memory/classes/heap/stacks:bytes") + u("/memory/classes/os-stacks:bytes")
+	s.GoTotal = u("/memory/classes/total:bytes")
+	s.HeapGoal = u("/gc/heap/goal:bytes")
+	s.GCCycles = u("/gc/cycles/total:gc-cycles")
+	s.gcCPUSeconds = m.Metrics["/cpu/classes/gc/total:cpu-seconds"]
+	s.totalCPUSeconds = m.Metrics["/cpu/classes/total:cpu-seconds"]
+	if prev != nil {
+		if total := s.totalCPUSeconds - prev.totalCPUSeconds; total > 0 {
+			s.GCCPU = (s.gcCPUSeconds - prev.gcCPUSeconds) / total
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package timeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const fixturePID = 4242
+
+// useProcDir 把 procDir 换成 dir，测试结束后还原
+func useProcDir(t *testing.T, dir string) {
+	t.Helper()
+	old := procDir
+	procDir = dir
+	t.Cleanup(func() { procDir = old })
+}
+
+func TestReadProcStatus(t *testing.T) {
+	useProcDir(t, "testdata/proc")
+	st, err := ReadProcStatus(fixturePID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ProcStatus{RSS: 100 << 20, HWM: 200 << 20, Threads: 12}); st != want {
+		t.Errorf("ReadProcStatus = %+v, want %+v", st, want)
+	}
+	if _, err := ReadProcStatus(1); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing pid: err = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestFill(t *testing.T) {
+	m := &runtimeMetrics{Metrics: map[string]float64{
+		"/sched/goroutines:goroutines":       50,
+		"/memory/classes/heap/objects:bytes": 4 << 20,
+		"/memory/classes/heap/stacks:bytes":  512 << 10,
+		"/memory/classes/os-stacks:bytes":    512 << 10,
+		"/memory/classes/total:bytes":        16 << 20,
+		"/gc/cycles/total:gc-cycles":         7,
+		"/cpu/classes/gc/total:cpu-seconds":  1.5,
+		"/cpu/classes/total:cpu-seconds":     10,
+	}}
+	var first Sample
+	m.fill(&first, nil)
+	if first.Goroutines != 50 || first.HeapObjects != 4<<20 || first.GoTotal != 16<<20 || first.GCCycles != 7 {
+		t.Errorf("fill = %+v", first)
+	}
+	if first.Stacks != 1<<20 {
+		t.Errorf("stacks = %d, want goroutine and OS stacks summed to %d", first.Stacks, 1<<20)
+	}
+	if first.GCCPU != 0 {
+		t.Errorf("first sample GC CPU = %v, want 0 without a previous sample", first.GCCPU)
+	}
+
+	// GC CPU 占比按两次采样之间的增量计算
+	m.Metrics["/cpu/classes/gc/total:cpu-seconds"] = 2
+	m.Metrics["/cpu/classes/total:cpu-seconds"] = 12
+	var second Sample
+	m.fill(&second, &first)
+	if second.GCCPU != 0.25 {
+		t.Errorf("GC CPU = %v, want 0.25", second.GCCPU)
+	}
+}
+
+// adminServer 提供 /debug/runtime-metrics；fail 返回 true 时这次请求返回 500
+func adminServer(t *testing.T, fail func(n int64) bool) *httptest.Server {
+	t.Helper()
+	var requests atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/debug/runtime-metrics" {
+			http.NotFound(w, r)
+			return
+		}
+		n := requests.Add(1)
+		if fail(n) {
+			http.Error(w, "busy", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(runtimeMetrics{
+			PID:     fixturePID,
+			Metrics: map[string]float64{"/sched/goroutines:goroutines": float64(n)},
+		})
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func record(t *testing.T, rec *Recorder) []Sample {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	samples, err := rec.Record(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("Record did not stop when the process went away")
+	}
+	return samples
+}
+
+// 一次失败的请求只跳过这个点；/proc/<pid> 消失后结束
+func TestRecordSkipsTransientErrors(t *testing.T) {
+	dir := t.TempDir()
+	pidDir := filepath.Join(dir, "4242")
+	if err := os.Mkdir(pidDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	status, err := os.ReadFile("testdata/proc/4242/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(pidDir, "status"), status, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	useProcDir(t, dir)
+
+	ts := adminServer(t, func(n int64) bool { return n == 2 })
+	rec := &Recorder{
+		Source:   Source{Admin: ts.URL},
+		Interval: 5 * time.Millisecond,
+		OnSample: func(s Sample) {
+			if s.Goroutines == 3 {
+				os.RemoveAll(pidDir)
+			}
+		},
+	}
+	samples := record(t, rec)
+	if len(samples) != 2 {
+		t.Fatalf("got %d samples, want 2", len(samples))
+	}
+	if samples[0].Goroutines != 1 || samples[1].Goroutines != 3 {
+		t.Errorf("goroutines = %d, %d; want 1, 3 (request 2 failed)", samples[0].Goroutines, samples[1].Goroutines)
+	}
+	if samples[1].RSS != 100<<20 || samples[1].Threads != 12 {
+		t.Errorf("proc status not merged: %+v", samples[1])
+	}
+}
+
+// 管理端口拒绝连接说明进程已经退出
+func TestRecordStopsOnConnectionRefused(t *testing.T) {
+	useProcDir(t, "testdata/proc")
+	ts := adminServer(t, func(int64) bool { return false })
+	rec := &Recorder{
+		Source:   Source{Admin: ts.URL},
+		Interval: 5 * time.Millisecond,
+		OnSample: func(s Sample) {
+			if s.Goroutines == 2 {
+				ts.Close()
+			}
+		},
+	}
+	if samples := record(t, rec); len(samples) != 2 {
+		t.Errorf("got %d samples, want 2", len(samples))
+	}
+}
+
+// 第一个点就采集失败时返回错误
+func TestRecordFirstSampleError(t *testing.T) {
+	useProcDir(t, t.TempDir())
+	rec := &Recorder{Source: Source{PID: fixturePID}}
+	if _, err := rec.Record(context.Background()); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("err = %v, want fs.ErrNotExist", err)
+	}
+	if _, err := (&Recorder{}).Record(context.Background()); err == nil {
+		t.Error("Record without pid or admin address should fail")
+	}
+}
+
+func testSamples() []Sample {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return []Sample{
+		{Time: start, RSS: 100 << 20, HWM: 100 << 20, Threads: 8, Goroutines: 10, HeapObjects: 40 << 20, GCCycles: 1},
+		{Time: start.Add(1500 * time.Millisecond), Elapsed: 1500 * time.Millisecond,
+			RSS: 300 << 20, HWM: 300 << 20, Threads: 12, Goroutines: 200, HeapObjects: 120 << 20, GCCycles: 4, GCCPU: 0.125},
+		{Time: start.Add(3 * time.Second), Elapsed: 3 * time.Second,
+			RSS: 200 << 20, HWM: 300 << 20, Threads: 12, Goroutines: 20, HeapObjects: 60 << 20, GCCycles: 6},
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteCSV(&b, testSamples()); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("got %d rows, want header and 3 samples", len(rows))
+	}
+	if strings.Join(rows[0], ",") != strings.Join(csvHeader, ",") {
+		t.Errorf("header = %v", rows[0])
+	}
+	row := rows[2]
+	for i, want := range map[int]string{
+		0:  "2024-01-01T00:00:01.5Z",
+		1:  "1.500",
+		2:  "314572800",
+		4:  "12",
+		5:  "200",
+		13: "4",
+		14: "0.1250",
+	} {
+		if row[i] != want {
+			t.Errorf("%s = %q, want %q", csvHeader[i], row[i], want)
+		}
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteHTML(&b, "upload <test>", testSamples()); err != nil {
+		t.Fatal(err)
+	}
+	html := b.String()
+	for _, want := range []string{
+		"<title>upload &lt;test&gt;</title>",
+		"3 samples over 3s",
+		"peak RSS 300.0MB at 2s",
+		"<h2>Memory (MB)</h2>",
+		"<h2>Goroutines and threads</h2>",
+		"RSS (VmRSS) (last 200)",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML report missing %q", want)
+		}
+	}
+	if n := strings.Count(html, "<polyline"); n != 12 {
+		t.Errorf("got %d lines, want 12", n)
+	}
+
+	// 没有样本时仍然输出空图表
+	b.Reset()
+	if err := WriteHTML(&b, "empty", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "0 samples") || strings.Contains(b.String(), "<polyline") {
+		t.Errorf("empty report:\n%s", b.String())
+	}
+}
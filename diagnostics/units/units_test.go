@@ -0,0 +1,43 @@
+package units
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in       string
+		want     int64
+		wantFail bool
+	}{
+		{in: "1048576", want: 1 << 20},
+		{in: "0", want: 0},
+		{in: "512B", want: 512},
+		{in: "64KiB", want: 64 << 10},
+		{in: "512MiB", want: 512 << 20},
+		{in: "1GiB", want: 1 << 30},
+		{in: "2TiB", want: 2 << 40},
+		{in: "100KB", want: 100e3},
+		{in: "100MB", want: 100e6},
+		{in: "3GB", want: 3e9},
+		{in: "1TB", want: 1e12},
+		{in: " 16 MiB ", want: 16 << 20},
+		{in: "", wantFail: true},
+		{in: "MiB", wantFail: true},
+		{in: "-1MiB", wantFail: true},
+		{in: "1.5GiB", wantFail: true},
+		{in: "10mb", wantFail: true},
+		{in: "8388608TiB", wantFail: true},
+		{in: "9223372036854775807", want: 1<<63 - 1},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if tt.wantFail {
+			if err == nil {
+				t.Errorf("ParseSize(%q) = %d, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
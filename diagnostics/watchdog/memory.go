@@ -0,0 +1,124 @@
+package watchdog
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/units"
+)
+
+// MemoryOptions 内存上限（GOMEMLIMIT）以及 heap 的软、硬阈值
+type MemoryOptions struct {
+	// Limit 传给 debug.SetMemoryLimit 的上限，例如 256MiB；空字符串表示沿用 GOMEMLIMIT 环境变量
+	Limit string
+	// SoftMB heap inuse 的软阈值：保存 heap profile 并打印摘要；0 表示取上限的 70%
+	SoftMB int
+	// HardMB heap inuse 的硬阈值：额外强制一次 GC，对比回收前后区分可回收的垃圾和真正的持有；
+	// 0 表示取上限的 90%
+	HardMB int
+}
+
+// MemoryFlags 在 fs 上注册内存上限相关的 flag
+func MemoryFlags(fs *flag.FlagSet, defaults MemoryOptions) *MemoryOptions {
+	opts := defaults
+	fs.StringVar(&opts.Limit, "memory-limit", opts.Limit, "soft memory limit passed to debug.SetMemoryLimit, e.g. 256MiB (empty keeps GOMEMLIMIT)")
+	fs.IntVar(&opts.SoftMB, "heap-soft-mb", opts.SoftMB, "heap inuse soft threshold in MB: dump heap and log a summary (0 uses 70% of the memory limit)")
+	fs.IntVar(&opts.HardMB, "heap-hard-mb", opts.HardMB, "heap inuse hard threshold in MB: also force a GC to show what is reclaimable (0 uses 90% of the memory limit)")
+	return &opts
+}
+
+// Apply 设置内存上限并返回生效的上限（字节），以及换算后的软、硬阈值（MB）；
+// 没有任何上限时 limit 为 0
+func (o MemoryOptions) Apply() (limit int64, softMB, hardMB int, err error) {
+	if o.Limit != "" {
+		limit, err = units.ParseSize(o.Limit)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid memory limit: %w", err)
+		}
+		if limit > 0 {
+			debug.SetMemoryLimit(limit)
+		}
+	}
+	// 负数只查询当前值，会包含 GOMEMLIMIT 环境变量的设置
+	limit = debug.SetMemoryLimit(-1)
+	if limit == math.MaxInt64 {
+		limit = 0
+	}
+
+	softMB, hardMB = o.SoftMB, o.HardMB
+	if limit > 0 {
+		if softMB == 0 {
+			softMB = int(limit * 7 / 10 >> 20)
+		}
+		if hardMB == 0 {
+			hardMB = int(limit * 9 / 10 >> 20)
+		}
+	}
+	return limit, softMB, hardMB, nil
+}
+
+// HeapRules 生成 heap-soft、heap-hard 两条规则，阈值为 0 的规则不启用
+func HeapRules(softMB, hardMB int) []Rule {
+	var rules []Rule
+	add := func(name string, mb int) {
+		if mb <= 0 {
+			return
+		}
+		limit := uint64(mb) << 20
+		rules = append(rules, Rule{Name: name, Check: func(cur Sample, _ []Sample) string {
+			if cur.HeapInuse <= limit {
+				return ""
+			}
+			return fmt.Sprintf("heap inuse %s > %s threshold %dMB", formatMB(cur.HeapInuse), strings.TrimPrefix(name, "heap-"), mb)
+		}})
+	}
+	add("heap-soft", softMB)
+	add("heap-hard", hardMB)
+	return rules
+}
+
+// HeapSummary 一行 heap 摘要；inuse 与 live 之差是下一次 GC 可以回收的垃圾
+func HeapSummary(s Sample) string {
+	limit := "none"
+	if s.MemoryLimit > 0 && s.MemoryLimit < math.MaxInt64 {
+		limit = formatMB(s.MemoryLimit)
+	}
+	garbage := uint64(0)
+	if s.HeapObjects > s.HeapLive {
+		garbage = s.HeapObjects - s.HeapLive
+	}
+	return fmt.Sprintf("heap inuse=%s objects=%s live=%s garbage~%s goal=%s released=%s total=%s limit=%s gc=%d gc_cpu=%.1f%%",
+		formatMB(s.HeapInuse), formatMB(s.HeapObjects), formatMB(s.HeapLive), formatMB(garbage),
+		formatMB(s.HeapGoal), formatMB(s.HeapReleased), formatMB(s.TotalMemory), limit, s.GCCycles, s.GCCPUFraction*100)
+}
+
+// HeapHandler 返回 OnTrigger 回调：打印 heap 摘要；heap-hard 触发时强制 GC，
+// 回收后仍然很高说明是真正的持有，明显下降说明只是 GC 还没来得及回收的临时分配
+func HeapHandler(logf func(format string, args ...any)) func(Trigger) {
+	return func(t Trigger) {
+		logf("📦 %s", HeapSummary(t.Sample))
+		for _, r := range t.Rules {
+			if r != "heap-hard" {
+				continue
+			}
+			runtime.GC()
+			after := ReadSample(nil)
+			reclaimed := int64(t.Sample.HeapInuse) - int64(after.HeapInuse)
+			verdict := "mostly retained: live objects are being held"
+			if after.HeapInuse < t.Sample.HeapInuse/2 {
+				verdict = "mostly reclaimable: heap growth was GC churn"
+			}
+			logf("🧹 Forced GC: heap inuse %s -> %s (reclaimed %s), live %s, %s",
+				formatMB(t.Sample.HeapInuse), formatMB(after.HeapInuse), formatMB(uint64(max(reclaimed, 0))),
+				formatMB(after.HeapLive), verdict)
+		}
+	}
+}
+
+func formatMB(b uint64) string {
+	return fmt.Sprintf("%.1fMB", float64(b)/(1<<20))
+}
@@ -0,0 +1,58 @@
+package watchdog
+
+import (
+	"flag"
+	"time"
+)
+
+// Options watchdog 的配置；阈值为 0 的规则不启用
+type Options struct {
+	// Name 日志前缀，同时作为快照目录名的前缀
+	Name string
+	// Dir 快照输出目录，每次触发生成一个子目录
+	Dir string
+	// Interval 采样间隔，0 表示关闭 watchdog
+	Interval time.Duration
+	// Cooldown 同一条规则两次触发快照的最小间隔
+	Cooldown time.Duration
+	// MaxCaptures 进程生命周期内最多生成的快照数，0 表示不限制
+	MaxCaptures int
+	// CPUDuration 快照中 CPU profile 的采样时长，0 表示不采集 CPU profile
+	CPUDuration time.Duration
+
+	// MaxGoroutines goroutine 数量上限
+	MaxGoroutines int
+	// GoroutineGrowth 每秒 goroutine 增长上限，在 GrowthWindow 时间窗口内计算
+	GoroutineGrowth float64
+	// GrowthWindow 计算增长率的时间窗口
+	GrowthWindow time.Duration
+	// MaxHeapInuseMB heap inuse 上限（MB）
+	MaxHeapInuseMB int
+	// MaxGCCPUFraction 两次采样之间 GC 占用 CPU 的比例上限，例如 0.25
+	MaxGCCPUFraction float64
+}
+
+// Flags 在 fs 上注册 watchdog 相关的 flag，defaults 提供各程序自己的默认值
+func Flags(fs *flag.FlagSet, defaults Options) *Options {
+	opts := defaults
+	if opts.Dir == "" {
+		opts.Dir = "watchdog"
+	}
+	if opts.Cooldown == 0 {
+		opts.Cooldown = time.Minute
+	}
+	if opts.GrowthWindow == 0 {
+		opts.GrowthWindow = 10 * time.Second
+	}
+	fs.StringVar(&opts.Dir, "watchdog-dir", opts.Dir, "directory for watchdog snapshots")
+	fs.DurationVar(&opts.Interval, "watchdog-interval", opts.Interval, "watchdog sampling interval (0 disables the watchdog)")
+	fs.DurationVar(&opts.Cooldown, "watchdog-cooldown", opts.Cooldown, "minimum time between two snapshots triggered by the same rule")
+	fs.IntVar(&opts.MaxCaptures, "watchdog-max-captures", opts.MaxCaptures, "max snapshots written by this process (0 for unlimited)")
+	fs.DurationVar(&opts.CPUDuration, "watchdog-cpu-duration", opts.CPUDuration, "CPU profile duration in each snapshot (0 skips the CPU profile)")
+	fs.IntVar(&opts.MaxGoroutines, "watchdog-goroutines", opts.MaxGoroutines, "trigger when goroutine count exceeds this (0 disables)")
+	fs.Float64Var(&opts.GoroutineGrowth, "watchdog-goroutine-growth", opts.GoroutineGrowth, "trigger when goroutines grow faster than this per second (0 disables)")
+	fs.DurationVar(&opts.GrowthWindow, "watchdog-growth-window", opts.GrowthWindow, "time window for the goroutine growth rate")
+	fs.IntVar(&opts.MaxHeapInuseMB, "watchdog-heap-inuse-mb", opts.MaxHeapInuseMB, "trigger when heap inuse exceeds this many MB (0 disables)")
+	fs.Float64Var(&opts.MaxGCCPUFraction, "watchdog-gc-cpu", opts.MaxGCCPUFraction, "trigger when GC uses more than this fraction of CPU between samples (0 disables)")
+	return &opts
+}
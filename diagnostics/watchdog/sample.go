@@ -0,0 +1,89 @@
+package watchdog
+
+import (
+	"runtime/metrics"
+	"time"
+)
+
+// Sample 一次运行时指标采样
+type Sample struct {
+	Time       time.Time `json:"time"`
+	Goroutines int       `json:"goroutines"`
+	// HeapInuse 与 runtime.MemStats.HeapInuse 含义相同：已分配对象加上 span 内未使用的部分
+	HeapInuse uint64 `json:"heap_inuse"`
+	// HeapObjects 堆上对象占用的字节数，包含还没被回收的垃圾
+	HeapObjects uint64 `json:"heap_objects"`
+	// HeapLive 上一次 GC 标记结束时仍然存活的字节数，也就是真正被持有的内存
+	HeapLive uint64 `json:"heap_live"`
+	// HeapGoal 下一次 GC 的目标堆大小
+	HeapGoal uint64 `json:"heap_goal"`
+	// HeapReleased 已经归还给操作系统的堆内存
+	HeapReleased uint64 `json:"heap_released"`
+	// TotalMemory Go runtime 向操作系统申请的全部内存
+	TotalMemory uint64 `json:"total_memory"`
+	// MemoryLimit 当前的 GOMEMLIMIT，未设置时为 math.MaxInt64
+	MemoryLimit uint64 `json:"memory_limit"`
+	// GCCycles 累计完成的 GC 次数
+	GCCycles uint64 `json:"gc_cycles"`
+	// GCCPUFraction 与上一次采样之间 GC 占用的 CPU 比例
+	GCCPUFraction float64 `json:"gc_cpu_fraction"`
+
+	gcCPU    float64
+	totalCPU float64
+}
+
+var sampleMetrics = []string{
+	"/sched/goroutines:goroutines",
+	"/memory/classes/heap/objects:bytes",
+	"/memory/classes/heap/unused:bytes",
+	"/gc/heap/goal:bytes",
+	"/cpu/classes/gc/total:cpu-seconds",
+	"/cpu/classes/total:cpu-seconds",
+	"/gc/heap/live:bytes",
+	"/memory/classes/heap/released:bytes",
+	"/memory/classes/total:bytes",
+	"/gc/gomemlimit:bytes",
+	"/gc/cycles/total:gc-cycles",
+}
+
+// ReadSample 读取当前的运行时指标；prev 用于计算区间内的 GC CPU 比例，可以为 nil
+func ReadSample(prev *Sample) Sample {
+	samples := make([]metrics.Sample, len(sampleMetrics))
+	for i, name := range sampleMetrics {
+		samples[i].Name = name
+	}
+	metrics.Read(samples)
+
+	s := Sample{Time: time.Now()}
+	s.Goroutines = int(uint64Value(samples[0]))
+	s.HeapObjects = uint64Value(samples[1])
+	s.HeapInuse = s.HeapObjects + uint64Value(samples[2])
+	s.HeapGoal = uint64Value(samples[3])
+	s.gcCPU = float64Value(samples[4])
+	s.totalCPU = float64Value(samples[5])
+	s.HeapLive = uint64Value(samples[6])
+	s.HeapReleased = uint64Value(samples[7])
+	s.TotalMemory = uint64Value(samples[8])
+	s.MemoryLimit = uint64Value(samples[9])
+	s.GCCycles = uint64Value(samples[10])
+	if prev != nil {
+		if total := s.totalCPU - prev.totalCPU; total > 0 {
+			s.GCCPUFraction = (s.gcCPU - prev.gcCPU) / total
+		}
+	}
+	return s
+}
+
+func uint64Value(s metrics.Sample) uint64 {
+	if s.Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return s.Value.Uint64()
+}
+
+func float64Value(s metrics.Sample) float64 {
+	if s.Value.Kind() != metrics.KindFloat64 {
+		return 0
+	}
+	return s.Value.Float64()
+}
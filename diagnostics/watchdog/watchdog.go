@@ -0,0 +1,254 @@
+// Package watchdog 在进程内定期采样 goroutine 数量、heap inuse、GC CPU 比例等运行时指标，
+// 规则触发时自动把 goroutine(debug=2)、heap 和一段 CPU profile 写到磁盘，
+// 这样即使没人盯着日志，泄漏现场也能被保留下来。
+package watchdog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"time"
+)
+
+// Rule 一条触发规则；Check 返回触发原因，未触发时返回空字符串。
+// history 是 GrowthWindow 内按时间顺序排列的历史采样，最后一个元素就是 cur
+type Rule struct {
+	Name  string
+	Check func(cur Sample, history []Sample) string
+}
+
+// Rules 根据 opts 中的阈值生成内置规则
+func Rules(opts Options) []Rule {
+	var rules []Rule
+	if opts.MaxGoroutines > 0 {
+		rules = append(rules, Rule{Name: "goroutines", Check: func(cur Sample, _ []Sample) string {
+			if cur.Goroutines <= opts.MaxGoroutines {
+				return ""
+			}
+			return fmt.Sprintf("goroutines %d > %d", cur.Goroutines, opts.MaxGoroutines)
+		}})
+	}
+	if opts.GoroutineGrowth > 0 {
+		rules = append(rules, Rule{Name: "goroutine-growth", Check: func(cur Sample, history []Sample) string {
+			oldest := history[0]
+			elapsed := cur.Time.Sub(oldest.Time)
+			// 窗口还没填满时不计算，避免启动阶段的抖动
+			if elapsed < opts.GrowthWindow {
+				return ""
+			}
+			rate := float64(cur.Goroutines-oldest.Goroutines) / elapsed.Seconds()
+			if rate <= opts.GoroutineGrowth {
+				return ""
+			}
+			return fmt.Sprintf("goroutines grew %d -> %d in %v (%.1f/s > %.1f/s)",
+				oldest.Goroutines, cur.Goroutines, elapsed.Round(time.Second), rate, opts.GoroutineGrowth)
+		}})
+	}
+	if opts.MaxHeapInuseMB > 0 {
+		limit := uint64(opts.MaxHeapInuseMB) << 20
+		rules = append(rules, Rule{Name: "heap-inuse", Check: func(cur Sample, _ []Sample) string {
+			if cur.HeapInuse <= limit {
+				return ""
+			}
+			return fmt.Sprintf("heap inuse %.1fMB > %dMB", float64(cur.HeapInuse)/(1<<20), opts.MaxHeapInuseMB)
+		}})
+	}
+	if opts.MaxGCCPUFraction > 0 {
+		rules = append(rules, Rule{Name: "gc-cpu", Check: func(cur Sample, _ []Sample) string {
+			if cur.GCCPUFraction <= opts.MaxGCCPUFraction {
+				return ""
+			}
+			return fmt.Sprintf("GC CPU fraction %.1f%% > %.1f%%", cur.GCCPUFraction*100, opts.MaxGCCPUFraction*100)
+		}})
+	}
+	return rules
+}
+
+// Trigger 一次快照的触发信息，写入快照目录下的 trigger.json
+type Trigger struct {
+	Rules   []string `json:"rules"`
+	Reasons []string `json:"reasons"`
+	Sample  Sample   `json:"sample"`
+	Files   []string `json:"files"`
+}
+
+// Watchdog 进程内的运行时指标看门狗
+type Watchdog struct {
+	opts  Options
+	rules []Rule
+
+	history   []Sample
+	lastFired map[string]time.Time
+	captures  int
+	hooks     []func(Trigger)
+}
+
+// New 创建 watchdog，rules 为空时使用 Rules(opts) 生成的内置规则
+func New(opts Options, rules ...Rule) *Watchdog {
+	if len(rules) == 0 {
+		rules = Rules(opts)
+	}
+	if opts.Cooldown == 0 {
+		opts.Cooldown = time.Minute
+	}
+	return &Watchdog{
+		opts:      opts,
+		rules:     rules,
+		lastFired: make(map[string]time.Time),
+	}
+}
+
+// OnTrigger 注册规则触发后执行的回调，在快照写完之后调用
+func (w *Watchdog) OnTrigger(fn func(Trigger)) {
+	w.hooks = append(w.hooks, fn)
+}
+
+// Enabled 是否配置了采样间隔和至少一条规则
+func (w *Watchdog) Enabled() bool {
+	return w.opts.Interval > 0 && len(w.rules) > 0
+}
+
+// Run 按 Interval 采样并检查规则，直到 ctx 结束；未启用时立即返回
+func (w *Watchdog) Run(ctx context.Context) {
+	if !w.Enabled() {
+		return
+	}
+	names := make([]string, len(w.rules))
+	for i, r := range w.rules {
+		names[i] = r.Name
+	}
+	w.Logf("Watchdog started: rules=%s interval=%v cooldown=%v dir=%s",
+		strings.Join(names, ","), w.opts.Interval, w.opts.Cooldown, w.opts.Dir)
+
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Check(ctx)
+		}
+	}
+}
+
+// Check 采样一次并检查所有规则，有规则触发且不在冷却期内时生成快照
+func (w *Watchdog) Check(ctx context.Context) {
+	var prev *Sample
+	if len(w.history) > 0 {
+		prev = &w.history[len(w.history)-1]
+	}
+	cur := ReadSample(prev)
+	w.history = append(w.history, cur)
+	// 只保留覆盖 GrowthWindow 所需的历史采样
+	for len(w.history) > 2 && cur.Time.Sub(w.history[1].Time) >= w.opts.GrowthWindow {
+		w.history = w.history[1:]
+	}
+
+	var trig Trigger
+	for _, r := range w.rules {
+		reason := r.Check(cur, w.history)
+		if reason == "" {
+			continue
+		}
+		if last, ok := w.lastFired[r.Name]; ok && cur.Time.Sub(last) < w.opts.Cooldown {
+			continue
+		}
+		trig.Rules = append(trig.Rules, r.Name)
+		trig.Reasons = append(trig.Reasons, reason)
+	}
+	if len(trig.Rules) == 0 {
+		return
+	}
+	for _, name := range trig.Rules {
+		w.lastFired[name] = cur.Time
+	}
+	trig.Sample = cur
+	defer func() {
+		for _, fn := range w.hooks {
+			fn(trig)
+		}
+	}()
+
+	if w.opts.MaxCaptures > 0 && w.captures >= w.opts.MaxCaptures {
+		w.Logf("⚠️  Watchdog triggered (%s) but max captures %d reached, skipping snapshot",
+			strings.Join(trig.Reasons, "; "), w.opts.MaxCaptures)
+		return
+	}
+	w.captures++
+	dir, err := w.capture(ctx, &trig)
+	if err != nil {
+		w.Logf("❌ Watchdog snapshot %s incomplete (%s): %v", dir, strings.Join(trig.Reasons, "; "), err)
+		return
+	}
+	w.Logf("📸 Watchdog triggered: %s -> %s", strings.Join(trig.Reasons, "; "), dir)
+}
+
+// capture 把 goroutine、heap 和 CPU profile 写入一个新的快照目录
+func (w *Watchdog) capture(ctx context.Context, trig *Trigger) (string, error) {
+	name := trig.Sample.Time.Format("20060102-150405") + "-" + strings.Join(trig.Rules, "+")
+	if w.opts.Name != "" {
+		name = w.opts.Name + "-" + name
+	}
+	dir := filepath.Join(w.opts.Dir, name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return dir, err
+	}
+
+	var errs []error
+	write := func(file string, fn func(f *os.File) error) {
+		f, err := os.Create(filepath.Join(dir, file))
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		err = fn(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file, err))
+			return
+		}
+		trig.Files = append(trig.Files, file)
+	}
+
+	write("goroutine.txt", func(f *os.File) error { return pprof.Lookup("goroutine").WriteTo(f, 2) })
+	write("heap.prof", func(f *os.File) error { return pprof.Lookup("heap").WriteTo(f, 0) })
+	if w.opts.CPUDuration > 0 {
+		write("cpu.prof", func(f *os.File) error {
+			// 已有 CPU profile 在进行（例如有人正在请求 /debug/pprof/profile）时会返回错误
+			if err := pprof.StartCPUProfile(f); err != nil {
+				return err
+			}
+			select {
+			case <-time.After(w.opts.CPUDuration):
+			case <-ctx.Done():
+			}
+			pprof.StopCPUProfile()
+			return nil
+		})
+	}
+
+	write("trigger.json", func(f *os.File) error {
+		enc := json.NewEncoder(f)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(trig)
+	})
+	return dir, errors.Join(errs...)
+}
+
+// Logf 带 Name 前缀打印日志
+func (w *Watchdog) Logf(format string, args ...any) {
+	if w.opts.Name != "" {
+		format = "[" + w.opts.Name + "] " + format
+	}
+	log.Printf(format, args...)
+}
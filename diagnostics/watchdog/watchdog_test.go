@@ -0,0 +1,249 @@
+package watchdog
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// history 按 step 间隔生成 goroutine 数依次为 counts 的采样
+func history(step time.Duration, counts ...int) []Sample {
+	var h []Sample
+	for i, n := range counts {
+		h = append(h, Sample{Time: t0.Add(time.Duration(i) * step), Goroutines: n})
+	}
+	return h
+}
+
+// rule 按名字取出规则，不存在时测试失败
+func rule(t *testing.T, rules []Rule, name string) Rule {
+	t.Helper()
+	for _, r := range rules {
+		if r.Name == name {
+			return r
+		}
+	}
+	t.Fatalf("rule %q not found", name)
+	return Rule{}
+}
+
+func TestRulesDisabled(t *testing.T) {
+	if rules := Rules(Options{}); len(rules) != 0 {
+		t.Errorf("Rules without thresholds = %d rules, want none", len(rules))
+	}
+	if rules := HeapRules(0, 0); len(rules) != 0 {
+		t.Errorf("HeapRules(0, 0) = %d rules, want none", len(rules))
+	}
+}
+
+func TestThresholdRules(t *testing.T) {
+	rules := Rules(Options{MaxGoroutines: 100, MaxHeapInuseMB: 64, MaxGCCPUFraction: 0.25})
+	tests := []struct {
+		rule  string
+		cur   Sample
+		fired bool
+	}{
+		{"goroutines", Sample{Goroutines: 100}, false},
+		{"goroutines", Sample{Goroutines: 101}, true},
+		{"heap-inuse", Sample{HeapInuse: 64 << 20}, false},
+		{"heap-inuse", Sample{HeapInuse: 64<<20 + 1}, true},
+		{"gc-cpu", Sample{GCCPUFraction: 0.25}, false},
+		{"gc-cpu", Sample{GCCPUFraction: 0.3}, true},
+	}
+	for _, tt := range tests {
+		reason := rule(t, rules, tt.rule).Check(tt.cur, []Sample{tt.cur})
+		if (reason != "") != tt.fired {
+			t.Errorf("%s on %+v: reason %q, fired want %v", tt.rule, tt.cur, reason, tt.fired)
+		}
+	}
+}
+
+func TestGoroutineGrowth(t *testing.T) {
+	growth := rule(t, Rules(Options{GoroutineGrowth: 10, GrowthWindow: 10 * time.Second}), "goroutine-growth")
+	tests := []struct {
+		name    string
+		history []Sample
+		want    string
+	}{
+		// 窗口没填满：5 秒内增长 500 也不触发
+		{"window not full", history(time.Second, 0, 100, 200, 300, 400, 500), ""},
+		{"steady", history(5*time.Second, 100, 100, 150), ""},
+		{"exactly at the limit", history(5*time.Second, 100, 150, 200), ""},
+		{"fast growth", history(5*time.Second, 100, 200, 400), "goroutines grew 100 -> 400 in 10s (30.0/s > 10.0/s)"},
+		// 只和窗口内最早的采样比较
+		{"shrinking", history(5*time.Second, 400, 200, 100), ""},
+	}
+	for _, tt := range tests {
+		cur := tt.history[len(tt.history)-1]
+		if got := growth.Check(cur, tt.history); got != tt.want {
+			t.Errorf("%s: reason = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHeapRules(t *testing.T) {
+	rules := HeapRules(100, 200)
+	if len(rules) != 2 {
+		t.Fatalf("got %d rules, want heap-soft and heap-hard", len(rules))
+	}
+	soft, hard := rule(t, rules, "heap-soft"), rule(t, rules, "heap-hard")
+	tests := []struct {
+		inuse      uint64
+		soft, hard bool
+	}{
+		{100 << 20, false, false},
+		{150 << 20, true, false},
+		{250 << 20, true, true},
+	}
+	for _, tt := range tests {
+		cur := Sample{HeapInuse: tt.inuse}
+		if got := soft.Check(cur, nil) != ""; got != tt.soft {
+			t.Errorf("heap-soft at %s fired = %v, want %v", formatMB(tt.inuse), got, tt.soft)
+		}
+		if got := hard.Check(cur, nil) != ""; got != tt.hard {
+			t.Errorf("heap-hard at %s fired = %v, want %v", formatMB(tt.inuse), got, tt.hard)
+		}
+	}
+	if got, want := hard.Check(Sample{HeapInuse: 250 << 20}, nil), "heap inuse 250.0MB > hard threshold 200MB"; got != want {
+		t.Errorf("heap-hard reason = %q, want %q", got, want)
+	}
+
+	if rules := HeapRules(100, 0); len(rules) != 1 || rules[0].Name != "heap-soft" {
+		t.Errorf("HeapRules(100, 0) should only enable heap-soft: %+v", rules)
+	}
+}
+
+// always 每次检查都触发的规则
+func always(name string) Rule {
+	return Rule{Name: name, Check: func(Sample, []Sample) string { return name + " fired" }}
+}
+
+// newWatchdog 创建快照写到临时目录的 watchdog，返回每次回调收到的 Trigger
+func newWatchdog(t *testing.T, opts Options, rules ...Rule) (*Watchdog, *[]Trigger) {
+	t.Helper()
+	opts.Dir = t.TempDir()
+	w := New(opts, rules...)
+	var got []Trigger
+	w.OnTrigger(func(trig Trigger) { got = append(got, trig) })
+	return w, &got
+}
+
+func snapshots(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestCheckCapture(t *testing.T) {
+	w, triggers := newWatchdog(t, Options{Name: "test"}, always("a"), always("b"), Rule{Name: "never", Check: func(Sample, []Sample) string { return "" }})
+	w.Check(context.Background())
+
+	if len(*triggers) != 1 {
+		t.Fatalf("got %d triggers, want 1", len(*triggers))
+	}
+	trig := (*triggers)[0]
+	if strings.Join(trig.Rules, ",") != "a,b" || strings.Join(trig.Reasons, ";") != "a fired;b fired" {
+		t.Errorf("trigger rules %v, reasons %v", trig.Rules, trig.Reasons)
+	}
+	dirs := snapshots(t, w.opts.Dir)
+	if len(dirs) != 1 || !strings.HasPrefix(dirs[0], "test-") || !strings.HasSuffix(dirs[0], "-a+b") {
+		t.Fatalf("snapshot dirs = %v, want one test-<time>-a+b", dirs)
+	}
+	dir := filepath.Join(w.opts.Dir, dirs[0])
+	if got := strings.Join(snapshots(t, dir), ","); got != "goroutine.txt,heap.prof,trigger.json" {
+		t.Errorf("snapshot files = %s", got)
+	}
+	if g, err := os.ReadFile(filepath.Join(dir, "goroutine.txt")); err != nil || !strings.Contains(string(g), "TestCheckCapture") {
+		t.Errorf("goroutine dump should contain the test goroutine: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "trigger.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved Trigger
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(saved.Files, ",") != "goroutine.txt,heap.prof" || saved.Sample.Goroutines == 0 {
+		t.Errorf("trigger.json = %+v", saved)
+	}
+}
+
+// 冷却期内同一条规则不再触发
+func TestCheckCooldown(t *testing.T) {
+	w, triggers := newWatchdog(t, Options{Cooldown: time.Hour}, always("a"))
+	w.Check(context.Background())
+	w.Check(context.Background())
+	if len(*triggers) != 1 {
+		t.Errorf("got %d triggers within the cooldown, want 1", len(*triggers))
+	}
+
+	// 冷却期按规则分别计算
+	w.rules = append(w.rules, always("b"))
+	w.Check(context.Background())
+	if len(*triggers) != 2 || strings.Join((*triggers)[1].Rules, ",") != "b" {
+		t.Errorf("triggers = %+v, want a second trigger for b only", *triggers)
+	}
+
+	// 冷却期过后再次触发
+	w.lastFired["a"] = time.Now().Add(-2 * time.Hour)
+	w.Check(context.Background())
+	if len(*triggers) != 3 || strings.Join((*triggers)[2].Rules, ",") != "a" {
+		t.Errorf("triggers = %+v, want a after the cooldown", *triggers)
+	}
+}
+
+// 达到 MaxCaptures 后仍然调用回调，但不再写快照
+func TestCheckMaxCaptures(t *testing.T) {
+	w, triggers := newWatchdog(t, Options{Cooldown: time.Nanosecond, MaxCaptures: 1}, always("a"))
+	for i := 0; i < 3; i++ {
+		w.Check(context.Background())
+		time.Sleep(time.Millisecond)
+	}
+	if len(*triggers) != 3 {
+		t.Fatalf("got %d triggers, want 3", len(*triggers))
+	}
+	if files := (*triggers)[0].Files; len(files) == 0 {
+		t.Error("first trigger should have written a snapshot")
+	}
+	for _, trig := range (*triggers)[1:] {
+		if len(trig.Files) != 0 {
+			t.Errorf("snapshot written after max captures: %v", trig.Files)
+		}
+	}
+	if w.captures != 1 {
+		t.Errorf("captures = %d, want 1", w.captures)
+	}
+}
+
+// 历史采样只保留覆盖 GrowthWindow 所需的部分
+func TestCheckTrimsHistory(t *testing.T) {
+	w, _ := newWatchdog(t, Options{GrowthWindow: 5 * time.Millisecond}, Rule{Name: "never", Check: func(Sample, []Sample) string { return "" }})
+	for i := 0; i < 20; i++ {
+		w.Check(context.Background())
+		time.Sleep(time.Millisecond)
+	}
+	if len(w.history) >= 20 {
+		t.Fatalf("history has %d samples, should be trimmed to the growth window", len(w.history))
+	}
+	if span := w.history[len(w.history)-1].Time.Sub(w.history[1].Time); span >= w.opts.GrowthWindow {
+		t.Errorf("history keeps %v beyond the first sample, want less than %v", span, w.opts.GrowthWindow)
+	}
+	if span := w.history[len(w.history)-1].Time.Sub(w.history[0].Time); span < w.opts.GrowthWindow {
+		t.Errorf("history covers %v, want at least the %v growth window", span, w.opts.GrowthWindow)
+	}
+}
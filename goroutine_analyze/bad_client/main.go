@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"runtime"
 	"time"
 
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/watchdog"
+	"github.com/gangcheng1030/ai_production_troubleshooting/goroutine_analyze/grpcchannelz"
 	pb "github.com/gangcheng1030/ai_production_troubleshooting/goroutine_analyze/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -39,7 +42,34 @@ func makeRequestBad() error {
 	return nil
 }
 
+var (
+	// channelz 统计总是打开的（见 grpcchannelz 包注释），这个 flag 只决定是否提供查询服务
+	channelzAddr = flag.String("channelz-addr", "", "serve the grpc channelz service on this address, e.g. localhost:50061 (inspect with go run ./channelz)")
+
+	watchdogOpts = watchdog.Flags(flag.CommandLine, watchdog.Options{
+		Name:            "BadClient",
+		Interval:        time.Second,
+		MaxCaptures:     3,
+		CPUDuration:     time.Second,
+		MaxGoroutines:   500,
+		GoroutineGrowth: 100,
+		GrowthWindow:    5 * time.Second,
+	})
+)
+
 func main() {
+	flag.Parse()
+
+	// channelz 会列出这个进程创建的所有 ClientConn 及其调用计数
+	if *channelzAddr != "" {
+		czAddr, stopChannelz, err := grpcchannelz.Serve(*channelzAddr)
+		if err != nil {
+			log.Fatalf("Failed to serve channelz: %v", err)
+		}
+		defer stopChannelz()
+		log.Printf("Channelz: go run ./channelz -addr %s", czAddr)
+	}
+
 	log.Println("=== Bad Client Demo: 不复用连接，不关闭连接 ===")
 	log.Println("问题：每次请求都 new dial，没有复用连接，也没有释放连接")
 	log.Println("观察：goroutine 数量会持续上涨")
@@ -49,6 +79,11 @@ func main() {
 	log.Printf("初始 goroutine 数量: %d", initialGoroutines)
 	log.Println()
 
+	// goroutine 超过阈值时自动保存快照，测试结束后也能看到泄漏现场
+	ctx, stopWatchdog := context.WithCancel(context.Background())
+	defer stopWatchdog()
+	go watchdog.New(*watchdogOpts).Run(ctx)
+
 	// 模拟持续请求
 	ticker := time.NewTicker(1 * time.Millisecond)
 	defer ticker.Stop()
@@ -94,9 +129,11 @@ func main() {
 			log.Println("   1. 复用连接：在应用启动时创建一次连接，多次请求复用")
 			log.Println("   2. 正确关闭：如果必须创建新连接，使用 defer conn.Close()")
 			log.Println("   3. 使用连接池：对于高并发场景，可以使用连接池管理")
+			log.Println("   4. 服务端兜底：server 设置 -keepalive-max-idle 回收空闲的泄漏连接（见 keepalive_demo.sh）")
 			log.Println()
 			log.Println("🔍 使用 pprof 查看详细信息：")
 			log.Println("   curl http://localhost:50052/debug/pprof/goroutine?debug=2")
+			log.Printf("   watchdog 自动保存的快照: %s/", watchdogOpts.Dir)
 
 			// 等待一段时间以便观察
 			log.Println()
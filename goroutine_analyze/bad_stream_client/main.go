@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"runtime"
+	"time"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/watchdog"
+	pb "github.com/gangcheng1030/ai_production_troubleshooting/goroutine_analyze/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+var (
+	addr    = flag.String("addr", "localhost:50051", "gRPC server address")
+	streams = flag.Int("streams", 200, "number of server-streaming and bidi streams to open (each)")
+	hold    = flag.Duration("hold", 10*time.Second, "how long to keep the process (and its leaked streams) alive after the last stream")
+
+	watchdogOpts = watchdog.Flags(flag.CommandLine, watchdog.Options{
+		Name:            "BadStreamClient",
+		Interval:        time.Second,
+		MaxCaptures:     3,
+		CPUDuration:     time.Second,
+		MaxGoroutines:   500,
+		GoroutineGrowth: 100,
+		GrowthWindow:    5 * time.Second,
+	})
+)
+
+// 问题代码：连接是复用的，但流打开后既不读完也不取消
+func openServerStreamBad(client pb.HelloServiceClient) error {
+	// ❌ 使用不会被取消的 ctx
+	stream, err := client.StreamHellos(context.Background(), &pb.HelloRequest{Name: "World"})
+	if err != nil {
+		return fmt.Errorf("failed to open StreamHellos: %v", err)
+	}
+
+	// ❌ 只读第一条消息就不管了：没有读到 io.EOF，也没有 cancel，
+	// 服务端的 handler 会一直推送下去
+	resp, err := stream.Recv()
+	if err != nil {
+		return fmt.Errorf("failed to receive from StreamHellos: %v", err)
+	}
+	log.Printf("Stream response: %s", resp.Message)
+	return nil
+}
+
+// 问题代码：双向流只发一条消息，既不 CloseSend 也不取消
+func openBidiStreamBad(client pb.HelloServiceClient) error {
+	// ❌ 使用不会被取消的 ctx
+	stream, err := client.Chat(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to open Chat: %v", err)
+	}
+	if err := stream.Send(&pb.HelloRequest{Name: "World"}); err != nil {
+		return fmt.Errorf("failed to send to Chat: %v", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return fmt.Errorf("failed to receive from Chat: %v", err)
+	}
+
+	// ❌ 没有 stream.CloseSend()，服务端的 handler 一直阻塞在 Recv
+	log.Printf("Chat response: %s", resp.Message)
+	return nil
+}
+
+func main() {
+	flag.Parse()
+
+	log.Println("=== Bad Stream Client Demo: 复用连接，但流泄漏 ===")
+	log.Println("问题：打开的服务端流和双向流既不读完，也不取消，也不 CloseSend")
+	log.Println("观察：连接数不变，但 client 和 server 的 goroutine 数量随流的数量上涨")
+	log.Println()
+
+	initialGoroutines := runtime.NumGoroutine()
+	log.Printf("初始 goroutine 数量: %d", initialGoroutines)
+	log.Println()
+
+	// ✅ 连接只创建一次，这个场景里泄漏的是流而不是连接
+	conn, err := grpc.Dial(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	client := pb.NewHelloServiceClient(conn)
+
+	// goroutine 超过阈值时自动保存快照，测试结束后也能看到泄漏现场
+	ctx, stopWatchdog := context.WithCancel(context.Background())
+	defer stopWatchdog()
+	go watchdog.New(*watchdogOpts).Run(ctx)
+
+	// 监控 goroutine 数量
+	go func() {
+		monitorTicker := time.NewTicker(2 * time.Second)
+		defer monitorTicker.Stop()
+		for range monitorTicker.C {
+			current := runtime.NumGoroutine()
+			increase := current - initialGoroutines
+			log.Printf("📊 当前 goroutine: %d (增加了 %d)", current, increase)
+		}
+	}()
+
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+
+	streamCount := 0
+	for range ticker.C {
+		streamCount++
+		if err := openServerStreamBad(client); err != nil {
+			log.Printf("❌ Stream #%d failed: %v", streamCount, err)
+		}
+		if err := openBidiStreamBad(client); err != nil {
+			log.Printf("❌ Chat #%d failed: %v", streamCount, err)
+		}
+
+		if streamCount%50 == 0 {
+			current := runtime.NumGoroutine()
+			log.Printf("⚠️  已打开 %d 个服务端流和 %d 个双向流，goroutine: %d", streamCount, streamCount, current)
+		}
+
+		if streamCount >= *streams {
+			break
+		}
+	}
+
+	log.Println()
+	log.Println("=== 测试完成 ===")
+	finalGoroutines := runtime.NumGoroutine()
+	log.Printf("最终 goroutine 数量: %d", finalGoroutines)
+	log.Printf("泄漏的 goroutine: %d", finalGoroutines-initialGoroutines)
+	log.Println()
+	log.Println("💡 问题原因：")
+	log.Println("   1. 每个流都使用 context.Background()，没有任何地方会取消它")
+	log.Println("   2. 服务端流只读了第一条消息，没有读到 io.EOF")
+	log.Println("   3. 双向流没有调用 CloseSend()，服务端一直阻塞在 Recv")
+	log.Println("   4. 连接没有泄漏，server 上泄漏的是每个流的 handler goroutine")
+	log.Println()
+	log.Println("🔧 解决方案：")
+	log.Println("   1. 每个流使用 context.WithCancel/WithTimeout，并 defer cancel()")
+	log.Println("   2. 不再需要后续消息时取消 ctx，或者一直读到 io.EOF")
+	log.Println("   3. 双向流发送完毕后调用 CloseSend()，再读完剩余的响应")
+	log.Println()
+	log.Println("🔍 使用 pprof 查看详细信息：")
+	log.Println("   curl http://localhost:50052/debug/pprof/goroutine?debug=2")
+	log.Printf("   watchdog 自动保存的快照: %s/", watchdogOpts.Dir)
+
+	// 等待一段时间以便观察；进程退出后连接关闭，server 上的流才会结束
+	log.Println()
+	log.Printf("等待 %v 以便使用 pprof 查看 goroutine 信息...", *hold)
+	time.Sleep(*hold)
+}
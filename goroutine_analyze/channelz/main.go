@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/goroutine_analyze/grpcchannelz"
+	"google.golang.org/grpc"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// 查询 server（-channelz）或客户端（-channelz-addr）的 channelz 服务，以树的形式输出
+// channel → subchannel → socket 及其调用计数，并标出仍然打开但没有调用或长时间空闲的 channel
+
+var (
+	addr     = flag.String("addr", "localhost:50051", "address of a gRPC server with the channelz service registered")
+	timeout  = flag.Duration("timeout", 10*time.Second, "timeout for all channelz queries")
+	idle     = flag.Duration("idle", 5*time.Second, "flag open channels whose last call started at least this long ago (0 disables)")
+	maxNodes = flag.Int("max", 20, "max number of children to print per level (0 for all)")
+	sockets  = flag.Bool("sockets", true, "query and print sockets")
+)
+
+func main() {
+	flag.Parse()
+
+	conn, err := grpc.Dial(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("failed to dial %s: %v", *addr, err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	opts := grpcchannelz.Options{Idle: *idle, MaxChildren: *maxNodes, Sockets: *sockets}
+	report, err := grpcchannelz.Inspect(ctx, channelzpb.NewChannelzClient(conn), opts)
+	if err != nil {
+		log.Fatalf("failed to query channelz on %s: %v", *addr, err)
+	}
+	report.Write(os.Stdout, opts)
+}
@@ -3,6 +3,7 @@ module github.com/gangcheng1030/ai_production_troubleshooting/goroutine_analyze
 go 1.23.9
 
 require (
+	github.com/gangcheng1030/ai_production_troubleshooting/diagnostics v0.0.0
 	google.golang.org/grpc v1.70.0
 	google.golang.org/protobuf v1.36.4
 )
@@ -13,3 +14,5 @@ require (
 	golang.org/x/text v0.21.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20241202173237-19429a94021a // indirect
 )
+
+replace github.com/gangcheng1030/ai_production_troubleshooting/diagnostics => ../diagnostics
@@ -2,11 +2,19 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/watchdog"
+	"github.com/gangcheng1030/ai_production_troubleshooting/goroutine_analyze/grpcchannelz"
+	"github.com/gangcheng1030/ai_production_troubleshooting/goroutine_analyze/grpcpool"
 	pb "github.com/gangcheng1030/ai_production_troubleshooting/goroutine_analyze/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -53,7 +61,172 @@ func (c *GoodClient) MakeRequest() error {
 	return nil
 }
 
+var (
+	addr     = flag.String("addr", "localhost:50051", "gRPC server address")
+	requests = flag.Int("requests", 500, "number of requests to send (per pool size in concurrent mode)")
+	// 并发模式：多个 worker 通过连接池发请求，依次比较不同连接池大小下的 goroutine 数量
+	concurrency = flag.Int("concurrency", 0, "number of concurrent workers sharing a connection pool; 0 runs the sequential single-connection demo")
+	poolSizes   = flag.String("pool-sizes", "1,4,16", "comma-separated connection pool sizes to compare in concurrent mode")
+
+	// channelz 统计总是打开的（见 grpcchannelz 包注释），这个 flag 只决定是否提供查询服务
+	channelzAddr = flag.String("channelz-addr", "", "serve the grpc channelz service on this address, e.g. localhost:50061 (inspect with go run ./channelz)")
+
+	watchdogOpts = watchdog.Flags(flag.CommandLine, watchdog.Options{
+		Name:            "GoodClient",
+		Interval:        time.Second,
+		MaxCaptures:     3,
+		CPUDuration:     time.Second,
+		MaxGoroutines:   500,
+		GoroutineGrowth: 100,
+		GrowthWindow:    5 * time.Second,
+	})
+)
+
+// poolResult 一种连接池大小下的运行结果
+type poolResult struct {
+	size     int
+	before   int // 创建连接池之前
+	peak     int // 请求期间的峰值
+	idle     int // 请求结束、连接池未关闭
+	closed   int // 关闭连接池之后
+	failures uint64
+	elapsed  time.Duration
+}
+
+// runPool 创建 size 个连接的连接池，用 workers 个 goroutine 发送 n 个请求
+func runPool(size, workers, n int) (poolResult, error) {
+	res := poolResult{size: size, before: runtime.NumGoroutine()}
+
+	pool, err := grpcpool.New(*addr, grpcpool.Options{
+		Size:        size,
+		DialOptions: []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())},
+	})
+	if err != nil {
+		return res, err
+	}
+
+	// 采样请求期间的 goroutine 峰值
+	var peak atomic.Int64
+	stopSampling := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			if g := int64(runtime.NumGoroutine()); g > peak.Load() {
+				peak.Store(g)
+			}
+			select {
+			case <-stopSampling:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	start := time.Now()
+	var sent atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sent.Add(1) <= int64(n) {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				_, err := pool.SayHello(ctx, &pb.HelloRequest{Name: "World"})
+				cancel()
+				if err != nil {
+					log.Printf("❌ Request failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	res.elapsed = time.Since(start)
+	close(stopSampling)
+	<-sampled
+	res.peak = int(peak.Load())
+	res.idle = runtime.NumGoroutine()
+
+	for _, st := range pool.Stats() {
+		log.Printf("   conn #%d: state=%s checkouts=%d failures=%d replacements=%d",
+			st.Index, st.State, st.Checkouts, st.Failures, st.Replacements)
+		res.failures += st.Failures
+	}
+
+	if err := pool.Close(); err != nil {
+		log.Printf("⚠️  Failed to close pool: %v", err)
+	}
+	// 连接关闭后 transport 的 goroutine 异步退出，稍等片刻再统计
+	time.Sleep(200 * time.Millisecond)
+	res.closed = runtime.NumGoroutine()
+	return res, nil
+}
+
+// runConcurrent 依次用 -pool-sizes 中的每个大小运行同样的并发负载，并打印 goroutine 数量对比
+func runConcurrent() {
+	var sizes []int
+	for _, f := range strings.Split(*poolSizes, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || size <= 0 {
+			log.Fatalf("invalid -pool-sizes %q", *poolSizes)
+		}
+		sizes = append(sizes, size)
+	}
+
+	log.Printf("=== Good Client Demo: 连接池 + %d 个并发 worker ===", *concurrency)
+	log.Println("每个 gRPC 连接都有自己的 transport、resolver、balancer goroutine")
+	log.Println("观察：goroutine 数量随连接池大小增长，而不是随请求数增长；关闭连接池后回到初始值")
+	log.Println()
+
+	var results []poolResult
+	for _, size := range sizes {
+		log.Printf("🚀 连接池大小 %d：发送 %d 个请求...", size, *requests)
+		res, err := runPool(size, *concurrency, *requests)
+		if err != nil {
+			log.Fatalf("Failed to create pool: %v", err)
+		}
+		log.Printf("✅ 连接池大小 %d 完成，耗时 %v，goroutine 峰值 %d", size, res.elapsed.Round(time.Millisecond), res.peak)
+		log.Println()
+		results = append(results, res)
+	}
+
+	log.Println("=== 测试完成 ===")
+	log.Printf("📊 %-10s %8s %8s %8s %8s %8s %10s", "pool size", "before", "peak", "idle", "closed", "failures", "elapsed")
+	for _, r := range results {
+		log.Printf("   %-10d %8d %8d %8d %8d %8d %10v", r.size, r.before, r.peak, r.idle, r.closed, r.failures, r.elapsed.Round(time.Millisecond))
+	}
+	log.Println()
+	log.Println("✅ 正确实践：")
+	log.Println("   1. 连接池大小按并发和吞吐选择，而不是每个请求一个连接")
+	log.Println("   2. 处于 TRANSIENT_FAILURE 的连接会被跳过并在后台替换")
+	log.Println("   3. 用完后调用 pool.Close()，连接相关的 goroutine 全部退出")
+}
+
 func main() {
+	flag.Parse()
+
+	// channelz 会列出这个进程创建的所有 ClientConn 及其调用计数
+	if *channelzAddr != "" {
+		czAddr, stopChannelz, err := grpcchannelz.Serve(*channelzAddr)
+		if err != nil {
+			log.Fatalf("Failed to serve channelz: %v", err)
+		}
+		defer stopChannelz()
+		log.Printf("Channelz: go run ./channelz -addr %s", czAddr)
+	}
+
+	// goroutine 超过阈值时自动保存快照，测试结束后也能看到泄漏现场
+	ctx, stopWatchdog := context.WithCancel(context.Background())
+	defer stopWatchdog()
+	go watchdog.New(*watchdogOpts).Run(ctx)
+
+	if *concurrency > 0 {
+		runConcurrent()
+		return
+	}
+
 	log.Println("=== Good Client Demo: 复用连接，正确关闭 ===")
 	log.Println("正确做法：创建一次连接，多次复用")
 	log.Println("观察：goroutine 数量保持稳定")
@@ -64,7 +237,7 @@ func main() {
 	log.Println()
 
 	// ✅ 创建一次 client，复用连接
-	client, err := NewGoodClient("localhost:50051")
+	client, err := NewGoodClient(*addr)
 	if err != nil {
 		log.Fatalf("Failed to create client: %v", err)
 	}
@@ -98,8 +271,8 @@ func main() {
 			log.Printf("✅ 已发送 %d 个请求，goroutine: %d", requestCount, current)
 		}
 
-		// 发送 500 个请求后停止
-		if requestCount >= 500 {
+		// 发送 -requests 个请求后停止
+		if requestCount >= *requests {
 			log.Println()
 			log.Println("=== 测试完成 ===")
 			finalGoroutines := runtime.NumGoroutine()
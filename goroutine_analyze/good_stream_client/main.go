@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"runtime"
+	"time"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/watchdog"
+	pb "github.com/gangcheng1030/ai_production_troubleshooting/goroutine_analyze/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+var (
+	addr    = flag.String("addr", "localhost:50051", "gRPC server address")
+	streams = flag.Int("streams", 200, "number of server-streaming and bidi streams to open (each)")
+	hold    = flag.Duration("hold", 10*time.Second, "how long to keep the process alive after the last stream")
+
+	watchdogOpts = watchdog.Flags(flag.CommandLine, watchdog.Options{
+		Name:            "GoodStreamClient",
+		Interval:        time.Second,
+		MaxCaptures:     3,
+		CPUDuration:     time.Second,
+		MaxGoroutines:   500,
+		GoroutineGrowth: 100,
+		GrowthWindow:    5 * time.Second,
+	})
+)
+
+// 正确的做法：每个流有自己可取消的 ctx，用完就取消
+func openServerStreamGood(client pb.HelloServiceClient) error {
+	// ✅ 流的生命周期绑定在 ctx 上，函数返回时一定会取消
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.StreamHellos(ctx, &pb.HelloRequest{Name: "World"})
+	if err != nil {
+		return fmt.Errorf("failed to open StreamHellos: %v", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return fmt.Errorf("failed to receive from StreamHellos: %v", err)
+	}
+
+	// ✅ 不再需要后续消息：defer cancel() 结束流，服务端的 handler 随之返回
+	log.Printf("Stream response: %s", resp.Message)
+	return nil
+}
+
+// 正确的做法：双向流发送完毕后 CloseSend，并读到 io.EOF
+func openBidiStreamGood(client pb.HelloServiceClient) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	stream, err := client.Chat(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open Chat: %v", err)
+	}
+	if err := stream.Send(&pb.HelloRequest{Name: "World"}); err != nil {
+		return fmt.Errorf("failed to send to Chat: %v", err)
+	}
+	// ✅ 告诉服务端不会再发送，服务端的 Recv 返回 io.EOF
+	if err := stream.CloseSend(); err != nil {
+		return fmt.Errorf("failed to close Chat: %v", err)
+	}
+	// ✅ 读完剩余的响应，直到服务端结束这个流
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to receive from Chat: %v", err)
+		}
+		log.Printf("Chat response: %s", resp.Message)
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	log.Println("=== Good Stream Client Demo: 取消 ctx，CloseSend ===")
+	log.Println("正确做法：每个流使用可取消的 ctx，双向流发送完毕后 CloseSend 并读到 io.EOF")
+	log.Println("观察：goroutine 数量保持稳定")
+	log.Println()
+
+	initialGoroutines := runtime.NumGoroutine()
+	log.Printf("初始 goroutine 数量: %d", initialGoroutines)
+	log.Println()
+
+	// ✅ 连接只创建一次
+	conn, err := grpc.Dial(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	client := pb.NewHelloServiceClient(conn)
+
+	// goroutine 超过阈值时自动保存快照
+	ctx, stopWatchdog := context.WithCancel(context.Background())
+	defer stopWatchdog()
+	go watchdog.New(*watchdogOpts).Run(ctx)
+
+	// 监控 goroutine 数量
+	go func() {
+		monitorTicker := time.NewTicker(2 * time.Second)
+		defer monitorTicker.Stop()
+		for range monitorTicker.C {
+			current := runtime.NumGoroutine()
+			increase := current - initialGoroutines
+			log.Printf("📊 当前 goroutine: %d (变化 %+d)", current, increase)
+		}
+	}()
+
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+
+	streamCount := 0
+	for range ticker.C {
+		streamCount++
+		if err := openServerStreamGood(client); err != nil {
+			log.Printf("❌ Stream #%d failed: %v", streamCount, err)
+		}
+		if err := openBidiStreamGood(client); err != nil {
+			log.Printf("❌ Chat #%d failed: %v", streamCount, err)
+		}
+
+		if streamCount%50 == 0 {
+			current := runtime.NumGoroutine()
+			log.Printf("✅ 已完成 %d 个服务端流和 %d 个双向流，goroutine: %d", streamCount, streamCount, current)
+		}
+
+		if streamCount >= *streams {
+			break
+		}
+	}
+
+	log.Println()
+	log.Println("=== 测试完成 ===")
+	finalGoroutines := runtime.NumGoroutine()
+	log.Printf("最终 goroutine 数量: %d", finalGoroutines)
+	log.Printf("goroutine 变化: %+d", finalGoroutines-initialGoroutines)
+	log.Println()
+	log.Println("✅ 正确实践：")
+	log.Println("   1. 每个流使用 context.WithCancel/WithTimeout，并 defer cancel()")
+	log.Println("   2. 服务端流不再需要时取消 ctx，而不是丢下不管")
+	log.Println("   3. 双向流发送完毕后调用 CloseSend()，并读到 io.EOF")
+	log.Println()
+	log.Println("🔍 使用 pprof 查看详细信息：")
+	log.Println("   curl http://localhost:50052/debug/pprof/goroutine?debug=2")
+
+	log.Println()
+	log.Printf("等待 %v 以便使用 pprof 查看 goroutine 信息...", *hold)
+	time.Sleep(*hold)
+}
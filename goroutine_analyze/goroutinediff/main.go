@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/goroutinedump"
+)
+
+var (
+	baseFile   = flag.String("base", "good_goroutine.txt", "baseline goroutine dump (debug=1 or debug=2)")
+	targetFile = flag.String("target", "bad_goroutine.txt", "goroutine dump to compare against the baseline")
+	format     = flag.String("format", "text", "output format: text or json")
+	top        = flag.Int("top", 15, "max number of stack groups to show (0 for all)")
+	minDelta   = flag.Int("min-delta", 1, "hide stack groups that grew by fewer goroutines than this")
+)
+
+func main() {
+	flag.Parse()
+
+	base, err := goroutinedump.ParseFile(*baseFile)
+	if err != nil {
+		log.Fatalf("failed to parse base dump: %v", err)
+	}
+	target, err := goroutinedump.ParseFile(*targetFile)
+	if err != nil {
+		log.Fatalf("failed to parse target dump: %v", err)
+	}
+
+	report := goroutinedump.Diff(base, target, "base", "target", goroutinedump.Options{
+		MinDelta: *minDelta,
+		Top:      *top,
+	})
+	if err := report.Write(os.Stdout, *format); err != nil {
+		log.Fatalf("failed to write report: %v", err)
+	}
+}
@@ -0,0 +1,365 @@
+package grpcchannelz
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// pageSize 分页查询 channel、server 和 server socket 时每页的数量
+const pageSize = 100
+
+// Options 查询和输出选项
+type Options struct {
+	// Idle 打开的 channel 最后一次调用距今超过这么久时标记为空闲，0 表示不标记
+	Idle time.Duration
+	// MaxChildren 每一层最多输出的子节点数，0 表示全部输出
+	MaxChildren int
+	// Sockets 是否查询并输出 socket
+	Sockets bool
+}
+
+// Node 树上的一个节点
+type Node struct {
+	Line     string
+	Warnings []string
+	Children []*Node
+	// Omitted 没有查询详情、不在 Children 中的子节点数
+	Omitted int
+}
+
+// TargetSummary 按 target 汇总的 top channel
+type TargetSummary struct {
+	Target    string
+	Open      int
+	ZeroCalls int
+	Idle      int
+	Calls     int64
+}
+
+// Report 一次 channelz 查询的结果
+type Report struct {
+	Time     time.Time
+	Channels []*Node
+	Servers  []*Node
+	Targets  []TargetSummary
+
+	OpenChannels  int
+	ZeroCalls     int
+	IdleChannels  int
+	ServerSockets int
+}
+
+type inspector struct {
+	ctx    context.Context
+	client channelzpb.ChannelzClient
+	opts   Options
+	now    time.Time
+}
+
+// Inspect 通过 channelz 服务查询所有 top channel 和 server，构建 Report
+func Inspect(ctx context.Context, client channelzpb.ChannelzClient, opts Options) (*Report, error) {
+	in := &inspector{ctx: ctx, client: client, opts: opts, now: time.Now()}
+	r := &Report{Time: in.now}
+	targets := make(map[string]*TargetSummary)
+
+	var start int64
+	for {
+		resp, err := client.GetTopChannels(ctx, &channelzpb.GetTopChannelsRequest{StartChannelId: start, MaxResults: pageSize})
+		if err != nil {
+			return nil, fmt.Errorf("GetTopChannels: %w", err)
+		}
+		for _, ch := range resp.Channel {
+			start = ch.GetRef().GetChannelId() + 1
+			// 只有会被输出的 channel 才查询 subchannel 和 socket，泄漏上千个 channel 时也能很快返回
+			node, err := in.channel(ch, in.opts.MaxChildren <= 0 || len(r.Channels) < in.opts.MaxChildren)
+			if err != nil {
+				return nil, err
+			}
+			r.Channels = append(r.Channels, node)
+
+			data := ch.GetData()
+			ts := targets[data.GetTarget()]
+			if ts == nil {
+				ts = &TargetSummary{Target: data.GetTarget()}
+				targets[data.GetTarget()] = ts
+			}
+			ts.Calls += data.GetCallsStarted()
+			if !isOpen(data) {
+				continue
+			}
+			r.OpenChannels++
+			ts.Open++
+			if data.GetCallsStarted() == 0 {
+				r.ZeroCalls++
+				ts.ZeroCalls++
+			} else if in.idle(data) {
+				r.IdleChannels++
+				ts.Idle++
+			}
+		}
+		if resp.End || len(resp.Channel) == 0 {
+			break
+		}
+	}
+	for _, ts := range targets {
+		r.Targets = append(r.Targets, *ts)
+	}
+	sort.Slice(r.Targets, func(i, j int) bool {
+		if r.Targets[i].Open != r.Targets[j].Open {
+			return r.Targets[i].Open > r.Targets[j].Open
+		}
+		return r.Targets[i].Target < r.Targets[j].Target
+	})
+
+	start = 0
+	for {
+		resp, err := client.GetServers(ctx, &channelzpb.GetServersRequest{StartServerId: start, MaxResults: pageSize})
+		if err != nil {
+			return nil, fmt.Errorf("GetServers: %w", err)
+		}
+		for _, srv := range resp.Server {
+			start = srv.GetRef().GetServerId() + 1
+			node, sockets, err := in.server(srv)
+			if err != nil {
+				return nil, err
+			}
+			r.Servers = append(r.Servers, node)
+			r.ServerSockets += sockets
+		}
+		if resp.End || len(resp.Server) == 0 {
+			break
+		}
+	}
+	return r, nil
+}
+
+func isOpen(data *channelzpb.ChannelData) bool {
+	return data.GetState().GetState() != channelzpb.ChannelConnectivityState_SHUTDOWN
+}
+
+func (in *inspector) idle(data *channelzpb.ChannelData) bool {
+	last := data.GetLastCallStartedTimestamp()
+	return in.opts.Idle > 0 && validTime(last) && in.now.Sub(last.AsTime()) >= in.opts.Idle
+}
+
+func (in *inspector) channel(ch *channelzpb.Channel, detailed bool) (*Node, error) {
+	data := ch.GetData()
+	node := &Node{Line: fmt.Sprintf("channel #%d %s [%s] calls %s, last call %s",
+		ch.GetRef().GetChannelId(), data.GetTarget(), stateName(data.GetState()),
+		calls(data.GetCallsStarted(), data.GetCallsSucceeded(), data.GetCallsFailed()),
+		in.ago(data.GetLastCallStartedTimestamp()))}
+	if isOpen(data) {
+		if data.GetCallsStarted() == 0 {
+			node.Warnings = append(node.Warnings, "⚠️  open with 0 calls")
+		} else if in.idle(data) {
+			node.Warnings = append(node.Warnings, "💤 open and idle")
+		}
+	}
+	if !detailed {
+		return node, nil
+	}
+
+	for _, ref := range ch.GetChannelRef() {
+		resp, err := in.client.GetChannel(in.ctx, &channelzpb.GetChannelRequest{ChannelId: ref.GetChannelId()})
+		if err != nil {
+			return nil, fmt.Errorf("GetChannel %d: %w", ref.GetChannelId(), err)
+		}
+		child, err := in.channel(resp.GetChannel(), true)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, child)
+	}
+	for _, ref := range ch.GetSubchannelRef() {
+		child, err := in.subchannel(ref.GetSubchannelId())
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, child)
+	}
+	sockets, err := in.sockets(ch.GetSocketRef())
+	if err != nil {
+		return nil, err
+	}
+	node.Children = append(node.Children, sockets...)
+	return node, nil
+}
+
+func (in *inspector) subchannel(id int64) (*Node, error) {
+	resp, err := in.client.GetSubchannel(in.ctx, &channelzpb.GetSubchannelRequest{SubchannelId: id})
+	if err != nil {
+		return nil, fmt.Errorf("GetSubchannel %d: %w", id, err)
+	}
+	sc := resp.GetSubchannel()
+	data := sc.GetData()
+	node := &Node{Line: fmt.Sprintf("subchannel #%d %s [%s] calls %s",
+		id, data.GetTarget(), stateName(data.GetState()),
+		calls(data.GetCallsStarted(), data.GetCallsSucceeded(), data.GetCallsFailed()))}
+	node.Children, err = in.sockets(sc.GetSocketRef())
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func (in *inspector) sockets(refs []*channelzpb.SocketRef) ([]*Node, error) {
+	if !in.opts.Sockets {
+		return nil, nil
+	}
+	var nodes []*Node
+	for _, ref := range refs {
+		resp, err := in.client.GetSocket(in.ctx, &channelzpb.GetSocketRequest{SocketId: ref.GetSocketId()})
+		if err != nil {
+			return nil, fmt.Errorf("GetSocket %d: %w", ref.GetSocketId(), err)
+		}
+		s := resp.GetSocket()
+		data := s.GetData()
+		nodes = append(nodes, &Node{Line: fmt.Sprintf("socket #%d %s -> %s streams %s, messages sent/received %d/%d, keepalives %d",
+			ref.GetSocketId(), address(s.GetLocal()), address(s.GetRemote()),
+			calls(data.GetStreamsStarted(), data.GetStreamsSucceeded(), data.GetStreamsFailed()),
+			data.GetMessagesSent(), data.GetMessagesReceived(), data.GetKeepAlivesSent())})
+	}
+	return nodes, nil
+}
+
+func (in *inspector) server(srv *channelzpb.Server) (*Node, int, error) {
+	id := srv.GetRef().GetServerId()
+	data := srv.GetData()
+	node := &Node{Line: fmt.Sprintf("server #%d calls %s, last call %s",
+		id, calls(data.GetCallsStarted(), data.GetCallsSucceeded(), data.GetCallsFailed()),
+		in.ago(data.GetLastCallStartedTimestamp()))}
+	for _, ref := range srv.GetListenSocket() {
+		node.Children = append(node.Children, &Node{Line: fmt.Sprintf("listen socket #%d %s", ref.GetSocketId(), ref.GetName())})
+	}
+
+	var refs []*channelzpb.SocketRef
+	var start int64
+	for {
+		resp, err := in.client.GetServerSockets(in.ctx, &channelzpb.GetServerSocketsRequest{ServerId: id, StartSocketId: start, MaxResults: pageSize})
+		if err != nil {
+			return nil, 0, fmt.Errorf("GetServerSockets %d: %w", id, err)
+		}
+		for _, ref := range resp.GetSocketRef() {
+			start = ref.GetSocketId() + 1
+		}
+		refs = append(refs, resp.GetSocketRef()...)
+		if resp.End || len(resp.GetSocketRef()) == 0 {
+			break
+		}
+	}
+	node.Line += fmt.Sprintf(", %d open sockets", len(refs))
+	shown := refs
+	if in.opts.MaxChildren > 0 && len(shown) > in.opts.MaxChildren {
+		shown = shown[:in.opts.MaxChildren]
+	}
+	sockets, err := in.sockets(shown)
+	if err != nil {
+		return nil, 0, err
+	}
+	node.Children = append(node.Children, sockets...)
+	if in.opts.Sockets {
+		node.Omitted = len(refs) - len(shown)
+	}
+	return node, len(refs), nil
+}
+
+func (in *inspector) ago(ts *timestamppb.Timestamp) string {
+	if !validTime(ts) {
+		return "never"
+	}
+	// 查询期间开始的调用（例如本次查询自己）晚于 now
+	return max(in.now.Sub(ts.AsTime()), 0).Round(time.Millisecond).String() + " ago"
+}
+
+func validTime(ts *timestamppb.Timestamp) bool {
+	return ts != nil && (ts.GetSeconds() != 0 || ts.GetNanos() != 0)
+}
+
+func stateName(s *channelzpb.ChannelConnectivityState) string {
+	if s == nil {
+		return "UNKNOWN"
+	}
+	return s.GetState().String()
+}
+
+// calls 按 started/succeeded/failed 格式化调用或流的计数
+func calls(started, succeeded, failed int64) string {
+	return fmt.Sprintf("%d/%d/%d", started, succeeded, failed)
+}
+
+func address(a *channelzpb.Address) string {
+	switch addr := a.GetAddress().(type) {
+	case *channelzpb.Address_TcpipAddress:
+		ip := net.IP(addr.TcpipAddress.GetIpAddress())
+		return net.JoinHostPort(ip.String(), strconv.Itoa(int(addr.TcpipAddress.GetPort())))
+	case *channelzpb.Address_UdsAddress_:
+		return "unix:" + addr.UdsAddress.GetFilename()
+	case *channelzpb.Address_OtherAddress_:
+		return addr.OtherAddress.GetName()
+	}
+	return "?"
+}
+
+// Write 以树的形式输出 Report，最后输出按 target 的汇总
+func (r *Report) Write(w io.Writer, opts Options) {
+	fmt.Fprintf(w, "Channels (%d, %d open; calls started/succeeded/failed):\n", len(r.Channels), r.OpenChannels)
+	writeNodes(w, r.Channels, 0, "", opts.MaxChildren)
+	fmt.Fprintf(w, "\nServers (%d, %d open sockets):\n", len(r.Servers), r.ServerSockets)
+	writeNodes(w, r.Servers, 0, "", opts.MaxChildren)
+
+	if len(r.Targets) > 0 {
+		fmt.Fprintf(w, "\nBy target:\n")
+		fmt.Fprintf(w, "  %-30s %6s %10s %6s %8s\n", "target", "open", "zero-calls", "idle", "calls")
+		for _, t := range r.Targets {
+			fmt.Fprintf(w, "  %-30s %6d %10d %6d %8d\n", t.Target, t.Open, t.ZeroCalls, t.Idle, t.Calls)
+		}
+	}
+
+	fmt.Fprintln(w)
+	if r.ZeroCalls > 0 {
+		fmt.Fprintf(w, "⚠️  %d open channels have never made a call\n", r.ZeroCalls)
+	}
+	if r.IdleChannels > 0 {
+		fmt.Fprintf(w, "💤 %d open channels have been idle for at least %v\n", r.IdleChannels, opts.Idle)
+	}
+	for _, t := range r.Targets {
+		if t.Open > 1 {
+			fmt.Fprintf(w, "🔍 %d open channels to %s: unless this is a connection pool, ClientConns are probably created per request and never closed\n", t.Open, t.Target)
+		}
+	}
+	if r.ZeroCalls == 0 && r.IdleChannels == 0 {
+		fmt.Fprintln(w, "✅ no open channels without calls")
+	}
+}
+
+func writeNodes(w io.Writer, nodes []*Node, omitted int, prefix string, max int) {
+	shown := nodes
+	if max > 0 && len(shown) > max {
+		shown = shown[:max]
+	}
+	omitted += len(nodes) - len(shown)
+	for i, n := range shown {
+		last := i == len(shown)-1 && omitted == 0
+		branch, indent := "├─ ", "│  "
+		if last {
+			branch, indent = "└─ ", "   "
+		}
+		line := n.Line
+		for _, warn := range n.Warnings {
+			line += "  " + warn
+		}
+		fmt.Fprintf(w, "%s%s%s\n", prefix, branch, line)
+		writeNodes(w, n.Children, n.Omitted, prefix+indent, max)
+	}
+	if omitted > 0 {
+		fmt.Fprintf(w, "%s└─ ... %d more\n", prefix, omitted)
+	}
+}
@@ -0,0 +1,213 @@
+// Package grpcconns 用 gRPC 的 stats.Handler 跟踪服务端当前的每个连接：对端地址、建立时间、
+// 活动流数、RPC 数和最后活动时间，并按对端 IP 汇总，通过管理端口的 /debug/connections 输出。
+// goroutine 数量暴涨时，可以只从服务端找出是哪个客户端泄漏了连接。
+package grpcconns
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/stats"
+)
+
+// conn 一个连接的统计，RPC 事件只更新原子字段
+type conn struct {
+	id          uint64
+	remote      string
+	ip          string
+	local       string
+	connectedAt time.Time
+
+	activeStreams atomic.Int64
+	rpcs          atomic.Uint64
+	// lastActivity UnixNano，连接建立、RPC 开始/结束和收发消息时更新
+	lastActivity atomic.Int64
+}
+
+func (c *conn) touch() { c.lastActivity.Store(time.Now().UnixNano()) }
+
+// Tracker 实现 stats.Handler 和 http.Handler
+type Tracker struct {
+	nextID atomic.Uint64
+	closed atomic.Uint64
+
+	mu    sync.Mutex
+	conns map[uint64]*conn
+}
+
+// NewTracker 创建 Tracker，用 grpc.StatsHandler 注册到 server
+func NewTracker() *Tracker {
+	return &Tracker{conns: make(map[uint64]*conn)}
+}
+
+type connKey struct{}
+
+// TagConn 为新连接创建统计，放进 ctx；连接上所有 RPC 的 ctx 都从它派生
+func (t *Tracker) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	c := &conn{id: t.nextID.Add(1), connectedAt: time.Now()}
+	if info.RemoteAddr != nil {
+		c.remote = info.RemoteAddr.String()
+		c.ip = c.remote
+		if host, _, err := net.SplitHostPort(c.remote); err == nil {
+			c.ip = host
+		}
+	}
+	if info.LocalAddr != nil {
+		c.local = info.LocalAddr.String()
+	}
+	c.touch()
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// HandleConn 在连接建立和关闭时登记或删除连接
+func (t *Tracker) HandleConn(ctx context.Context, s stats.ConnStats) {
+	c, ok := ctx.Value(connKey{}).(*conn)
+	if !ok {
+		return
+	}
+	switch s.(type) {
+	case *stats.ConnBegin:
+		t.mu.Lock()
+		t.conns[c.id] = c
+		t.mu.Unlock()
+	case *stats.ConnEnd:
+		t.mu.Lock()
+		delete(t.conns, c.id)
+		t.mu.Unlock()
+		t.closed.Add(1)
+	}
+}
+
+// TagRPC 不需要额外信息，连接统计已经在 ctx 中
+func (t *Tracker) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+// HandleRPC 统计 RPC 数、活动流数和最后活动时间
+func (t *Tracker) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	c, ok := ctx.Value(connKey{}).(*conn)
+	if !ok {
+		return
+	}
+	switch s.(type) {
+	case *stats.Begin:
+		c.rpcs.Add(1)
+		c.activeStreams.Add(1)
+	case *stats.End:
+		c.activeStreams.Add(-1)
+	case *stats.InPayload, *stats.OutPayload:
+	default:
+		return
+	}
+	c.touch()
+}
+
+// Conn 单个连接的快照
+type Conn struct {
+	ID            uint64    `json:"id"`
+	RemoteAddr    string    `json:"remote_addr"`
+	LocalAddr     string    `json:"local_addr"`
+	ConnectedAt   time.Time `json:"connected_at"`
+	Age           string    `json:"age"`
+	ActiveStreams int64     `json:"active_streams"`
+	RPCs          uint64    `json:"rpcs"`
+	LastActivity  time.Time `json:"last_activity"`
+	Idle          string    `json:"idle"`
+}
+
+// Peer 同一个对端 IP 的所有连接的汇总
+type Peer struct {
+	IP            string    `json:"ip"`
+	Connections   int       `json:"connections"`
+	ActiveStreams int64     `json:"active_streams"`
+	RPCs          uint64    `json:"rpcs"`
+	OldestConnect time.Time `json:"oldest_connected_at"`
+	LastActivity  time.Time `json:"last_activity"`
+	// IdleConnections 没有活动流的连接数；大量空闲连接通常说明客户端没有复用或关闭连接
+	IdleConnections int `json:"idle_connections"`
+}
+
+// Snapshot /debug/connections 的响应
+type Snapshot struct {
+	Time        time.Time `json:"time"`
+	Open        int       `json:"open"`
+	ClosedTotal uint64    `json:"closed_total"`
+	// ByIP 按连接数从多到少排序，最可疑的客户端排在最前面
+	ByIP        []Peer `json:"by_ip"`
+	Connections []Conn `json:"connections,omitempty"`
+}
+
+// Snapshot 返回当前所有连接和按 IP 的汇总；withConns 为 false 时只返回汇总
+func (t *Tracker) Snapshot(withConns bool) Snapshot {
+	t.mu.Lock()
+	conns := make([]*conn, 0, len(t.conns))
+	for _, c := range t.conns {
+		conns = append(conns, c)
+	}
+	t.mu.Unlock()
+
+	now := time.Now()
+	snap := Snapshot{Time: now, Open: len(conns), ClosedTotal: t.closed.Load(), ByIP: []Peer{}}
+	peers := make(map[string]*Peer)
+	for _, c := range conns {
+		last := time.Unix(0, c.lastActivity.Load())
+		cs := Conn{
+			ID:            c.id,
+			RemoteAddr:    c.remote,
+			LocalAddr:     c.local,
+			ConnectedAt:   c.connectedAt,
+			Age:           now.Sub(c.connectedAt).Round(time.Millisecond).String(),
+			ActiveStreams: c.activeStreams.Load(),
+			RPCs:          c.rpcs.Load(),
+			LastActivity:  last,
+			Idle:          now.Sub(last).Round(time.Millisecond).String(),
+		}
+		if withConns {
+			snap.Connections = append(snap.Connections, cs)
+		}
+
+		p, ok := peers[c.ip]
+		if !ok {
+			p = &Peer{IP: c.ip, OldestConnect: c.connectedAt}
+			peers[c.ip] = p
+		}
+		p.Connections++
+		p.ActiveStreams += cs.ActiveStreams
+		p.RPCs += cs.RPCs
+		if cs.ActiveStreams == 0 {
+			p.IdleConnections++
+		}
+		if c.connectedAt.Before(p.OldestConnect) {
+			p.OldestConnect = c.connectedAt
+		}
+		if last.After(p.LastActivity) {
+			p.LastActivity = last
+		}
+	}
+	for _, p := range peers {
+		snap.ByIP = append(snap.ByIP, *p)
+	}
+	sort.Slice(snap.ByIP, func(i, j int) bool {
+		if snap.ByIP[i].Connections != snap.ByIP[j].Connections {
+			return snap.ByIP[i].Connections > snap.ByIP[j].Connections
+		}
+		return snap.ByIP[i].IP < snap.ByIP[j].IP
+	})
+	sort.Slice(snap.Connections, func(i, j int) bool { return snap.Connections[i].ID < snap.Connections[j].ID })
+	return snap
+}
+
+// ServeHTTP 以 JSON 输出 Snapshot；?by=ip 时只输出按 IP 的汇总，连接很多时更易读
+func (t *Tracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	snap := t.Snapshot(r.URL.Query().Get("by") != "ip")
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(snap)
+}
@@ -0,0 +1,149 @@
+package grpcconns
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/stats"
+)
+
+var local = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 50051}
+
+// open 模拟一个来自 remote 的新连接，connectedAt 覆盖建立时间，返回连接的 ctx
+func open(t *testing.T, tr *Tracker, remote string, connectedAt time.Time) context.Context {
+	t.Helper()
+	addr, err := net.ResolveTCPAddr("tcp", remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := tr.TagConn(context.Background(), &stats.ConnTagInfo{RemoteAddr: addr, LocalAddr: local})
+	ctx.Value(connKey{}).(*conn).connectedAt = connectedAt
+	tr.HandleConn(ctx, &stats.ConnBegin{})
+	return ctx
+}
+
+// rpc 在连接上开始一个 RPC，返回结束它的函数
+func rpc(tr *Tracker, connCtx context.Context) (end func()) {
+	ctx := tr.TagRPC(connCtx, &stats.RPCTagInfo{FullMethodName: "/hello.HelloService/SayHello"})
+	tr.HandleRPC(ctx, &stats.Begin{})
+	tr.HandleRPC(ctx, &stats.InPayload{})
+	return func() { tr.HandleRPC(ctx, &stats.End{}) }
+}
+
+func TestSnapshot(t *testing.T) {
+	tr := NewTracker()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// 10.0.0.2 泄漏了三个连接，其中两个空闲；10.0.0.1 只有一个连接，正在处理流
+	leaky1 := open(t, tr, "10.0.0.2:40001", base.Add(2*time.Minute))
+	open(t, tr, "10.0.0.2:40002", base)
+	open(t, tr, "10.0.0.2:40003", base.Add(time.Minute))
+	busy := open(t, tr, "10.0.0.1:40000", base.Add(3*time.Minute))
+	closed := open(t, tr, "10.0.0.3:40000", base)
+
+	// 已结束的 RPC 不计入活动流
+	rpc(tr, leaky1)()
+	rpc(tr, leaky1)()
+	rpc(tr, leaky1)
+	rpc(tr, busy)
+	rpc(tr, busy)
+	tr.HandleConn(closed, &stats.ConnEnd{})
+
+	snap := tr.Snapshot(true)
+	if snap.Open != 4 || snap.ClosedTotal != 1 {
+		t.Errorf("open %d, closed %d; want 4, 1", snap.Open, snap.ClosedTotal)
+	}
+	if len(snap.ByIP) != 2 {
+		t.Fatalf("got %d peers, want 2: %+v", len(snap.ByIP), snap.ByIP)
+	}
+
+	// 按连接数从多到少排序
+	leaky, one := snap.ByIP[0], snap.ByIP[1]
+	if leaky.IP != "10.0.0.2" || one.IP != "10.0.0.1" {
+		t.Errorf("peer order = %s, %s; want 10.0.0.2, 10.0.0.1", leaky.IP, one.IP)
+	}
+	if leaky.Connections != 3 || leaky.IdleConnections != 2 || leaky.ActiveStreams != 1 || leaky.RPCs != 3 {
+		t.Errorf("10.0.0.2 = %+v, want 3 connections, 2 idle, 1 active stream, 3 RPCs", leaky)
+	}
+	if !leaky.OldestConnect.Equal(base) {
+		t.Errorf("10.0.0.2 oldest connect = %v, want %v", leaky.OldestConnect, base)
+	}
+	if one.Connections != 1 || one.IdleConnections != 0 || one.ActiveStreams != 2 || one.RPCs != 2 {
+		t.Errorf("10.0.0.1 = %+v, want 1 busy connection with 2 active streams", one)
+	}
+
+	if len(snap.Connections) != 4 {
+		t.Fatalf("got %d connections, want 4", len(snap.Connections))
+	}
+	for i, c := range snap.Connections {
+		if i > 0 && c.ID <= snap.Connections[i-1].ID {
+			t.Errorf("connections not sorted by ID: %d after %d", c.ID, snap.Connections[i-1].ID)
+		}
+		if c.LocalAddr != local.String() {
+			t.Errorf("connection %d local addr = %q", c.ID, c.LocalAddr)
+		}
+	}
+	if c := snap.Connections[0]; c.RemoteAddr != "10.0.0.2:40001" || c.RPCs != 3 || c.ActiveStreams != 1 {
+		t.Errorf("first connection = %+v", c)
+	}
+
+	if s := tr.Snapshot(false); s.Connections != nil || len(s.ByIP) != 2 {
+		t.Errorf("summary-only snapshot = %+v", s)
+	}
+}
+
+// 连接数相同时按 IP 排序
+func TestSnapshotTieOrder(t *testing.T) {
+	tr := NewTracker()
+	now := time.Now()
+	for _, remote := range []string{"10.0.0.9:1", "10.0.0.10:1", "[::1]:1"} {
+		open(t, tr, remote, now)
+	}
+	var ips []string
+	for _, p := range tr.Snapshot(false).ByIP {
+		ips = append(ips, p.IP)
+	}
+	want := []string{"10.0.0.10", "10.0.0.9", "::1"}
+	for i := range want {
+		if i >= len(ips) || ips[i] != want[i] {
+			t.Fatalf("peer order = %v, want %v", ips, want)
+		}
+	}
+}
+
+// 没有 TagConn 的 ctx 中没有连接统计，事件被忽略
+func TestUntaggedContext(t *testing.T) {
+	tr := NewTracker()
+	tr.HandleConn(context.Background(), &stats.ConnBegin{})
+	tr.HandleRPC(context.Background(), &stats.Begin{})
+	if s := tr.Snapshot(true); s.Open != 0 {
+		t.Errorf("open = %d, want 0", s.Open)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	tr := NewTracker()
+	open(t, tr, "10.0.0.1:1234", time.Now())
+
+	for _, tt := range []struct {
+		url       string
+		withConns bool
+	}{
+		{"/debug/connections", true},
+		{"/debug/connections?by=ip", false},
+	} {
+		rec := httptest.NewRecorder()
+		tr.ServeHTTP(rec, httptest.NewRequest("GET", tt.url, nil))
+		var snap Snapshot
+		if err := json.Unmarshal(rec.Body.Bytes(), &snap); err != nil {
+			t.Fatalf("%s: %v\n%s", tt.url, err, rec.Body.String())
+		}
+		if snap.Open != 1 || len(snap.ByIP) != 1 || (len(snap.Connections) == 1) != tt.withConns {
+			t.Errorf("%s: open %d, %d peers, %d connections", tt.url, snap.Open, len(snap.ByIP), len(snap.Connections))
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Package grpckeepalive 把 gRPC 服务端的 keepalive.ServerParameters 和 EnforcementPolicy 做成 flag。
+// MaxConnectionIdle/MaxConnectionAge 让服务端主动关闭空闲或存活过久的连接，
+// 客户端泄漏的连接（以及服务端为它保留的 goroutine）因此能被回收。
+package grpckeepalive
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// Options 配置；为 0 的字段使用 gRPC 的默认值
+type Options struct {
+	// MaxConnectionIdle 连接上没有进行中的 RPC 超过这么久后发送 GOAWAY 关闭连接，0 表示不限制
+	MaxConnectionIdle time.Duration
+	// MaxConnectionAge 连接最长存活时间（gRPC 会加上 ±10% 的抖动），0 表示不限制
+	MaxConnectionAge time.Duration
+	// MaxConnectionAgeGrace 到达 MaxConnectionAge 后等待进行中的 RPC 结束的时间，0 表示无限等待
+	MaxConnectionAgeGrace time.Duration
+	// Time 连接空闲这么久后服务端发送 ping 探测客户端，0 表示 gRPC 默认的 2h
+	Time time.Duration
+	// Timeout 等待 ping 响应的时间，超时关闭连接，0 表示 gRPC 默认的 20s
+	Timeout time.Duration
+	// MinTime 客户端两次 ping 之间的最小间隔，更频繁的 ping 会被 GOAWAY，0 表示 gRPC 默认的 5m
+	MinTime time.Duration
+	// PermitWithoutStream 是否允许客户端在没有活动流时发送 ping
+	PermitWithoutStream bool
+}
+
+// Flags 在 fs 上注册相关的 flag
+func Flags(fs *flag.FlagSet, defaults Options) *Options {
+	opts := defaults
+	fs.DurationVar(&opts.MaxConnectionIdle, "keepalive-max-idle", opts.MaxConnectionIdle, "close connections that have had no outstanding RPCs for this long (0 disables)")
+	fs.DurationVar(&opts.MaxConnectionAge, "keepalive-max-age", opts.MaxConnectionAge, "close connections after this age, ±10% jitter (0 disables)")
+	fs.DurationVar(&opts.MaxConnectionAgeGrace, "keepalive-max-age-grace", opts.MaxConnectionAgeGrace, "time allowed for outstanding RPCs after -keepalive-max-age before the connection is forcibly closed (0 waits forever)")
+	fs.DurationVar(&opts.Time, "keepalive-time", opts.Time, "ping clients after the connection has been idle for this long (0 uses the gRPC default of 2h)")
+	fs.DurationVar(&opts.Timeout, "keepalive-timeout", opts.Timeout, "close the connection if a keepalive ping is not acknowledged within this time (0 uses the gRPC default of 20s)")
+	fs.DurationVar(&opts.MinTime, "keepalive-min-time", opts.MinTime, "enforcement: minimum interval between client pings, faster clients get GOAWAY (0 uses the gRPC default of 5m)")
+	fs.BoolVar(&opts.PermitWithoutStream, "keepalive-permit-without-stream", opts.PermitWithoutStream, "enforcement: allow client pings when there are no active streams")
+	return &opts
+}
+
+// ServerOptions 返回传给 grpc.NewServer 的 keepalive 选项
+func (o *Options) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle:     o.MaxConnectionIdle,
+			MaxConnectionAge:      o.MaxConnectionAge,
+			MaxConnectionAgeGrace: o.MaxConnectionAgeGrace,
+			Time:                  o.Time,
+			Timeout:               o.Timeout,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             o.MinTime,
+			PermitWithoutStream: o.PermitWithoutStream,
+		}),
+	}
+}
+
+// String 返回非默认的配置，用于启动日志
+func (o *Options) String() string {
+	var parts []string
+	add := func(name string, d time.Duration) {
+		if d > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%v", name, d))
+		}
+	}
+	add("max-idle", o.MaxConnectionIdle)
+	add("max-age", o.MaxConnectionAge)
+	add("max-age-grace", o.MaxConnectionAgeGrace)
+	add("time", o.Time)
+	add("timeout", o.Timeout)
+	add("min-time", o.MinTime)
+	if o.PermitWithoutStream {
+		parts = append(parts, "permit-without-stream")
+	}
+	if len(parts) == 0 {
+		return "gRPC defaults (idle connections are never closed)"
+	}
+	return strings.Join(parts, " ")
+}
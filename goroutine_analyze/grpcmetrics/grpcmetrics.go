@@ -0,0 +1,80 @@
+// Package grpcmetrics 用 gRPC 的 stats.Handler 统计服务端的 RPC 和连接指标，
+// 通过 admin 管理端口的 /metrics 输出。
+package grpcmetrics
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/metrics"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// ServerHandler 实现 stats.Handler，按方法统计 RPC 数量、结果码、耗时、并发数和接收字节数，
+// 并统计当前连接数
+type ServerHandler struct {
+	started  metrics.CounterVec
+	handled  metrics.CounterVec
+	duration metrics.HistogramVec
+	inFlight metrics.GaugeVec
+	received metrics.CounterVec
+
+	conns      atomic.Int64
+	connsTotal atomic.Uint64
+}
+
+// NewServerHandler 在 r 中注册 grpc_server_* 指标
+func NewServerHandler(r *metrics.Registry) *ServerHandler {
+	h := &ServerHandler{
+		started:  r.NewCounterVec("grpc_server_started_total", "Total number of RPCs started on the server.", "grpc_method"),
+		handled:  r.NewCounterVec("grpc_server_handled_total", "Total number of RPCs completed on the server, regardless of success or failure.", "grpc_method", "grpc_code"),
+		duration: r.NewHistogramVec("grpc_server_handling_seconds", "RPC latency by method.", nil, "grpc_method"),
+		inFlight: r.NewGaugeVec("grpc_server_in_flight", "Number of RPCs currently being handled by method.", "grpc_method"),
+		received: r.NewCounterVec("grpc_server_received_bytes_total", "Total wire bytes of request messages received by method.", "grpc_method"),
+	}
+	r.NewGaugeFunc("grpc_server_open_connections", "Number of currently open client connections.",
+		func() float64 { return float64(h.conns.Load()) })
+	r.NewCounterFunc("grpc_server_connections_total", "Total number of accepted client connections.",
+		func() float64 { return float64(h.connsTotal.Load()) })
+	return h
+}
+
+type methodKey struct{}
+
+// TagRPC 把方法名放进 ctx，供 HandleRPC 使用
+func (h *ServerHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, methodKey{}, info.FullMethodName)
+}
+
+// HandleRPC 处理 RPC 的开始、收到消息和结束事件
+func (h *ServerHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	method, _ := ctx.Value(methodKey{}).(string)
+	switch s := s.(type) {
+	case *stats.Begin:
+		h.started.With(method).Inc()
+		h.inFlight.With(method).Inc()
+	case *stats.InPayload:
+		h.received.With(method).Add(float64(s.WireLength))
+	case *stats.End:
+		h.inFlight.With(method).Dec()
+		h.duration.With(method).Observe(s.EndTime.Sub(s.BeginTime).Seconds())
+		h.handled.With(method, status.Code(s.Error).String()).Inc()
+	}
+}
+
+// TagConn 不需要给连接打标签
+func (h *ServerHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+// HandleConn 统计连接的建立和断开
+func (h *ServerHandler) HandleConn(_ context.Context, s stats.ConnStats) {
+	switch s.(type) {
+	case *stats.ConnBegin:
+		h.conns.Add(1)
+		h.connsTotal.Add(1)
+	case *stats.ConnEnd:
+		h.conns.Add(-1)
+	}
+}
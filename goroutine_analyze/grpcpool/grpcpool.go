@@ -0,0 +1,246 @@
+// Package grpcpool 为 HelloServiceClient 提供固定大小的连接池：按轮询选择连接，
+// 跳过处于 TRANSIENT_FAILURE 的连接并在后台替换它们，按连接统计借用和失败次数。
+package grpcpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/gangcheng1030/ai_production_troubleshooting/goroutine_analyze/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// ErrClosed 连接池已经关闭
+var ErrClosed = errors.New("grpcpool: pool is closed")
+
+// Options 连接池配置
+type Options struct {
+	// Size 连接数，<= 0 时为 1
+	Size int
+	// ReplaceAfter 连接在 TRANSIENT_FAILURE 中停留多久后被替换，<= 0 时为 1s；
+	// 避免服务端不可用时反复重建连接
+	ReplaceAfter time.Duration
+	// DialOptions 创建每个连接时使用的选项
+	DialOptions []grpc.DialOption
+}
+
+// ConnStats 单个连接的统计
+type ConnStats struct {
+	Index int    `json:"index"`
+	State string `json:"state"`
+	// Checkouts 被选中发起 RPC 的次数
+	Checkouts uint64 `json:"checkouts"`
+	// Failures 返回错误的 RPC 数
+	Failures uint64 `json:"failures"`
+	// Replacements 因 TRANSIENT_FAILURE 被替换的次数
+	Replacements uint64 `json:"replacements"`
+}
+
+// slot 池中的一个位置；连接被替换时 slot 不变，统计累计在 slot 上
+type slot struct {
+	index int
+
+	mu     sync.RWMutex
+	conn   *grpc.ClientConn
+	client pb.HelloServiceClient
+
+	checkouts    atomic.Uint64
+	failures     atomic.Uint64
+	replacements atomic.Uint64
+}
+
+func (s *slot) get() (*grpc.ClientConn, pb.HelloServiceClient) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.conn, s.client
+}
+
+// Pool 实现 pb.HelloServiceClient，可以直接替换单连接的 client
+type Pool struct {
+	target string
+	opts   Options
+	slots  []*slot
+	next   atomic.Uint64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	closed atomic.Bool
+}
+
+var _ pb.HelloServiceClient = (*Pool)(nil)
+
+// New 创建 opts.Size 个连接，并为每个连接启动一个监视连接状态的 goroutine
+func New(target string, opts Options) (*Pool, error) {
+	if opts.Size <= 0 {
+		opts.Size = 1
+	}
+	if opts.ReplaceAfter <= 0 {
+		opts.ReplaceAfter = time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{target: target, opts: opts, ctx: ctx, cancel: cancel}
+	for i := 0; i < opts.Size; i++ {
+		conn, err := p.dial()
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("dial connection %d: %w", i, err)
+		}
+		s := &slot{index: i, conn: conn, client: pb.NewHelloServiceClient(conn)}
+		p.slots = append(p.slots, s)
+	}
+	for _, s := range p.slots {
+		p.wg.Add(1)
+		go p.watch(s)
+	}
+	return p, nil
+}
+
+func (p *Pool) dial() (*grpc.ClientConn, error) {
+	return grpc.Dial(p.target, p.opts.DialOptions...)
+}
+
+// pick 从上次的位置开始轮询，优先选择不处于 TRANSIENT_FAILURE 的连接；
+// 所有连接都不可用时仍按轮询返回，由 RPC 自己报错
+func (p *Pool) pick() *slot {
+	n := uint64(len(p.slots))
+	start := p.next.Add(1) - 1
+	for i := uint64(0); i < n; i++ {
+		s := p.slots[(start+i)%n]
+		conn, _ := s.get()
+		if st := conn.GetState(); st != connectivity.TransientFailure && st != connectivity.Shutdown {
+			return s
+		}
+	}
+	return p.slots[start%n]
+}
+
+// checkout 选出一个连接并记一次借用
+func (p *Pool) checkout() (*slot, pb.HelloServiceClient, error) {
+	if p.closed.Load() {
+		return nil, nil, ErrClosed
+	}
+	s := p.pick()
+	s.checkouts.Add(1)
+	_, client := s.get()
+	return s, client, nil
+}
+
+// SayHello 在轮询选出的连接上调用 SayHello
+func (p *Pool) SayHello(ctx context.Context, in *pb.HelloRequest, opts ...grpc.CallOption) (*pb.HelloResponse, error) {
+	s, client, err := p.checkout()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.SayHello(ctx, in, opts...)
+	if err != nil {
+		s.failures.Add(1)
+	}
+	return resp, err
+}
+
+// StreamHellos 在轮询选出的连接上打开服务端流；只统计打开流时的失败，
+// 流的生命周期由调用方负责（读到 io.EOF 或取消 ctx）
+func (p *Pool) StreamHellos(ctx context.Context, in *pb.HelloRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[pb.HelloResponse], error) {
+	s, client, err := p.checkout()
+	if err != nil {
+		return nil, err
+	}
+	stream, err := client.StreamHellos(ctx, in, opts...)
+	if err != nil {
+		s.failures.Add(1)
+	}
+	return stream, err
+}
+
+// Chat 在轮询选出的连接上打开双向流；只统计打开流时的失败
+func (p *Pool) Chat(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[pb.HelloRequest, pb.HelloResponse], error) {
+	s, client, err := p.checkout()
+	if err != nil {
+		return nil, err
+	}
+	stream, err := client.Chat(ctx, opts...)
+	if err != nil {
+		s.failures.Add(1)
+	}
+	return stream, err
+}
+
+// watch 等待连接状态变化；连接在 TRANSIENT_FAILURE 中停留超过 ReplaceAfter 时，
+// 新建一个连接替换它并关闭旧连接
+func (p *Pool) watch(s *slot) {
+	defer p.wg.Done()
+	for {
+		conn, _ := s.get()
+		state := conn.GetState()
+		if state == connectivity.TransientFailure {
+			ctx, cancel := context.WithTimeout(p.ctx, p.opts.ReplaceAfter)
+			changed := conn.WaitForStateChange(ctx, state)
+			cancel()
+			if p.ctx.Err() != nil {
+				return
+			}
+			if !changed {
+				p.replace(s, conn)
+			}
+			continue
+		}
+		if !conn.WaitForStateChange(p.ctx, state) {
+			return
+		}
+	}
+}
+
+func (p *Pool) replace(s *slot, old *grpc.ClientConn) {
+	conn, err := p.dial()
+	if err != nil {
+		// Dial 不阻塞，这里只会是参数错误，保留旧连接
+		return
+	}
+	s.mu.Lock()
+	s.conn, s.client = conn, pb.NewHelloServiceClient(conn)
+	s.mu.Unlock()
+	s.replacements.Add(1)
+	old.Close()
+}
+
+// Stats 返回每个连接的当前状态和统计
+func (p *Pool) Stats() []ConnStats {
+	stats := make([]ConnStats, 0, len(p.slots))
+	for _, s := range p.slots {
+		conn, _ := s.get()
+		stats = append(stats, ConnStats{
+			Index:        s.index,
+			State:        conn.GetState().String(),
+			Checkouts:    s.checkouts.Load(),
+			Failures:     s.failures.Load(),
+			Replacements: s.replacements.Load(),
+		})
+	}
+	return stats
+}
+
+// Size 连接数
+func (p *Pool) Size() int { return len(p.slots) }
+
+// Close 停止所有监视 goroutine 并关闭所有连接；之后的 RPC 返回 ErrClosed
+func (p *Pool) Close() error {
+	if !p.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	p.cancel()
+	p.wg.Wait()
+	var errs []error
+	for _, s := range p.slots {
+		conn, _ := s.get()
+		if err := conn.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close connection %d: %w", s.index, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,215 @@
+package grpcpool
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/gangcheng1030/ai_production_troubleshooting/goroutine_analyze/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// helloServer 名字为 "fail" 时返回错误
+type helloServer struct {
+	pb.UnimplementedHelloServiceServer
+}
+
+func (helloServer) SayHello(_ context.Context, in *pb.HelloRequest) (*pb.HelloResponse, error) {
+	if in.Name == "fail" {
+		return nil, status.Error(codes.Internal, "failed on purpose")
+	}
+	return &pb.HelloResponse{Message: "Hello " + in.Name}, nil
+}
+
+// newPool 在 bufconn 上启动 HelloService，并创建连向它的连接池
+func newPool(t *testing.T, opts Options) *Pool {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterHelloServiceServer(srv, helloServer{})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	opts.DialOptions = append(opts.DialOptions,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	p, err := New("passthrough:///bufnet", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+// failingConn 返回一个进入 TRANSIENT_FAILURE 的连接：每次建连都失败
+func failingConn(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+	conn, err := grpc.NewClient("passthrough:///unreachable",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return nil, errors.New("connection refused")
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Connect()
+	waitState(t, conn, connectivity.TransientFailure)
+	return conn
+}
+
+func waitState(t *testing.T, conn *grpc.ClientConn, want connectivity.State) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for st := conn.GetState(); st != want; st = conn.GetState() {
+		if !conn.WaitForStateChange(ctx, st) {
+			t.Fatalf("connection state = %v, want %v", st, want)
+		}
+	}
+}
+
+// setConn 把第 i 个连接换成 conn 并关闭原来的连接，监视 goroutine 会转而监视新连接
+func setConn(p *Pool, i int, conn *grpc.ClientConn) {
+	s := p.slots[i]
+	s.mu.Lock()
+	old := s.conn
+	s.conn, s.client = conn, pb.NewHelloServiceClient(conn)
+	s.mu.Unlock()
+	old.Close()
+}
+
+func sayHello(t *testing.T, p *Pool, name string) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := p.SayHello(ctx, &pb.HelloRequest{Name: name})
+	return err
+}
+
+func checkouts(p *Pool) []uint64 {
+	var n []uint64
+	for _, st := range p.Stats() {
+		n = append(n, st.Checkouts)
+	}
+	return n
+}
+
+func TestRoundRobin(t *testing.T) {
+	p := newPool(t, Options{Size: 3})
+	if p.Size() != 3 {
+		t.Fatalf("Size = %d, want 3", p.Size())
+	}
+	for i := 0; i < 6; i++ {
+		if err := sayHello(t, p, "world"); err != nil {
+			t.Fatalf("SayHello: %v", err)
+		}
+	}
+	for i, n := range checkouts(p) {
+		if n != 2 {
+			t.Errorf("connection %d checkouts = %d, want 2", i, n)
+		}
+	}
+}
+
+func TestSkipTransientFailure(t *testing.T) {
+	p := newPool(t, Options{Size: 3, ReplaceAfter: time.Minute})
+	setConn(p, 1, failingConn(t))
+
+	for i := 0; i < 6; i++ {
+		if err := sayHello(t, p, "world"); err != nil {
+			t.Fatalf("SayHello: %v", err)
+		}
+	}
+	// 轮到 1 时顺延到 2
+	got := checkouts(p)
+	if got[0] != 2 || got[1] != 0 || got[2] != 4 {
+		t.Errorf("checkouts = %v, want [2 0 4]", got)
+	}
+	if st := p.Stats()[1]; st.State != connectivity.TransientFailure.String() || st.Replacements != 0 {
+		t.Errorf("connection 1 = %+v, want TRANSIENT_FAILURE and not yet replaced", st)
+	}
+}
+
+func TestReplaceAfter(t *testing.T) {
+	p := newPool(t, Options{Size: 2, ReplaceAfter: 50 * time.Millisecond})
+	bad := failingConn(t)
+	setConn(p, 1, bad)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Stats()[1].Replacements == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("connection 1 was not replaced: %+v", p.Stats()[1])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st := bad.GetState(); st != connectivity.Shutdown {
+		t.Errorf("replaced connection state = %v, want SHUTDOWN", st)
+	}
+	// 新连接可用，轮询重新覆盖两个连接
+	for i := 0; i < 4; i++ {
+		if err := sayHello(t, p, "world"); err != nil {
+			t.Fatalf("SayHello after replacement: %v", err)
+		}
+	}
+	if got := checkouts(p); got[1] == 0 {
+		t.Errorf("checkouts = %v, replaced connection should be used again", got)
+	}
+}
+
+// 统计累计在各自的连接上
+func TestPerSlotCounters(t *testing.T) {
+	p := newPool(t, Options{Size: 2})
+	if err := sayHello(t, p, "world"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sayHello(t, p, "fail"); status.Code(err) != codes.Internal {
+		t.Fatalf("SayHello(fail) = %v, want Internal", err)
+	}
+	if err := sayHello(t, p, "fail"); err == nil {
+		t.Fatal("SayHello(fail) succeeded")
+	}
+
+	stats := p.Stats()
+	want := []ConnStats{{Index: 0, Checkouts: 2, Failures: 1}, {Index: 1, Checkouts: 1, Failures: 1}}
+	for i, st := range stats {
+		w := want[i]
+		if st.Index != w.Index || st.Checkouts != w.Checkouts || st.Failures != w.Failures {
+			t.Errorf("connection %d = %+v, want checkouts %d failures %d", i, st, w.Checkouts, w.Failures)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	p := newPool(t, Options{Size: 2})
+	if err := sayHello(t, p, "world"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+
+	if err := sayHello(t, p, "world"); !errors.Is(err, ErrClosed) {
+		t.Errorf("SayHello after Close = %v, want ErrClosed", err)
+	}
+	if _, err := p.StreamHellos(context.Background(), &pb.HelloRequest{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("StreamHellos after Close = %v, want ErrClosed", err)
+	}
+	if _, err := p.Chat(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("Chat after Close = %v, want ErrClosed", err)
+	}
+	for _, st := range p.Stats() {
+		if st.State != connectivity.Shutdown.String() {
+			t.Errorf("connection %d state = %s after Close", st.Index, st.State)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+#!/bin/bash
+
+# 服务端 keepalive 兜底演示：server 使用 -keepalive-max-idle 启动，
+# bad_client 泄漏的连接空闲超过 MAX_IDLE 后被服务端 GOAWAY 关闭，
+# 在 bad_client 进程仍然存活时，server 的 goroutine 数量就回落到初始值。
+#
+# 可以用环境变量调整：
+#   MAX_IDLE=5s ./keepalive_demo.sh
+#   SERVER_ARGS="-keepalive-max-age 10s -keepalive-max-age-grace 2s" ./keepalive_demo.sh
+
+set -e
+
+cd "$(dirname "$0")"
+
+MAX_IDLE=${MAX_IDLE:-3s}
+SERVER_ARGS=${SERVER_ARGS:-"-keepalive-max-idle $MAX_IDLE"}
+DURATION=${DURATION:-20}
+
+echo "========================================"
+echo "gRPC 服务端 keepalive 回收泄漏连接演示"
+echo "========================================"
+echo ""
+
+cleanup() {
+    echo ""
+    echo "=== 清理资源 ==="
+    if [ ! -z "$CLIENT_PID" ] && kill -0 $CLIENT_PID 2>/dev/null; then
+        kill $CLIENT_PID 2>/dev/null || true
+    fi
+    if [ ! -z "$SERVER_PID" ] && kill -0 $SERVER_PID 2>/dev/null; then
+        curl -s -X POST http://localhost:50052/exit >/dev/null 2>&1 || true
+        sleep 1
+        kill $SERVER_PID 2>/dev/null || true
+    fi
+    rm -rf "$BIN_DIR"
+    echo "✅ 清理完成"
+}
+trap cleanup EXIT INT TERM
+
+server_goroutines() {
+    curl -s http://localhost:50052/debug/pprof/goroutine?debug=1 | head -1 | grep -oE '[0-9]+' | head -1
+}
+
+if lsof -i :50051 >/dev/null 2>&1 || lsof -i :50052 >/dev/null 2>&1; then
+    echo "❌ 错误: 端口 50051 或 50052 已被占用"
+    lsof -i :50051,50052
+    exit 1
+fi
+
+# 先编译，避免 go run 的编译时间影响采样
+echo "📦 编译 server 和 bad_client..."
+BIN_DIR=$(mktemp -d)
+go build -o "$BIN_DIR/server" ./server
+go build -o "$BIN_DIR/bad_client" ./bad_client
+
+echo "🚀 启动 server: $SERVER_ARGS"
+"$BIN_DIR/server" $SERVER_ARGS > keepalive_server.log 2>&1 &
+SERVER_PID=$!
+
+for i in $(seq 1 10); do
+    if curl -s http://localhost:50052/readyz >/dev/null 2>&1; then
+        break
+    fi
+    sleep 1
+done
+INITIAL=$(server_goroutines)
+if [ -z "$INITIAL" ]; then
+    echo "❌ 错误: server 启动失败"
+    cat keepalive_server.log
+    exit 1
+fi
+echo "初始 goroutine 数量: $INITIAL"
+echo ""
+
+echo "🚀 启动 bad_client（每个请求一个连接，从不关闭，结束后再存活 10 秒）..."
+"$BIN_DIR/bad_client" -watchdog-dir "$BIN_DIR/watchdog" > keepalive_bad_client.log 2>&1 &
+CLIENT_PID=$!
+echo ""
+
+# 每秒采样一次 server 的 goroutine 数量，同时记录 bad_client 是否还在运行
+PEAK=0
+RECOVERED_AT=""
+echo "📊 server goroutine 时间线："
+for t in $(seq 1 $DURATION); do
+    sleep 1
+    G=$(server_goroutines)
+    if kill -0 $CLIENT_PID 2>/dev/null; then
+        STATE="bad_client 运行中"
+    else
+        STATE="bad_client 已退出"
+    fi
+    if [ "$G" -gt "$PEAK" ]; then
+        PEAK=$G
+    fi
+    # 峰值明显高于初始值之后又回到初始值附近，且 bad_client 仍在运行：连接是被服务端回收的
+    if [ -z "$RECOVERED_AT" ] && [ "$PEAK" -gt $((INITIAL + 30)) ] && [ "$G" -le $((INITIAL + 3)) ] && [ "$STATE" = "bad_client 运行中" ]; then
+        RECOVERED_AT=$t
+    fi
+    printf "   t=%2ds  goroutine=%5d  %s\n" "$t" "$G" "$STATE"
+done
+echo ""
+
+echo "========================================"
+echo "结果"
+echo "========================================"
+echo "   初始 goroutine: $INITIAL"
+echo "   峰值 goroutine: $PEAK"
+echo "   最终 goroutine: $(server_goroutines)"
+echo ""
+if [ ! -z "$RECOVERED_AT" ]; then
+    echo "✅ 第 ${RECOVERED_AT}s 时 bad_client 仍在运行，server 的 goroutine 已回落到初始值："
+    echo "   泄漏的连接空闲超过 keepalive-max-idle 后被服务端关闭，每个连接的 3 个 goroutine 随之退出"
+else
+    echo "⚠️  bad_client 运行期间 server 的 goroutine 没有回落"
+    echo "   不设置 -keepalive-max-idle 时这是预期结果：泄漏的连接一直保留到客户端进程退出"
+fi
+echo ""
+echo "💡 建议："
+echo "   1. 首先修复客户端：复用连接，用完 Close()（见 good_client）"
+echo "   2. 服务端兜底：-keepalive-max-idle 回收空闲的泄漏连接"
+echo "   3. 连接上有泄漏的流时连接不算空闲，需要 -keepalive-max-age 和 -keepalive-max-age-grace"
+echo "   4. -keepalive-time/-keepalive-timeout 探测已经失联的客户端（例如对端主机宕机）"
+echo ""
+echo "📁 日志: keepalive_server.log, keepalive_bad_client.log"
@@ -117,9 +117,11 @@ const file_proto_hello_proto_rawDesc = "" +
 	"\fHelloRequest\x12\x12\n" +
 	"\x04name\x18\x01 \x01(\tR\x04name\")\n" +
 	"\rHelloResponse\x12\x18\n" +
-	"\amessage\x18\x01 \x01(\tR\amessage2G\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage2\xbf\x01\n" +
 	"\fHelloService\x127\n" +
-	"\bSayHello\x12\x13.hello.HelloRequest\x1a\x14.hello.HelloResponse\"\x00BVZTgithub.com/gangcheng1030/ai_production_troubleshooting/goroutine_analyze/proto;hellob\x06proto3"
+	"\bSayHello\x12\x13.hello.HelloRequest\x1a\x14.hello.HelloResponse\"\x00\x12=\n" +
+	"\fStreamHellos\x12\x13.hello.HelloRequest\x1a\x14.hello.HelloResponse\"\x000\x01\x127\n" +
+	"\x04Chat\x12\x13.hello.HelloRequest\x1a\x14.hello.HelloResponse\"\x00(\x010\x01BVZTgithub.com/gangcheng1030/ai_production_troubleshooting/goroutine_analyze/proto;hellob\x06proto3"
 
 var (
 	file_proto_hello_proto_rawDescOnce sync.Once
@@ -140,9 +142,13 @@ var file_proto_hello_proto_goTypes = []any{
 }
 var file_proto_hello_proto_depIdxs = []int32{
 	0, // 0: hello.HelloService.SayHello:input_type -> hello.HelloRequest
-	1, // 1: hello.HelloService.SayHello:output_type -> hello.HelloResponse
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
+	0, // 1: hello.HelloService.StreamHellos:input_type -> hello.HelloRequest
+	0, // 2: hello.HelloService.Chat:input_type -> hello.HelloRequest
+	1, // 3: hello.HelloService.SayHello:output_type -> hello.HelloResponse
+	1, // 4: hello.HelloService.StreamHellos:output_type -> hello.HelloResponse
+	1, // 5: hello.HelloService.Chat:output_type -> hello.HelloResponse
+	3, // [3:6] is the sub-list for method output_type
+	0, // [0:3] is the sub-list for method input_type
 	0, // [0:0] is the sub-list for extension type_name
 	0, // [0:0] is the sub-list for extension extendee
 	0, // [0:0] is the sub-list for field type_name
@@ -2,18 +2,46 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
-	"net/http"
-	_ "net/http/pprof"
-	"runtime"
 	"time"
 
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/admin"
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/metrics"
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/watchdog"
+	"github.com/gangcheng1030/ai_production_troubleshooting/goroutine_analyze/grpcchannelz"
+	"github.com/gangcheng1030/ai_production_troubleshooting/goroutine_analyze/grpcconns"
+	"github.com/gangcheng1030/ai_production_troubleshooting/goroutine_analyze/grpckeepalive"
+	"github.com/gangcheng1030/ai_production_troubleshooting/goroutine_analyze/grpcmetrics"
 	pb "github.com/gangcheng1030/ai_production_troubleshooting/goroutine_analyze/proto"
 	"google.golang.org/grpc"
 )
 
+var (
+	addr      = flag.String("addr", ":50051", "gRPC server address")
+	adminOpts = admin.Flags(flag.CommandLine, admin.Options{
+		Addr:                 ":50052",
+		Name:                 "Server",
+		GoroutineLogInterval: 2 * time.Second,
+	})
+	watchdogOpts = watchdog.Flags(flag.CommandLine, watchdog.Options{
+		Name:            "Server",
+		Interval:        2 * time.Second,
+		MaxCaptures:     5,
+		CPUDuration:     2 * time.Second,
+		MaxGoroutines:   1000,
+		GoroutineGrowth: 50,
+	})
+	// 服务端兜底：-keepalive-max-idle 等参数让服务端关闭客户端泄漏的空闲连接，默认与 gRPC 一致（不关闭）
+	keepaliveOpts = grpckeepalive.Flags(flag.CommandLine, grpckeepalive.Options{})
+	// channelz 统计总是打开的（见 grpcchannelz 包注释），这个 flag 只决定是否注册查询服务
+	channelz       = flag.Bool("channelz", false, "register the grpc channelz service on the gRPC port (inspect with go run ./channelz)")
+	streamInterval = flag.Duration("stream-interval", 100*time.Millisecond, "interval between messages pushed by StreamHellos")
+)
+
 type server struct {
 	pb.UnimplementedHelloServiceServer
 }
@@ -24,38 +52,105 @@ func (s *server) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloR
 	}, nil
 }
 
+// StreamHellos 服务端流：按 -stream-interval 持续推送问候，直到客户端取消或断开连接；
+// 客户端既不读完也不取消时，处理这个流的 goroutine 会一直留在 select 中
+func (s *server) StreamHellos(req *pb.HelloRequest, stream pb.HelloService_StreamHellosServer) error {
+	ticker := time.NewTicker(*streamInterval)
+	defer ticker.Stop()
+	for i := 1; ; i++ {
+		if err := stream.Send(&pb.HelloResponse{Message: fmt.Sprintf("Hello #%d, %s!", i, req.Name)}); err != nil {
+			return err
+		}
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Chat 双向流：每收到一条消息回复一条，客户端 CloseSend 后返回；
+// 客户端既不 CloseSend 也不取消时，处理这个流的 goroutine 会一直阻塞在 Recv（recvBufferReader）中
+func (s *server) Chat(stream pb.HelloService_ChatServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&pb.HelloResponse{Message: fmt.Sprintf("Hello, %s!", req.Name)}); err != nil {
+			return err
+		}
+	}
+}
+
 func main() {
-	lis, err := net.Listen("tcp", ":50051")
+	flag.Parse()
+
+	lis, err := net.Listen("tcp", *addr)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
-	s := grpc.NewServer()
+	// 按连接跟踪对端地址、活动流数和 RPC 数，goroutine 暴涨时从服务端找出泄漏连接的客户端
+	conns := grpcconns.NewTracker()
+	// keepalive 参数决定泄漏的空闲连接能否被服务端回收
+	s := grpc.NewServer(append(keepaliveOpts.ServerOptions(),
+		// 按方法统计 RPC 数量、耗时以及当前连接数，通过管理端口的 /metrics 输出
+		grpc.StatsHandler(grpcmetrics.NewServerHandler(metrics.Default)),
+		grpc.StatsHandler(conns))...)
 	pb.RegisterHelloServiceServer(s, &server{})
+	if *channelz {
+		grpcchannelz.Register(s)
+	}
 
-	log.Printf("Server starting on :50051...")
-	log.Printf("pprof server starting on :50052")
-	log.Printf("访问 http://localhost:50052/debug/pprof 查看 pprof 信息")
-	log.Printf("查看 goroutine: http://localhost:50052/debug/pprof/goroutine?debug=2")
-	log.Println()
-
-	// 启动 pprof HTTP 服务器
-	go func() {
-		if err := http.ListenAndServe(":50052", nil); err != nil {
-			log.Printf("pprof server error: %v", err)
+	// 启动管理端口（pprof、/healthz、/exit 等），并定期打印 goroutine 数量
+	adm := admin.New(*adminOpts)
+	if err := adm.Start(); err != nil {
+		log.Fatalf("failed to start admin server: %v", err)
+	}
+	adm.Handle("/debug/connections", conns)
+	adm.OnShutdown(func(ctx context.Context) error {
+		// 优雅退出超时后强制关闭所有连接
+		err := admin.StopFunc(func() error {
+			s.GracefulStop()
+			return nil
+		})(ctx)
+		if err != nil {
+			s.Stop()
 		}
-	}()
+		return err
+	})
+
+	// goroutine 数量或增长率超过阈值时自动保存 goroutine/heap/CPU 快照
+	wdCtx, stopWatchdog := context.WithCancel(context.Background())
+	go watchdog.New(*watchdogOpts).Run(wdCtx)
+	adm.OnShutdown(func(ctx context.Context) error {
+		stopWatchdog()
+		return nil
+	})
+
+	log.Printf("Server starting on %s...", lis.Addr())
+	log.Printf("Keepalive: %s", keepaliveOpts)
+	if *channelz {
+		log.Printf("Channelz: go run ./channelz -addr %s", lis.Addr())
+	}
+	log.Printf("访问 http://%s/debug/pprof 查看 pprof 信息", adm.Addr())
+	log.Printf("查看 goroutine: http://%s/debug/pprof/goroutine?debug=2", adm.Addr())
+	log.Printf("查看指标: http://%s/metrics", adm.Addr())
+	log.Printf("查看连接: http://%s/debug/connections (?by=ip 只看按 IP 汇总)", adm.Addr())
+	log.Println()
 
-	// 启动 goroutine 监控
 	go func() {
-		ticker := time.NewTicker(2 * time.Second)
-		defer ticker.Stop()
-		for range ticker.C {
-			log.Printf("[Server] Current goroutines: %d", runtime.NumGoroutine())
+		if err := s.Serve(lis); err != nil {
+			log.Fatalf("failed to serve: %v", err)
 		}
 	}()
+	adm.SetReady(true)
 
-	if err := s.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	if err := adm.Wait(); err != nil {
+		log.Printf("shutdown error: %v", err)
 	}
 }
@@ -5,6 +5,8 @@
 # 1. 启动 server
 # 2. 启动 good_client，等待2秒，保存 goroutine 信息
 # 3. 启动 bad_client，等待2秒，保存 goroutine 信息
+# 4. 启动 good_stream_client / bad_stream_client，保存流泄漏时的 goroutine 信息，
+#    与连接泄漏的 goroutine 特征对比
 
 set -e  # 遇到错误立即退出
 
@@ -54,6 +56,16 @@ cleanup() {
 # 设置退出时自动清理
 trap cleanup EXIT INT TERM
 
+# 统计 debug=2 dump 中调用栈匹配指定模式的 goroutine 数量
+count_stacks() {
+    awk -v pat="$2" 'BEGIN { RS = "" } $0 ~ pat { n++ } END { print n + 0 }' "$1"
+}
+
+# 当前 server 的 goroutine 数量
+server_goroutines() {
+    curl -s http://localhost:50052/debug/pprof/goroutine?debug=1 | head -1 | grep -oE '[0-9]+' | head -1
+}
+
 # ============================================
 # 步骤 1: 启动 server
 # ============================================
@@ -174,7 +186,8 @@ echo "当前 goroutine 数量: $GOOD_GOROUTINES"
 # 保存 goroutine 分组统计信息
 GOOD_FILE="good_goroutine.txt"
 curl -s http://localhost:50052/debug/pprof/goroutine?debug=1 > "$GOOD_FILE"
-echo "✅ 已保存 goroutine 信息到 $GOOD_FILE"
+curl -s http://localhost:50052/debug/pprof/goroutine?debug=2 > "good_goroutine_debug2.txt"
+echo "✅ 已保存 goroutine 信息到 $GOOD_FILE, good_goroutine_debug2.txt"
 echo ""
 
 # 统计信息
@@ -214,7 +227,12 @@ echo "当前 goroutine 数量: $BAD_GOROUTINES"
 # 保存 goroutine 分组统计信息
 BAD_FILE="bad_goroutine.txt"
 curl -s http://localhost:50052/debug/pprof/goroutine?debug=1 > "$BAD_FILE"
-echo "✅ 已保存 goroutine 信息到 $BAD_FILE"
+curl -s http://localhost:50052/debug/pprof/goroutine?debug=2 > "bad_goroutine_debug2.txt"
+echo "✅ 已保存 goroutine 信息到 $BAD_FILE, bad_goroutine_debug2.txt"
+
+# 按对端 IP 汇总的连接，连接最多的客户端排在最前面
+curl -s "http://localhost:50052/debug/connections?by=ip" > bad_connections.json
+echo "✅ 已保存按 IP 汇总的连接到 bad_connections.json"
 echo ""
 
 # 统计信息
@@ -236,6 +254,45 @@ echo ""
 sleep 1
 FINAL_GOROUTINES=$(curl -s http://localhost:50052/debug/pprof/goroutine?debug=1 | head -1 | grep -oE '[0-9]+' | head -1)
 
+# ============================================
+# 步骤 4: 运行 good_stream_client / bad_stream_client 并采集数据
+# ============================================
+echo "步骤 4: 运行 good_stream_client (取消 ctx，CloseSend)"
+echo "----------------------------------------"
+
+# good_stream_client 运行结束后立即退出，流应该已经全部结束
+go run good_stream_client/main.go -hold 0 > good_stream_client.log 2>&1 || true
+sleep 1
+GOOD_STREAM_GOROUTINES=$(server_goroutines)
+curl -s http://localhost:50052/debug/pprof/goroutine?debug=2 > "good_stream_goroutine_debug2.txt"
+echo "当前 goroutine 数量: $GOOD_STREAM_GOROUTINES"
+echo "✅ 已保存 goroutine 信息到 good_stream_goroutine_debug2.txt"
+echo ""
+
+echo "步骤 5: 运行 bad_stream_client (流既不读完也不取消)"
+echo "----------------------------------------"
+go run bad_stream_client/main.go > bad_stream_client.log 2>&1 &
+CLIENT_PID=$!
+echo "Bad Stream Client PID: $CLIENT_PID"
+echo ""
+
+# 流泄漏只在 client 进程存活期间存在，client 退出后连接关闭，server 上的流随之结束
+echo "等待 5 秒，让客户端打开流..."
+sleep 5
+BAD_STREAM_GOROUTINES=$(server_goroutines)
+curl -s http://localhost:50052/debug/pprof/goroutine?debug=2 > "bad_stream_goroutine_debug2.txt"
+echo "当前 goroutine 数量: $BAD_STREAM_GOROUTINES"
+echo "✅ 已保存 goroutine 信息到 bad_stream_goroutine_debug2.txt"
+echo ""
+
+echo "等待 bad_stream_client 完成..."
+wait $CLIENT_PID 2>/dev/null || true
+CLIENT_PID=""
+sleep 1
+AFTER_STREAM_GOROUTINES=$(server_goroutines)
+echo "✅ Bad Stream Client 运行完成，goroutine: $AFTER_STREAM_GOROUTINES"
+echo ""
+
 # ============================================
 # 结果对比
 # ============================================
@@ -250,41 +307,44 @@ echo "   Good Client 期间: $GOOD_GOROUTINES (增加 $GOOD_INCREASE)"
 echo "   Good Client 之后: $AFTER_GOOD"
 echo "   Bad Client 期间:  $BAD_GOROUTINES (增加 $BAD_INCREASE)"
 echo "   最终状态:         $FINAL_GOROUTINES (累计泄漏 $((FINAL_GOROUTINES - INITIAL_GOROUTINES)))"
+echo "   Good Stream 之后: $GOOD_STREAM_GOROUTINES"
+echo "   Bad Stream 期间:  $BAD_STREAM_GOROUTINES (增加 $((BAD_STREAM_GOROUTINES - GOOD_STREAM_GOROUTINES)))"
+echo "   Bad Stream 退出后: $AFTER_STREAM_GOROUTINES"
+echo ""
+
+# 连接泄漏：每个连接在 server 上留下 loopyWriter、keepalive、读帧的 goroutine；
+# 流泄漏：连接数不变，每个流留下一个 handler goroutine（双向流阻塞在 recvBufferReader，服务端流停在 handler 的 select 中）
+echo "🧬 goroutine 特征对比（server 上的 goroutine 数）："
+printf "   %-40s %12s %12s\n" "调用栈特征" "连接泄漏" "流泄漏"
+for sig in "loopyWriter" "http2Server\\).keepalive" "recvBufferReader" "server\\).Chat" "server\\).StreamHellos"; do
+    printf "   %-40s %12s %12s\n" "${sig//\\/}" \
+        "$(count_stacks bad_goroutine_debug2.txt "$sig")" \
+        "$(count_stacks bad_stream_goroutine_debug2.txt "$sig")"
+done
 echo ""
 
 echo "📁 生成的文件："
 echo "   $GOOD_FILE - Good Client 的 goroutine 信息"
 echo "   $BAD_FILE  - Bad Client 的 goroutine 信息"
+echo "   good_stream_goroutine_debug2.txt - Good Stream Client 之后的 goroutine 信息"
+echo "   bad_stream_goroutine_debug2.txt  - Bad Stream Client 期间的 goroutine 信息（流泄漏）"
+echo "   bad_connections.json - Bad Client 期间 server 上按对端 IP 汇总的连接"
 echo "   server.log      - Server 日志"
 echo "   good_client.log - Good Client 日志"
 echo "   bad_client.log  - Bad Client 日志"
+echo "   watchdog/       - goroutine 超过阈值时 server/client 自动保存的快照"
 echo ""
 
 # 分析泄漏的 goroutine
 echo "🔍 分析泄漏的 goroutine："
 echo ""
 
-# 统计 good_goroutine 中的 goroutine 数量
-GOOD_COUNT=$(grep -c "^goroutine " "$GOOD_FILE" || true)
-echo "✅ Good Client: $GOOD_COUNT 个 goroutine"
-
-# 统计 bad_goroutine 中的 goroutine 数量
-BAD_COUNT=$(grep -c "^goroutine " "$BAD_FILE" || true)
-echo "❌ Bad Client:  $BAD_COUNT 个 goroutine"
-
-# 统计泄漏的 gRPC 相关 goroutine
-GOOD_GRPC=$(grep -c "grpc" "$GOOD_FILE" || true)
-BAD_GRPC=$(grep -c "grpc" "$BAD_FILE" || true)
+# 按调用栈分组对比，按增长排序并归因到 created by
+go run ./goroutinediff -base good_goroutine_debug2.txt -target bad_goroutine_debug2.txt -top 10
 echo ""
-echo "gRPC 相关的 goroutine："
-echo "   Good Client: $GOOD_GRPC 个"
-echo "   Bad Client:  $BAD_GRPC 个"
+echo "🔍 分析泄漏的流："
 echo ""
-
-# 提取最频繁的堆栈
-echo "Bad Client 中最频繁的堆栈 (前5个):"
-grep "^goroutine " "$BAD_FILE" | head -5
-
+go run ./goroutinediff -base good_stream_goroutine_debug2.txt -target bad_stream_goroutine_debug2.txt -top 10
 echo ""
 echo "========================================"
 echo "分析建议"
@@ -297,7 +357,7 @@ echo "2️⃣  查看 Bad Client 的 goroutine 信息："
 echo "   cat $BAD_FILE"
 echo ""
 echo "3️⃣  对比两个文件的差异："
-echo "   diff <(grep '^goroutine' $GOOD_FILE | sort | uniq) <(grep '^goroutine' $BAD_FILE | sort | uniq)"
+echo "   go run ./goroutinediff -base $GOOD_FILE -target $BAD_FILE"
 echo ""
 echo "4️⃣  查看泄漏的 gRPC goroutine："
 echo "   grep -A 10 'grpc.*transport' $BAD_FILE | head -50"
@@ -305,6 +365,23 @@ echo ""
 echo "5️⃣  查看客户端日志："
 echo "   cat good_client.log"
 echo "   cat bad_client.log"
+echo "   cat good_stream_client.log"
+echo "   cat bad_stream_client.log"
+echo ""
+echo "6️⃣  比较不同连接池大小下的 goroutine 数量（需要 server 在运行）："
+echo "   go run good_client/main.go -concurrency 32 -pool-sizes 1,4,16"
+echo ""
+echo "7️⃣  从服务端定位泄漏连接的客户端（连接数、空闲连接数、RPC 数按 IP 汇总）："
+echo "   head -20 bad_connections.json"
+echo "   curl -s http://localhost:50052/debug/connections?by=ip   # server 运行时"
+echo ""
+echo "8️⃣  服务端兜底：用 keepalive 回收 bad_client 泄漏的空闲连接："
+echo "   ./keepalive_demo.sh"
+echo ""
+echo "9️⃣  用 channelz 直接查看 bad_client 创建的 ClientConn（调用数、空闲时间、socket）："
+echo "   go run server/main.go -channelz"
+echo "   go run bad_client/main.go -channelz-addr localhost:50061"
+echo "   go run ./channelz -addr localhost:50061   # 查看 server: -addr localhost:50051"
 echo ""
 
 echo "========================================"
@@ -313,9 +390,9 @@ echo "========================================"
 echo ""
 
 echo "删除日志文件..."
-rm -f server.log good_client.log bad_client.log
+rm -f server.log good_client.log bad_client.log good_stream_client.log bad_stream_client.log
 echo "✅ 日志文件已删除"
-echo "保留的文件: $GOOD_FILE, $BAD_FILE"
+echo "保留的文件: $GOOD_FILE, $BAD_FILE, good_goroutine_debug2.txt, bad_goroutine_debug2.txt, good_stream_goroutine_debug2.txt, bad_stream_goroutine_debug2.txt, bad_connections.json"
 
 echo ""
 echo "再见！"
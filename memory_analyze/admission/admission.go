@@ -0,0 +1,302 @@
+// Package admission 是上传接口的准入控制：限制同时处理的上传数量和在途请求体的总字节数。
+// 超过限制的请求直接返回 503 + Retry-After（shed），或者按到达顺序排队等待，超时后再返回 503。
+// bad server 把整个请求体读进内存，没有准入控制时 10 个并发的 16MB 上传就能占用 160MB 以上。
+package admission
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/metrics"
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/units"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	// ErrShed 超过限制且不排队（或队列已满）
+	ErrShed = errors.New("upload limit reached")
+	// ErrQueueTimeout 排队超时
+	ErrQueueTimeout = errors.New("timed out waiting for upload slot")
+	// ErrTooLarge 单个请求体超过在途字节预算，永远不可能被接纳
+	ErrTooLarge = errors.New("request body exceeds in-flight byte budget")
+)
+
+// Options 准入控制配置；MaxConcurrent 和 MaxInflight 都为空时不做限制
+type Options struct {
+	// MaxConcurrent 同时处理的上传数量上限，0 表示不限制
+	MaxConcurrent int
+	// MaxInflight 在途请求体总字节数上限，例如 64MiB；空或 0 表示不限制
+	MaxInflight string
+	// QueueTimeout 超过限制时排队等待的最长时间，0 表示不排队直接返回 503
+	QueueTimeout time.Duration
+	// MaxQueue 最多排队的请求数，0 表示不限制
+	MaxQueue int
+	// RetryAfter 503 响应中 Retry-After 建议的等待时间
+	RetryAfter time.Duration
+}
+
+// Flags 在 fs 上注册准入控制相关的 flag
+func Flags(fs *flag.FlagSet, defaults Options) *Options {
+	opts := defaults
+	if opts.RetryAfter == 0 {
+		opts.RetryAfter = time.Second
+	}
+	fs.IntVar(&opts.MaxConcurrent, "max-uploads", opts.MaxConcurrent, "max concurrent /upload requests (0 disables the limit)")
+	fs.StringVar(&opts.MaxInflight, "max-inflight-bytes", opts.MaxInflight, "max total body bytes of in-flight /upload requests, e.g. 64MiB (0 disables the budget)")
+	fs.DurationVar(&opts.QueueTimeout, "queue-timeout", opts.QueueTimeout, "wait up to this long for a slot when over the limit (0 sheds immediately with 503)")
+	fs.IntVar(&opts.MaxQueue, "max-queue", opts.MaxQueue, "max number of queued /upload requests (0 means unbounded)")
+	fs.DurationVar(&opts.RetryAfter, "retry-after", opts.RetryAfter, "Retry-After sent with 503 responses")
+	return &opts
+}
+
+// New 按配置创建 Limiter，没有任何限制时返回 nil（nil Limiter 的包装函数直接返回原 handler）。
+// 指标注册在 reg 中，前缀为 upload_admission
+func (o Options) New(reg *metrics.Registry) (*Limiter, error) {
+	var maxBytes int64
+	if o.MaxInflight != "" && o.MaxInflight != "0" {
+		n, err := units.ParseSize(o.MaxInflight)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max inflight bytes: %w", err)
+		}
+		maxBytes = n
+	}
+	if o.MaxConcurrent < 0 || o.MaxQueue < 0 {
+		return nil, fmt.Errorf("max uploads and max queue must not be negative")
+	}
+	if o.MaxConcurrent == 0 && maxBytes == 0 {
+		return nil, nil
+	}
+	l := &Limiter{
+		maxConcurrent: o.MaxConcurrent,
+		maxBytes:      maxBytes,
+		queueTimeout:  o.QueueTimeout,
+		maxQueue:      o.MaxQueue,
+		retryAfter:    o.RetryAfter,
+		admitted:      reg.NewCounter("upload_admission_admitted_total", "Total number of uploads admitted, directly or after queueing."),
+		queued:        reg.NewCounter("upload_admission_queued_total", "Total number of uploads that had to wait in the queue."),
+		shed:          reg.NewCounterVec("upload_admission_shed_total", "Total number of uploads rejected by admission control by reason.", "reason"),
+		wait:          reg.NewHistogramVec("upload_admission_queue_wait_seconds", "Time queued uploads waited before being admitted, timing out or being canceled.", nil, "result"),
+	}
+	reg.NewGaugeFunc("upload_admission_in_flight", "Number of admitted uploads currently being processed.",
+		func() float64 { return float64(l.snapshot().active) })
+	reg.NewGaugeFunc("upload_admission_in_flight_bytes", "Body bytes reserved by admitted uploads.",
+		func() float64 { return float64(l.snapshot().bytes) })
+	reg.NewGaugeFunc("upload_admission_queue_length", "Number of uploads currently waiting in the queue.",
+		func() float64 { return float64(l.snapshot().queued) })
+	return l, nil
+}
+
+// Limiter 按到达顺序（FIFO）接纳请求，同时限制并发数和在途字节数
+type Limiter struct {
+	maxConcurrent int
+	maxBytes      int64
+	queueTimeout  time.Duration
+	maxQueue      int
+	retryAfter    time.Duration
+
+	mu      sync.Mutex
+	active  int
+	bytes   int64
+	waiters list.List // *waiter
+
+	admitted *metrics.Counter
+	queued   *metrics.Counter
+	shed     metrics.CounterVec
+	wait     metrics.HistogramVec
+}
+
+type waiter struct {
+	size  int64
+	ready chan struct{}
+	// admitted 由 notify 在持有 l.mu 时设置，等待方超时或取消后以它为准
+	admitted bool
+}
+
+// Acquire 为一个请求体大小为 size 的请求申请额度，成功时返回的 release 必须在处理结束后调用一次
+func (l *Limiter) Acquire(ctx context.Context, size int64) (release func(), err error) {
+	if size < 0 {
+		size = 0
+	}
+	if l.maxBytes > 0 && size > l.maxBytes {
+		l.shed.With("too_large").Inc()
+		return nil, ErrTooLarge
+	}
+
+	l.mu.Lock()
+	// 已经有请求在排队时不插队
+	if l.waiters.Len() == 0 && l.fits(size) {
+		l.take(size)
+		l.mu.Unlock()
+		l.admitted.Inc()
+		return l.releaseFunc(size), nil
+	}
+	if l.queueTimeout <= 0 || (l.maxQueue > 0 && l.waiters.Len() >= l.maxQueue) {
+		l.mu.Unlock()
+		l.shed.With("full").Inc()
+		return nil, ErrShed
+	}
+	w := &waiter{size: size, ready: make(chan struct{})}
+	elem := l.waiters.PushBack(w)
+	l.mu.Unlock()
+	l.queued.Inc()
+
+	start := time.Now()
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case <-w.ready:
+	case <-timer.C:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	// 超时或取消的同时可能刚好被 notify 接纳：以持锁时的状态为准，已经占用的额度直接使用，
+	// 否则这份额度既没有被使用也不会被释放
+	l.mu.Lock()
+	if w.admitted {
+		l.mu.Unlock()
+		l.wait.With("admitted").Observe(time.Since(start).Seconds())
+		l.admitted.Inc()
+		return l.releaseFunc(size), nil
+	}
+	l.waiters.Remove(elem)
+	// 队首离开后，后面较小的请求可能已经可以接纳
+	l.notify()
+	l.mu.Unlock()
+
+	reason := "queue_timeout"
+	if !errors.Is(err, ErrQueueTimeout) {
+		reason = "canceled"
+	}
+	l.wait.With(reason).Observe(time.Since(start).Seconds())
+	l.shed.With(reason).Inc()
+	return nil, err
+}
+
+func (l *Limiter) fits(size int64) bool {
+	if l.maxConcurrent > 0 && l.active >= l.maxConcurrent {
+		return false
+	}
+	// 空闲时总是接纳一个请求，保证不会因为单个请求接近预算而饿死
+	return l.maxBytes == 0 || l.active == 0 || l.bytes+size <= l.maxBytes
+}
+
+func (l *Limiter) take(size int64) {
+	l.active++
+	l.bytes += size
+}
+
+// notify 按顺序唤醒能够接纳的排队请求，调用时持有 l.mu
+func (l *Limiter) notify() {
+	for e := l.waiters.Front(); e != nil; e = l.waiters.Front() {
+		w := e.Value.(*waiter)
+		if !l.fits(w.size) {
+			return
+		}
+		l.take(w.size)
+		l.waiters.Remove(e)
+		w.admitted = true
+		close(w.ready)
+	}
+}
+
+func (l *Limiter) releaseFunc(size int64) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			l.active--
+			l.bytes -= size
+			l.notify()
+			l.mu.Unlock()
+		})
+	}
+}
+
+type snapshot struct {
+	active, queued int
+	bytes          int64
+}
+
+func (l *Limiter) snapshot() snapshot {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return snapshot{active: l.active, queued: l.waiters.Len(), bytes: l.bytes}
+}
+
+// reject 返回拒绝请求时的状态码和 Retry-After 秒数
+func (l *Limiter) reject(err error) (int, string) {
+	if errors.Is(err, ErrTooLarge) {
+		return http.StatusRequestEntityTooLarge, ""
+	}
+	return http.StatusServiceUnavailable, strconv.Itoa(int(math.Ceil(l.retryAfter.Seconds())))
+}
+
+// chargedSize 请求占用的预算：Content-Length；chunked 上传大小未知时按 maxBody 计算，
+// 但不超过在途字节预算，否则所有 chunked 上传都会被当成 ErrTooLarge 拒绝
+func (l *Limiter) chargedSize(contentLength, maxBody int64) int64 {
+	if contentLength >= 0 {
+		return contentLength
+	}
+	if l.maxBytes > 0 && maxBody > l.maxBytes {
+		return l.maxBytes
+	}
+	return maxBody
+}
+
+// FastHTTP 包装 fasthttp 的上传 handler。被拒绝的请求体以小缓冲区丢弃而不是留在内存中：
+// 直接关闭连接会让仍在发送请求体的客户端收到 RST，看不到 503 响应
+func (l *Limiter) FastHTTP(h fasthttp.RequestHandler, maxBody int64) fasthttp.RequestHandler {
+	if l == nil {
+		return h
+	}
+	return func(ctx *fasthttp.RequestCtx) {
+		release, err := l.Acquire(ctx, l.chargedSize(int64(ctx.Request.Header.ContentLength()), maxBody))
+		if err != nil {
+			status, retryAfter := l.reject(err)
+			if retryAfter != "" {
+				ctx.Response.Header.Set("Retry-After", retryAfter)
+			}
+			if ctx.RequestBodyStream() != nil {
+				io.Copy(io.Discard, ctx.RequestBodyStream())
+			}
+			ctx.Error(err.Error(), status)
+			return
+		}
+		defer release()
+		h(ctx)
+	}
+}
+
+// Wrap 包装 net/http 的上传 handler；被拒绝的请求不读取请求体，响应后关闭连接。
+// net/http 最多替 handler 丢弃 256KB 未读的请求体，超过后直接关闭连接，
+// 所以大文件上传被拒绝时客户端可能还在发送，收到的是 connection reset 而不是 503
+func (l *Limiter) Wrap(h http.Handler, maxBody int64) http.Handler {
+	if l == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, err := l.Acquire(r.Context(), l.chargedSize(r.ContentLength, maxBody))
+		if err != nil {
+			status, retryAfter := l.reject(err)
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.Header().Set("Connection", "close")
+			http.Error(w, err.Error(), status)
+			return
+		}
+		defer release()
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,301 @@
+package admission
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/metrics"
+)
+
+func newLimiter(t *testing.T, o Options) *Limiter {
+	t.Helper()
+	l, err := o.New(metrics.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l == nil {
+		t.Fatalf("New(%+v) returned a nil limiter", o)
+	}
+	return l
+}
+
+// acquired 在后台调用 Acquire，返回的 channel 在 Acquire 返回后收到结果
+type acquired struct {
+	release func()
+	err     error
+}
+
+func acquireAsync(l *Limiter, ctx context.Context, size int64) <-chan acquired {
+	ch := make(chan acquired, 1)
+	go func() {
+		release, err := l.Acquire(ctx, size)
+		ch <- acquired{release, err}
+	}()
+	return ch
+}
+
+// waitQueued 等待排队的请求数达到 n
+func waitQueued(t *testing.T, l *Limiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for l.snapshot().queued != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue length = %d, want %d", l.snapshot().queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func mustAcquire(t *testing.T, l *Limiter, size int64) func() {
+	t.Helper()
+	release, err := l.Acquire(context.Background(), size)
+	if err != nil {
+		t.Fatalf("Acquire(%d): %v", size, err)
+	}
+	return release
+}
+
+func TestNoLimit(t *testing.T) {
+	l, err := Options{}.New(metrics.NewRegistry())
+	if err != nil || l != nil {
+		t.Fatalf("New without limits = %v, %v; want nil, nil", l, err)
+	}
+	h := http.NotFoundHandler()
+	if got := l.Wrap(h, 1<<20); got == nil {
+		t.Error("nil limiter should return the handler unchanged")
+	}
+}
+
+func TestShed(t *testing.T) {
+	l := newLimiter(t, Options{MaxConcurrent: 1, MaxInflight: "1KiB"})
+	release := mustAcquire(t, l, 100)
+
+	if _, err := l.Acquire(context.Background(), 100); !errors.Is(err, ErrShed) {
+		t.Errorf("second Acquire without queueing: err = %v, want ErrShed", err)
+	}
+	if _, err := l.Acquire(context.Background(), 2048); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Acquire over the byte budget: err = %v, want ErrTooLarge", err)
+	}
+
+	release()
+	release() // 多次调用只释放一次
+	if s := l.snapshot(); s.active != 0 || s.bytes != 0 {
+		t.Errorf("after release: active %d, bytes %d; want 0, 0", s.active, s.bytes)
+	}
+	mustAcquire(t, l, 100)()
+}
+
+func TestQueueFull(t *testing.T) {
+	l := newLimiter(t, Options{MaxConcurrent: 1, QueueTimeout: time.Minute, MaxQueue: 1})
+	release := mustAcquire(t, l, 0)
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queued := acquireAsync(l, ctx, 0)
+	waitQueued(t, l, 1)
+	if _, err := l.Acquire(context.Background(), 0); !errors.Is(err, ErrShed) {
+		t.Errorf("Acquire with a full queue: err = %v, want ErrShed", err)
+	}
+
+	// 取消排队的请求后它离开队列
+	cancel()
+	if r := <-queued; !errors.Is(r.err, context.Canceled) {
+		t.Errorf("canceled waiter: err = %v, want context.Canceled", r.err)
+	}
+	if s := l.snapshot(); s.queued != 0 || s.active != 1 {
+		t.Errorf("after cancel: queued %d, active %d; want 0, 1", s.queued, s.active)
+	}
+}
+
+func TestQueueThenAdmit(t *testing.T) {
+	l := newLimiter(t, Options{MaxConcurrent: 1, QueueTimeout: time.Minute})
+	release := mustAcquire(t, l, 0)
+
+	queued := acquireAsync(l, context.Background(), 0)
+	waitQueued(t, l, 1)
+	select {
+	case r := <-queued:
+		t.Fatalf("queued Acquire returned before a slot was released: %v", r.err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	release()
+	r := <-queued
+	if r.err != nil {
+		t.Fatalf("queued Acquire: %v", r.err)
+	}
+	if s := l.snapshot(); s.active != 1 || s.queued != 0 {
+		t.Errorf("after admit: active %d, queued %d; want 1, 0", s.active, s.queued)
+	}
+	r.release()
+}
+
+func TestQueueTimeout(t *testing.T) {
+	l := newLimiter(t, Options{MaxConcurrent: 1, QueueTimeout: 10 * time.Millisecond})
+	release := mustAcquire(t, l, 0)
+	defer release()
+
+	if _, err := l.Acquire(context.Background(), 0); !errors.Is(err, ErrQueueTimeout) {
+		t.Errorf("err = %v, want ErrQueueTimeout", err)
+	}
+	if s := l.snapshot(); s.queued != 0 || s.active != 1 {
+		t.Errorf("after timeout: queued %d, active %d; want 0, 1", s.queued, s.active)
+	}
+}
+
+// 等待方超时（这里用取消代替）的同时被 notify 接纳：必须返回成功并持有额度，
+// 不能既返回错误又占着额度
+func TestTimeoutWhileBeingAdmitted(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		l := newLimiter(t, Options{MaxConcurrent: 1, QueueTimeout: time.Minute})
+		// 这份额度在下面持锁时手动释放
+		mustAcquire(t, l, 0)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		queued := acquireAsync(l, ctx, 0)
+		waitQueued(t, l, 1)
+
+		// 在同一把锁内释放额度、接纳等待方并取消它的 ctx，等待方醒来时两个事件都已发生
+		l.mu.Lock()
+		l.active--
+		l.notify()
+		cancel()
+		l.mu.Unlock()
+
+		r := <-queued
+		if r.err != nil {
+			t.Fatalf("waiter admitted before it gave up: err = %v, want success", r.err)
+		}
+		if s := l.snapshot(); s.active != 1 || s.queued != 0 {
+			t.Fatalf("active %d, queued %d; want 1, 0", s.active, s.queued)
+		}
+		r.release()
+		if s := l.snapshot(); s.active != 0 {
+			t.Fatalf("after release: active %d, want 0", s.active)
+		}
+	}
+}
+
+// 释放时按到达顺序接纳；有请求排队时，新请求即使放得下也不能插队
+func TestReleaseOrdering(t *testing.T) {
+	l := newLimiter(t, Options{MaxInflight: "100", QueueTimeout: time.Minute})
+	release := mustAcquire(t, l, 60)
+
+	large := acquireAsync(l, context.Background(), 50)
+	waitQueued(t, l, 1)
+	small := acquireAsync(l, context.Background(), 10)
+	waitQueued(t, l, 2)
+	// 10 字节放得下，但队首的 50 字节还在等待
+	select {
+	case r := <-small:
+		t.Fatalf("small request jumped the queue: err = %v", r.err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	release()
+	rl, rs := <-large, <-small
+	if rl.err != nil || rs.err != nil {
+		t.Fatalf("queued requests: %v, %v", rl.err, rs.err)
+	}
+	if s := l.snapshot(); s.active != 2 || s.bytes != 60 {
+		t.Errorf("active %d, bytes %d; want 2, 60", s.active, s.bytes)
+	}
+
+	// 队首是 90 字节：释放 10 字节后仍然放不下，释放 50 字节后才接纳
+	head := acquireAsync(l, context.Background(), 90)
+	waitQueued(t, l, 1)
+	rs.release()
+	if s := l.snapshot(); s.queued != 1 {
+		t.Errorf("90 byte request admitted with %d bytes in flight", s.bytes)
+	}
+	rl.release()
+	if r := <-head; r.err != nil {
+		t.Fatalf("head request: %v", r.err)
+	} else {
+		r.release()
+	}
+}
+
+func TestChargedSize(t *testing.T) {
+	l := newLimiter(t, Options{MaxInflight: "64MiB"})
+	tests := []struct {
+		contentLength, maxBody, want int64
+	}{
+		{1024, 100 << 20, 1024},
+		// chunked：按 maxBody 计算，但不超过在途字节预算
+		{-1, 100 << 20, 64 << 20},
+		{-1, 16 << 20, 16 << 20},
+	}
+	for _, tt := range tests {
+		if got := l.chargedSize(tt.contentLength, tt.maxBody); got != tt.want {
+			t.Errorf("chargedSize(%d, %d) = %d, want %d", tt.contentLength, tt.maxBody, got, tt.want)
+		}
+	}
+}
+
+// 大小未知的 chunked 上传在 maxBody 大于预算时也应被接纳，而不是 413
+func TestWrapChunkedUpload(t *testing.T) {
+	l := newLimiter(t, Options{MaxInflight: "1MiB"})
+	h := l.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s := l.snapshot(); s.bytes != 1<<20 {
+			t.Errorf("in-flight bytes = %d, want the whole 1MiB budget", s.bytes)
+		}
+	}), 100<<20)
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("data"))
+	req.ContentLength = -1
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("chunked upload: status %d, want 200", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("data"))
+	req.ContentLength = 2 << 20
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("upload over the budget: status %d, want 413", rec.Code)
+	}
+}
+
+// 排队等待时间按结果分开统计：取消的请求不能记成超时
+func TestQueueWaitResult(t *testing.T) {
+	reg := metrics.NewRegistry()
+	l, err := Options{MaxConcurrent: 1, QueueTimeout: 20 * time.Millisecond}.New(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := mustAcquire(t, l, 0)
+	defer release()
+
+	if _, err := l.Acquire(context.Background(), 0); !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("err = %v, want ErrQueueTimeout", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	queued := acquireAsync(l, ctx, 0)
+	waitQueued(t, l, 1)
+	cancel()
+	if r := <-queued; !errors.Is(r.err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", r.err)
+	}
+
+	var b strings.Builder
+	if err := reg.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`upload_admission_queue_wait_seconds_count{result="queue_timeout"} 1`,
+		`upload_admission_queue_wait_seconds_count{result="canceled"} 1`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics missing %s:\n%s", want, b.String())
+		}
+	}
+}
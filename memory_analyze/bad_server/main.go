@@ -1,105 +1,166 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	_ "net/http/pprof"
-	"os"
-	"runtime"
 	"time"
 
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/admin"
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/metrics"
+	"github.com/gangcheng1030/ai_production_troubleshooting/memory_analyze/bufpool"
+	"github.com/gangcheng1030/ai_production_troubleshooting/memory_analyze/memserver"
+	"github.com/gangcheng1030/ai_production_troubleshooting/memory_analyze/retain"
+	"github.com/gangcheng1030/ai_production_troubleshooting/memory_analyze/sink"
 	"github.com/valyala/fasthttp"
 )
 
+// maxBodySize 请求体大小上限；chunked 上传大小未知时，准入控制按这个大小预留额度
+const maxBodySize = 100 * 1024 * 1024 // 100MB
+
+var (
+	addr = flag.String("addr", ":8080", "HTTP server address")
+	// 管理端口、watchdog、内存上限和准入控制
+	serverOpts = memserver.Flags(flag.CommandLine, "BadServer")
+	// 与 good_server 使用同一组 sink，但不使用 -budget：请求体总是完整地读进内存
+	sinkOpts = sink.Flags(flag.CommandLine, sink.Options{})
+	// 滞留场景：把请求体读进带统计的缓冲区池，-pool-max-cap 丢弃超过容量上限的缓冲区（修复）
+	pooled   = flag.Bool("pooled", false, "read bodies into an instrumented buffer pool instead of ctx.Request.Body(), stats at /debug/bufpool on the admin port")
+	poolOpts = bufpool.Flags(flag.CommandLine, bufpool.Options{})
+	// 引用滞留场景：把请求体保存在全局 map、后台队列或子切片中；ttl 为对照的好实现
+	retainOpts = retain.Flags(flag.CommandLine, retain.Options{})
+)
+
 var (
-	addr      = flag.String("addr", ":8080", "HTTP server address")
-	pprofAddr = flag.String("pprof", ":6060", "pprof HTTP server address")
+	uploadSink sink.Sink
+	// bodyPool 只在 -pooled 时使用
+	bodyPool *bufpool.Pool
+	// retainStore 只在 -retain 时使用
+	retainStore retain.Store
+	// 管理端口 /metrics 中的 http_server_* 指标
+	httpMetrics = metrics.NewHTTPMetrics(metrics.Default, "http_server")
 )
 
 // 坏的实现：直接访问 Request.Body 可能导致内存问题
+// 整个请求体先被读进内存，再一次性写入 sink
 func badHandler(ctx *fasthttp.RequestCtx) {
-	body := ctx.Request.Body()
+	var body []byte
+	if bodyPool != nil {
+		// 与 fasthttp 内部一样用 ByteBuffer.ReadFrom 读取整个请求体，缓冲区用完后放回池中，
+		// 容量保持为最大一次上传的大小
+		buf := bodyPool.Get()
+		defer bodyPool.Put(buf)
+		if _, err := buf.ReadFrom(ctx.RequestBodyStream()); err != nil {
+			log.Printf("ERROR: Failed to read body: %v", err)
+			ctx.Error("Bad Request: incomplete body", fasthttp.StatusBadRequest)
+			return
+		}
+		body = buf.B
+	} else {
+		body = ctx.Request.Body()
+	}
+	httpMetrics.AddReceived("/upload", int64(len(body)))
 
 	// 模拟处理
 	size := len(body)
 
-	// 故意不释放，模拟可能的内存泄漏场景
-	// 在实际场景中，可能是将 body 传递给其他函数或存储引用
-
-	ctx.Response.Header.SetContentType("application/json")
-	ctx.SetStatusCode(fasthttp.StatusOK)
-	fmt.Fprintf(ctx, `{"status":"success","size":%d,"mode":"bad"}`, size)
-}
-
-// 强制 GC 端点（仅用于测试）
-func gcHandler(ctx *fasthttp.RequestCtx) {
-	if ctx.RequestBodyStream() != nil {
-		io.Copy(io.Discard, ctx.RequestBodyStream())
+	// 在实际场景中，内存泄漏往往来自把 body 传递给其他函数或存储引用，用 -retain 选择具体的方式
+	if retainStore != nil {
+		retainStore.Keep(body)
 	}
-	runtime.GC()
-	ctx.Response.Header.SetContentType("application/json")
-	ctx.SetStatusCode(fasthttp.StatusOK)
-	fmt.Fprintf(ctx, `{"status":"gc triggered"}`)
-}
 
-// 退出
-func exitHandler(ctx *fasthttp.RequestCtx) {
-	if ctx.RequestBodyStream() != nil {
-		io.Copy(io.Discard, ctx.RequestBodyStream())
+	upload, err := uploadSink.Open(ctx, int64(size))
+	if err != nil {
+		log.Printf("ERROR: Failed to open %s sink: %v", uploadSink.Name(), err)
+		ctx.Error("Internal Server Error", fasthttp.StatusInternalServerError)
+		return
+	}
+	if _, err := upload.Write(body); err != nil {
+		upload.Abort()
+		log.Printf("ERROR: Failed to write %d bytes to %s sink: %v", size, uploadSink.Name(), err)
+		ctx.Error("Bad Gateway: sink failed", fasthttp.StatusBadGateway)
+		return
 	}
+	res, err := upload.Commit()
+	if err != nil {
+		upload.Abort()
+		log.Printf("ERROR: Failed to commit %d bytes to %s sink: %v", size, uploadSink.Name(), err)
+		ctx.Error("Bad Gateway: sink failed", fasthttp.StatusBadGateway)
+		return
+	}
+
+	// size 是实际读取到内存中的字节数，chunked 上传时 Content-Length 为 -1；
+	// 这里没有和 Content-Length 核对，客户端中途断开时会把截断的请求体当成完整的
 	ctx.Response.Header.SetContentType("application/json")
 	ctx.SetStatusCode(fasthttp.StatusOK)
-	fmt.Fprintf(ctx, `{"status":"exit"}`)
-	go func() {
-		time.Sleep(1 * time.Second)
-		os.Exit(0)
-	}()
+	fmt.Fprintf(ctx, `{"status":"success","size":%d,"content_length":%d,"sha256":"%s","sink":"%s","mode":"bad"}`,
+		size, ctx.Request.Header.ContentLength(), res.SHA256, uploadSink.Name())
 }
 
 func main() {
 	flag.Parse()
 
-	// 启动 pprof 服务器
-	go func() {
-		log.Printf("Starting pprof server on http://localhost%s", *pprofAddr)
-		log.Printf("Heap profile: http://localhost%s/debug/pprof/heap", *pprofAddr)
-		log.Printf("Allocs profile: http://localhost%s/debug/pprof/allocs", *pprofAddr)
-		if err := http.ListenAndServe(*pprofAddr, nil); err != nil {
-			log.Fatalf("pprof server failed: %v", err)
-		}
-	}()
-
-	// 配置请求处理器
-	requestHandler := func(ctx *fasthttp.RequestCtx) {
-		path := string(ctx.Path())
-
-		switch path {
-		case "/upload":
-			badHandler(ctx)
-		case "/gc":
-			gcHandler(ctx)
-		case "/exit":
-			exitHandler(ctx)
-		default:
-			if ctx.RequestBodyStream() != nil {
-				io.Copy(io.Discard, ctx.RequestBodyStream())
-			}
-			ctx.Error("Not Found", fasthttp.StatusNotFound)
+	srv, err := serverOpts.Start()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	uploadSink, err = sinkOpts.New()
+	if err != nil {
+		log.Fatalf("invalid sink: %v", err)
+	}
+	log.Printf("Upload sink: %s (whole body buffered in memory)", uploadSink.Name())
+
+	retainStore, err = retainOpts.New()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if retainStore != nil {
+		retain.Register(retainStore, metrics.Default)
+		log.Printf("Retaining request bodies: mode %s", retainOpts.Mode)
+	}
+
+	if *pooled {
+		bodyPool, err = poolOpts.New()
+		if err != nil {
+			log.Fatalf("%v", err)
 		}
+		bodyPool.Register(metrics.Default, "upload_body_pool")
+		log.Printf("Body buffers: instrumented pool (max cap: %q, max idle: %d)", poolOpts.MaxCap, poolOpts.MaxIdle)
 	}
 
+	if bodyPool != nil {
+		srv.Admin.Handle("/debug/bufpool", bodyPool)
+		log.Printf("Body pool: http://%s/debug/bufpool", srv.Admin.Addr())
+	}
+	if retainStore != nil {
+		srv.Admin.Handle("/debug/retain", retain.Handler(retainStore))
+		srv.Admin.OnShutdown(func(ctx context.Context) error {
+			retainStore.Close()
+			return nil
+		})
+		log.Printf("Retained bodies: http://%s/debug/retain", srv.Admin.Addr())
+	}
+
+	// 超过准入限制的上传在读取请求体之前就被拒绝
+	upload := srv.Limiter.FastHTTP(badHandler, maxBodySize)
+
 	// 创建 fasthttp 服务器
 	server := &fasthttp.Server{
-		Handler: requestHandler,
-		Name:    "FastHTTP-Memory-Test",
+		Handler: memserver.FastHTTPRouter(httpMetrics, map[string]fasthttp.RequestHandler{
+			"/upload": upload,
+			"/gc":     srv.FastHTTPGC,
+			"/exit":   srv.FastHTTPExit,
+		}),
+		Name: "FastHTTP-Memory-Test",
 		// 配置合理的限制
-		MaxRequestBodySize: 100 * 1024 * 1024, // 100MB
+		MaxRequestBodySize: maxBodySize,
 		ReadTimeout:        30 * time.Second,
 		WriteTimeout:       30 * time.Second,
 		StreamRequestBody:  true,
+		// 统计当前打开的连接数
+		ConnState: memserver.FastHTTPConnState(httpMetrics),
 	}
 
 	log.Printf("Starting fasthttp server on http://localhost%s", *addr)
@@ -107,7 +168,5 @@ func main() {
 	log.Printf("Exit endpoint: POST http://localhost%s/exit", *addr)
 	log.Printf("GC endpoint: POST http://localhost%s/gc", *addr)
 
-	if err := server.ListenAndServe(*addr); err != nil {
-		log.Fatalf("Error in ListenAndServe: %v", err)
-	}
+	srv.Serve(func() error { return server.ListenAndServe(*addr) }, admin.StopFunc(server.Shutdown))
 }
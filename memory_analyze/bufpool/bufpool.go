@@ -0,0 +1,208 @@
+// Package bufpool 是带统计的请求体缓冲区池，用来复现 fasthttp requestBodyPool 的滞留问题：
+// 一次 16MB 的上传会把缓冲区撑到 16MB 以上，放回池中后容量不会缩小，
+// 之后即使只有小请求甚至没有流量，这些大缓冲区也一直占着内存。
+//
+// fasthttp 内部的池基于 sync.Pool，只有连续两次 GC 之后才会丢弃空闲缓冲区，
+// 而没有流量的 server 几乎不分配内存、也就很少触发 GC。这里用一个有上限的空闲列表
+// 代替 sync.Pool，让滞留变得确定、可以观察，并可以通过 MaxCap 丢弃超过容量上限的缓冲区（修复）。
+package bufpool
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/metrics"
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/units"
+	"github.com/valyala/bytebufferpool"
+)
+
+// Buckets 容量直方图的桶上界（字节）
+var Buckets = []int64{4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20}
+
+// Options 池配置
+type Options struct {
+	// MaxCap 放回池中的缓冲区容量上限，例如 1MiB；超过的缓冲区直接丢弃交给 GC。空或 0 表示不限制
+	MaxCap string
+	// MaxIdle 最多保留的空闲缓冲区数量
+	MaxIdle int
+}
+
+// Flags 在 fs 上注册池相关的 flag
+func Flags(fs *flag.FlagSet, defaults Options) *Options {
+	opts := defaults
+	if opts.MaxIdle == 0 {
+		opts.MaxIdle = 64
+	}
+	fs.StringVar(&opts.MaxCap, "pool-max-cap", opts.MaxCap, "drop pooled body buffers whose capacity exceeds this size, e.g. 1MiB (0 keeps every buffer)")
+	fs.IntVar(&opts.MaxIdle, "pool-max-idle", opts.MaxIdle, "max number of idle body buffers kept in the pool")
+	return &opts
+}
+
+// New 按配置创建池
+func (o Options) New() (*Pool, error) {
+	var maxCap int64
+	if o.MaxCap != "" && o.MaxCap != "0" {
+		n, err := units.ParseSize(o.MaxCap)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pool max cap: %w", err)
+		}
+		maxCap = n
+	}
+	if o.MaxIdle <= 0 {
+		return nil, fmt.Errorf("pool max idle must be positive, got %d", o.MaxIdle)
+	}
+	return &Pool{maxCap: maxCap, maxIdle: o.MaxIdle}, nil
+}
+
+// Pool 后进先出的缓冲区池，记录空闲缓冲区的容量分布
+type Pool struct {
+	maxCap  int64
+	maxIdle int
+
+	mu   sync.Mutex
+	idle []*bytebufferpool.ByteBuffer
+	// idleBytes 空闲缓冲区的容量之和
+	idleBytes int64
+
+	gets, hits, puts int64
+	// droppedCap 因超过 MaxCap 被丢弃的数量，droppedFull 因池满被丢弃的数量
+	droppedCap, droppedFull int64
+}
+
+// Get 取出一个空闲缓冲区，池为空时新建
+func (p *Pool) Get() *bytebufferpool.ByteBuffer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.gets++
+	n := len(p.idle)
+	if n == 0 {
+		return &bytebufferpool.ByteBuffer{}
+	}
+	p.hits++
+	b := p.idle[n-1]
+	p.idle[n-1] = nil
+	p.idle = p.idle[:n-1]
+	p.idleBytes -= int64(cap(b.B))
+	return b
+}
+
+// Put 把缓冲区放回池中；Reset 只清空长度，容量保持不变
+func (p *Pool) Put(b *bytebufferpool.ByteBuffer) {
+	b.Reset()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.puts++
+	switch {
+	case p.maxCap > 0 && int64(cap(b.B)) > p.maxCap:
+		p.droppedCap++
+	case len(p.idle) >= p.maxIdle:
+		p.droppedFull++
+	default:
+		p.idle = append(p.idle, b)
+		p.idleBytes += int64(cap(b.B))
+	}
+}
+
+// Bucket 容量直方图的一个桶
+type Bucket struct {
+	// UpperBound 桶上界（字节），-1 表示超过最大上界
+	UpperBound int64 `json:"le"`
+	Count      int   `json:"count"`
+	Bytes      int64 `json:"bytes"`
+}
+
+// Stats 池的统计
+type Stats struct {
+	MaxCap      int64    `json:"max_cap"`
+	MaxIdle     int      `json:"max_idle"`
+	Idle        int      `json:"idle"`
+	IdleBytes   int64    `json:"idle_bytes"`
+	Gets        int64    `json:"gets"`
+	Hits        int64    `json:"hits"`
+	Puts        int64    `json:"puts"`
+	DroppedCap  int64    `json:"dropped_over_cap"`
+	DroppedFull int64    `json:"dropped_full"`
+	Capacities  []Bucket `json:"capacities"`
+	// Largest 最大的几个空闲缓冲区容量
+	Largest []int64 `json:"largest"`
+}
+
+// Stats 返回当前统计和空闲缓冲区的容量直方图
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	caps := make([]int64, len(p.idle))
+	for i, b := range p.idle {
+		caps[i] = int64(cap(b.B))
+	}
+	st := Stats{
+		MaxCap:      p.maxCap,
+		MaxIdle:     p.maxIdle,
+		Idle:        len(p.idle),
+		IdleBytes:   p.idleBytes,
+		Gets:        p.gets,
+		Hits:        p.hits,
+		Puts:        p.puts,
+		DroppedCap:  p.droppedCap,
+		DroppedFull: p.droppedFull,
+	}
+	p.mu.Unlock()
+
+	st.Capacities = make([]Bucket, len(Buckets)+1)
+	for i, upper := range Buckets {
+		st.Capacities[i].UpperBound = upper
+	}
+	st.Capacities[len(Buckets)].UpperBound = -1
+	for _, c := range caps {
+		i := sort.Search(len(Buckets), func(i int) bool { return c <= Buckets[i] })
+		st.Capacities[i].Count++
+		st.Capacities[i].Bytes += c
+	}
+	sort.Slice(caps, func(i, j int) bool { return caps[i] > caps[j] })
+	st.Largest = caps[:min(len(caps), 5)]
+	return st
+}
+
+// ServeHTTP 以 JSON 返回 Stats，挂在管理端口上
+func (p *Pool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(p.Stats())
+}
+
+// Register 在 r 中注册 <prefix>_idle_buffers、<prefix>_idle_bytes、<prefix>_idle_capacity_bytes 直方图
+// 以及 Get/Put/丢弃计数
+func (p *Pool) Register(r *metrics.Registry, prefix string) {
+	stat := func(fn func(Stats) float64) func() float64 {
+		return func() float64 { return fn(p.Stats()) }
+	}
+	r.NewGaugeFunc(prefix+"_idle_buffers", "Number of idle buffers kept in the pool.",
+		stat(func(s Stats) float64 { return float64(s.Idle) }))
+	r.NewGaugeFunc(prefix+"_idle_bytes", "Total capacity of idle buffers kept in the pool.",
+		stat(func(s Stats) float64 { return float64(s.IdleBytes) }))
+	upper := make([]float64, len(Buckets))
+	for i, b := range Buckets {
+		upper[i] = float64(b)
+	}
+	r.NewHistogramFunc(prefix+"_idle_capacity_bytes", "Capacity distribution of idle buffers kept in the pool.", upper,
+		func() ([]uint64, float64) {
+			st := p.Stats()
+			counts := make([]uint64, len(st.Capacities))
+			for i, b := range st.Capacities {
+				counts[i] = uint64(b.Count)
+			}
+			return counts, float64(st.IdleBytes)
+		})
+	r.NewCounterFunc(prefix+"_gets_total", "Total number of buffers taken from the pool.",
+		stat(func(s Stats) float64 { return float64(s.Gets) }))
+	r.NewCounterFunc(prefix+"_hits_total", "Total number of Get calls served by an idle buffer.",
+		stat(func(s Stats) float64 { return float64(s.Hits) }))
+	r.NewCounterFunc(prefix+"_dropped_over_cap_total", "Total number of buffers dropped because their capacity exceeded the cap.",
+		stat(func(s Stats) float64 { return float64(s.DroppedCap) }))
+	r.NewCounterFunc(prefix+"_dropped_full_total", "Total number of buffers dropped because the pool was full.",
+		stat(func(s Stats) float64 { return float64(s.DroppedFull) }))
+}
@@ -0,0 +1,110 @@
+package bufpool
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/valyala/bytebufferpool"
+)
+
+// buf 返回容量为 n 的缓冲区
+func buf(n int) *bytebufferpool.ByteBuffer {
+	return &bytebufferpool.ByteBuffer{B: make([]byte, 10, n)}
+}
+
+func newPool(t *testing.T, maxCap string, maxIdle int) *Pool {
+	t.Helper()
+	p, err := Options{MaxCap: maxCap, MaxIdle: maxIdle}.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestGetPut(t *testing.T) {
+	p := newPool(t, "", 4)
+
+	b := p.Get()
+	if b == nil || cap(b.B) != 0 {
+		t.Fatalf("Get from an empty pool = %v, want a new buffer", b)
+	}
+	b.B = append(b.B, "hello"...)
+	p.Put(b)
+	if got := p.Get(); got != b || len(got.B) != 0 {
+		t.Errorf("Get = %p (len %d), want the reset buffer %p", got, len(got.B), b)
+	}
+
+	// 后进先出
+	small, large := buf(1024), buf(8192)
+	p.Put(small)
+	p.Put(large)
+	if got := p.Get(); got != large {
+		t.Errorf("Get returned the %d byte buffer, want the most recently put one", cap(got.B))
+	}
+
+	st := p.Stats()
+	if st.Gets != 3 || st.Hits != 2 || st.Puts != 3 {
+		t.Errorf("gets/hits/puts = %d/%d/%d, want 3/2/3", st.Gets, st.Hits, st.Puts)
+	}
+	if st.Idle != 1 || st.IdleBytes != 1024 {
+		t.Errorf("idle = %d (%d bytes), want 1 (1024 bytes)", st.Idle, st.IdleBytes)
+	}
+}
+
+func TestMaxCap(t *testing.T) {
+	p := newPool(t, "1KiB", 4)
+	if st := p.Stats(); st.MaxCap != 1024 {
+		t.Fatalf("MaxCap = %d, want 1024", st.MaxCap)
+	}
+	p.Put(buf(1024))
+	p.Put(buf(1025))
+
+	st := p.Stats()
+	if st.Idle != 1 || st.IdleBytes != 1024 || st.DroppedCap != 1 {
+		t.Errorf("idle %d (%d bytes), dropped over cap %d; want 1 (1024 bytes), 1", st.Idle, st.IdleBytes, st.DroppedCap)
+	}
+}
+
+func TestMaxIdle(t *testing.T) {
+	p := newPool(t, "0", 2)
+	for i := 0; i < 3; i++ {
+		p.Put(buf(4096))
+	}
+	st := p.Stats()
+	if st.Idle != 2 || st.DroppedFull != 1 || st.DroppedCap != 0 {
+		t.Errorf("idle %d, dropped full %d, dropped over cap %d; want 2, 1, 0", st.Idle, st.DroppedFull, st.DroppedCap)
+	}
+}
+
+func TestStatsBuckets(t *testing.T) {
+	p := newPool(t, "", 16)
+	for _, c := range []int{4 << 10, 4<<10 + 1, 1 << 20, 64<<20 + 1, 16, 32 << 20} {
+		p.Put(buf(c))
+	}
+	st := p.Stats()
+
+	want := map[int64]int{4 << 10: 2, 16 << 10: 1, 1 << 20: 1, 64 << 20: 1, -1: 1}
+	if len(st.Capacities) != len(Buckets)+1 {
+		t.Fatalf("got %d buckets, want %d", len(st.Capacities), len(Buckets)+1)
+	}
+	for _, b := range st.Capacities {
+		if b.Count != want[b.UpperBound] {
+			t.Errorf("bucket le=%d count = %d, want %d", b.UpperBound, b.Count, want[b.UpperBound])
+		}
+	}
+	if b := st.Capacities[len(Buckets)]; b.Bytes != 64<<20+1 {
+		t.Errorf("overflow bucket bytes = %d, want %d", b.Bytes, 64<<20+1)
+	}
+	wantLargest := []int64{64<<20 + 1, 32 << 20, 1 << 20, 4<<10 + 1, 4 << 10}
+	if !reflect.DeepEqual(st.Largest, wantLargest) {
+		t.Errorf("Largest = %v, want %v", st.Largest, wantLargest)
+	}
+}
+
+func TestOptionsErrors(t *testing.T) {
+	for _, o := range []Options{{MaxCap: "lots", MaxIdle: 1}, {MaxIdle: 0}} {
+		if _, err := o.New(); err == nil {
+			t.Errorf("New(%+v) should fail", o)
+		}
+	}
+}
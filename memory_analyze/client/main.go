@@ -1,115 +1,104 @@
 package main
 
 import (
-	"bytes"
-	"crypto/rand"
+	"context"
 	"flag"
-	"fmt"
-	"io"
 	"log"
-	mathrand "math/rand"
 	"net/http"
-	"sync"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/units"
+	"github.com/gangcheng1030/ai_production_troubleshooting/memory_analyze/loadgen"
 )
 
 var (
-	serverURL = flag.String("url", "http://localhost:8080/upload", "Server upload URL")
+	serverURL   = flag.String("url", "http://localhost:8080/upload", "Server upload URL")
+	rate        = flag.Float64("rate", 0, "open model: requests per second with Poisson arrivals (0 uses closed model with -concurrency workers)")
+	concurrency = flag.Int("concurrency", 10, "closed model: number of workers; open model: max in-flight requests before new arrivals are dropped")
+	duration    = flag.Duration("duration", 0, "test duration (0 stops after -requests)")
+	requests    = flag.Int("requests", 500, "max number of requests (0 stops after -duration)")
+	think       = flag.Duration("think", 200*time.Millisecond, "closed model: pause between two requests of a worker")
+	sizes       = flag.String("sizes", "uniform:1MiB-16MiB", "body size distribution: fixed:N, uniform:MIN-MAX or lognormal:MEDIAN,SIGMA[,MAX]")
+	mode        = flag.String("mode", loadgen.ModeContentLength, "upload mode: "+strings.Join(loadgen.Modes, ", "))
+	trickleSize = flag.String("trickle-chunk", "64KiB", "trickle mode: bytes sent per write")
+	trickleGap  = flag.Duration("trickle-interval", 10*time.Millisecond, "trickle mode: pause between two writes")
+	abortAt     = flag.Float64("abort-at", 0.5, "abort mode: fraction of the body sent before the connection is dropped")
+	timeout     = flag.Duration("timeout", 30*time.Second, "per-request timeout")
+	seed        = flag.Int64("seed", 0, "random seed for body sizes and arrivals (0 uses current time)")
+	verbose     = flag.Bool("v", false, "log every request")
+	jsonOut     = flag.Bool("json", false, "print the report as JSON")
+	triggerGC   = flag.Bool("gc", true, "trigger server GC via /gc on the upload host after the test")
+	settle      = flag.Duration("settle", 5*time.Second, "wait before triggering GC so the server can finish processing")
 )
 
-// 生成指定大小的随机数据
-func generateRandomData(sizeMB int) []byte {
-	size := sizeMB * 1024 * 1024
-	data := make([]byte, size)
-	if _, err := rand.Read(data); err != nil {
-		log.Fatalf("Failed to generate random data: %v", err)
-	}
-	return data
-}
+func main() {
+	flag.Parse()
 
-// 发送单个上传请求
-func uploadFile(url string, data []byte, id int) error {
-	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	dist, err := loadgen.ParseSizeDist(*sizes)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+		log.Fatalf("invalid -sizes: %v", err)
 	}
-
-	req.Header.Set("Content-Type", "application/octet-stream")
-
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-
-	start := time.Now()
-	resp, err := client.Do(req)
+	chunk, err := units.ParseSize(*trickleSize)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %v", err)
+		log.Fatalf("invalid -trickle-chunk: %v", err)
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+	gcURL, err := loadgen.SiblingURL(*serverURL, "/gc")
 	if err != nil {
-		return fmt.Errorf("failed to read response: %v", err)
+		log.Fatalf("invalid -url: %v", err)
 	}
 
-	duration := time.Since(start)
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
-	}
-
-	log.Printf("Request #%d completed in %v, response: %s", id, duration, string(body))
-	return nil
-}
-
-func main() {
-	flag.Parse()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	log.Printf("Starting upload test:")
 	log.Printf("  Server URL: %s", *serverURL)
-
-	// 使用 worker pool 模式发送请求
-	var wg sync.WaitGroup
-	requestChan := make(chan int, 5000)
-
-	// 启动 worker goroutines
-	for i := 0; i < 10; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			for requestID := range requestChan {
-				data := generateRandomData(mathrand.Intn(16) + 1)
-				if err := uploadFile(*serverURL, data, requestID); err != nil {
-					log.Printf("Worker %d: Request #%d failed: %v", workerID, requestID, err)
-				}
-				time.Sleep(200 * time.Millisecond)
-			}
-		}(i)
+	log.Printf("  Body sizes: %s", dist)
+	log.Printf("  Upload mode: %s", *mode)
+
+	report, err := loadgen.Run(ctx, loadgen.Config{
+		URL:             *serverURL,
+		Rate:            *rate,
+		Concurrency:     *concurrency,
+		Duration:        *duration,
+		Requests:        *requests,
+		Think:           *think,
+		Sizes:           dist,
+		Mode:            *mode,
+		TrickleChunk:    chunk,
+		TrickleInterval: *trickleGap,
+		AbortAt:         *abortAt,
+		Timeout:         *timeout,
+		Seed:            *seed,
+		Verbose:         *verbose,
+	})
+	if err != nil {
+		log.Fatalf("Load test failed: %v", err)
 	}
 
-	// 发送请求到 channel
-	for i := 1; i <= 500; i++ {
-		requestChan <- i
+	log.Printf("=== Test Completed ===")
+	if *jsonOut {
+		report.WriteJSON(os.Stdout)
+	} else {
+		report.WriteText(os.Stdout)
 	}
-	close(requestChan)
-
-	// 等待所有请求完成
-	wg.Wait()
-
-	log.Printf("\n=== Test Completed ===")
 
+	if !*triggerGC || ctx.Err() != nil {
+		return
+	}
 	// 等待一下让服务器处理完成
-	log.Printf("\nWaiting 5 seconds for server to process...")
-	time.Sleep(5 * time.Second)
+	log.Printf("Waiting %v for server to process...", *settle)
+	time.Sleep(*settle)
 
-	// 触发 GC
-	log.Printf("\nTriggering server GC...")
-	gcURL := fmt.Sprintf("http://%s/gc", (*serverURL)[7:len(*serverURL)-7])
-	if resp, err := http.Post(gcURL, "application/json", nil); err == nil {
-		resp.Body.Close()
-		log.Printf("GC triggered successfully")
+	log.Printf("Triggering server GC via %s", gcURL)
+	resp, err := http.Post(gcURL, "application/json", nil)
+	if err != nil {
+		log.Printf("Failed to trigger GC: %v", err)
+		return
 	}
-
-	// 等待 GC 完成
-	time.Sleep(2 * time.Second)
+	resp.Body.Close()
+	log.Printf("GC triggered successfully")
 }
@@ -2,9 +2,16 @@ module github.com/gangcheng1030/ai_production_troubleshooting/memory_analyze
 
 go 1.23.9
 
+require (
+	github.com/gangcheng1030/ai_production_troubleshooting/diagnostics v0.0.0
+	github.com/valyala/bytebufferpool v1.0.0
+	github.com/valyala/fasthttp v1.38.0
+)
+
 require (
 	github.com/andybalholm/brotli v1.0.4 // indirect
+	github.com/google/pprof v0.0.0-20241210010833-40e02aabc2ad // indirect
 	github.com/klauspost/compress v1.15.0 // indirect
-	github.com/valyala/bytebufferpool v1.0.0 // indirect
-	github.com/valyala/fasthttp v1.38.0 // indirect
 )
+
+replace github.com/gangcheng1030/ai_production_troubleshooting/diagnostics => ../diagnostics
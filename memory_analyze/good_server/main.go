@@ -1,116 +1,127 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
-	_ "net/http/pprof"
-	"os"
-	"runtime"
 	"time"
 
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/admin"
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/metrics"
+	"github.com/gangcheng1030/ai_production_troubleshooting/memory_analyze/memserver"
+	"github.com/gangcheng1030/ai_production_troubleshooting/memory_analyze/sink"
 	"github.com/valyala/fasthttp"
 )
 
+// maxBodySize 请求体大小上限；chunked 上传大小未知时，准入控制按这个大小预留额度
+const maxBodySize = 100 * 1024 * 1024 // 100MB
+
+var (
+	addr = flag.String("addr", ":8080", "HTTP server address")
+	// 管理端口、watchdog、内存上限和准入控制
+	serverOpts = memserver.Flags(flag.CommandLine, "GoodServer")
+	sinkOpts   = sink.Flags(flag.CommandLine, sink.Options{})
+)
+
 var (
-	addr      = flag.String("addr", ":8080", "HTTP server address")
-	pprofAddr = flag.String("pprof", ":6060", "pprof HTTP server address")
+	uploadSink sink.Sink
+	copier     *sink.Copier
+	// 管理端口 /metrics 中的 http_server_* 指标
+	httpMetrics = metrics.NewHTTPMetrics(metrics.Default, "http_server")
 )
 
 // 好的实现：正确处理 Request.Body
+// 以固定大小的缓冲区把请求体流式写入 sink，每个请求最多占用 -budget 字节
 func goodHandler(ctx *fasthttp.RequestCtx) {
-	// 获取 body 大小
-	size := ctx.Request.Header.ContentLength()
+	// 请求头中声明的大小；chunked 上传时为 -1，不能作为实际大小
+	contentLength := ctx.Request.Header.ContentLength()
 
-	// 重要：使用 StreamRequestBody 时，必须流式读取并丢弃请求体
-	// 直接使用 RequestBodyStream() 而不是检查 IsBodyStream()
-	// 因为 IsBodyStream() 可能返回 false，但仍然需要从流中读取数据
-	n, err := io.Copy(io.Discard, ctx.RequestBodyStream())
+	upload, err := uploadSink.Open(ctx, int64(max(contentLength, -1)))
 	if err != nil {
-		log.Printf("ERROR: Failed to read body stream: %v", err)
+		log.Printf("ERROR: Failed to open %s sink: %v", uploadSink.Name(), err)
 		ctx.Error("Internal Server Error", fasthttp.StatusInternalServerError)
 		return
 	}
-	log.Printf("DEBUG: Discarded %d bytes from stream (Content-Length: %d)", n, size)
-
-	ctx.Response.Header.SetContentType("application/json")
-	ctx.SetStatusCode(fasthttp.StatusOK)
-	fmt.Fprintf(ctx, `{"status":"success","size":%d,"mode":"good"}`, size)
-}
 
-// 强制 GC 端点（仅用于测试）
-func gcHandler(ctx *fasthttp.RequestCtx) {
-	// 使用 StreamRequestBody 时必须读取请求体（即使可能为空）
-	if ctx.RequestBodyStream() != nil {
-		io.Copy(io.Discard, ctx.RequestBodyStream())
+	// 重要：使用 StreamRequestBody 时，必须流式读取请求体
+	// 直接使用 RequestBodyStream() 而不是检查 IsBodyStream()
+	// 因为 IsBodyStream() 可能返回 false，但仍然需要从流中读取数据
+	n, err := copier.Copy(upload, ctx.RequestBodyStream())
+	httpMetrics.AddReceived("/upload", n)
+	if err == nil && contentLength >= 0 && n != int64(contentLength) {
+		// 客户端中途断开时，fasthttp 的 body stream 可能直接返回 EOF 而不是错误，
+		// 只能通过对比 Content-Length 发现请求体被截断
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		upload.Abort()
+		var writeErr *sink.WriteError
+		if errors.As(err, &writeErr) {
+			log.Printf("ERROR: Failed to write to %s sink after %d bytes: %v", uploadSink.Name(), n, writeErr.Err)
+			ctx.Error("Bad Gateway: sink failed", fasthttp.StatusBadGateway)
+			return
+		}
+		// 客户端中途断开、请求体不完整
+		log.Printf("ERROR: Failed to stream body after %d bytes (Content-Length: %d): %v", n, contentLength, err)
+		ctx.Error("Bad Request: incomplete body", fasthttp.StatusBadRequest)
+		return
 	}
 
-	runtime.GC()
-	ctx.Response.Header.SetContentType("application/json")
-	ctx.SetStatusCode(fasthttp.StatusOK)
-	fmt.Fprintf(ctx, `{"status":"gc triggered"}`)
-}
-
-// 退出
-func exitHandler(ctx *fasthttp.RequestCtx) {
-	// 使用 StreamRequestBody 时必须读取请求体（即使可能为空）
-	if ctx.RequestBodyStream() != nil {
-		io.Copy(io.Discard, ctx.RequestBodyStream())
+	res, err := upload.Commit()
+	if err != nil {
+		upload.Abort()
+		log.Printf("ERROR: Failed to commit %d bytes to %s sink: %v", n, uploadSink.Name(), err)
+		ctx.Error("Bad Gateway: sink failed", fasthttp.StatusBadGateway)
+		return
 	}
+	log.Printf("DEBUG: Streamed %d bytes to %s sink (Content-Length: %d, sha256: %.12s)", n, uploadSink.Name(), contentLength, res.SHA256)
 
+	// size 是实际读取的字节数，客户端用它和 sha256 核对上传是否完整
 	ctx.Response.Header.SetContentType("application/json")
 	ctx.SetStatusCode(fasthttp.StatusOK)
-	fmt.Fprintf(ctx, `{"status":"exit"}`)
-	go func() {
-		time.Sleep(1 * time.Second)
-		os.Exit(0)
-	}()
+	fmt.Fprintf(ctx, `{"status":"success","size":%d,"content_length":%d,"sha256":"%s","sink":"%s","mode":"good"}`,
+		n, contentLength, res.SHA256, uploadSink.Name())
 }
 
 func main() {
 	flag.Parse()
 
-	// 启动 pprof 服务器
-	go func() {
-		log.Printf("Starting pprof server on http://localhost%s", *pprofAddr)
-		log.Printf("Heap profile: http://localhost%s/debug/pprof/heap", *pprofAddr)
-		log.Printf("Allocs profile: http://localhost%s/debug/pprof/allocs", *pprofAddr)
-		if err := http.ListenAndServe(*pprofAddr, nil); err != nil {
-			log.Fatalf("pprof server failed: %v", err)
-		}
-	}()
-
-	// 配置请求处理器
-	requestHandler := func(ctx *fasthttp.RequestCtx) {
-		path := string(ctx.Path())
-
-		switch path {
-		case "/upload":
-			goodHandler(ctx)
-		case "/gc":
-			gcHandler(ctx)
-		case "/exit":
-			exitHandler(ctx)
-		default:
-			// 404 处理器也必须读取请求体
-			if ctx.RequestBodyStream() != nil {
-				io.Copy(io.Discard, ctx.RequestBodyStream())
-			}
-			ctx.Error("Not Found", fasthttp.StatusNotFound)
-		}
+	srv, err := serverOpts.Start()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	uploadSink, err = sinkOpts.New()
+	if err != nil {
+		log.Fatalf("invalid sink: %v", err)
 	}
+	budget, err := sinkOpts.BudgetBytes()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	copier = sink.NewCopier(budget)
+	log.Printf("Upload sink: %s, per-request buffer: %d bytes", uploadSink.Name(), budget)
+
+	// 超过准入限制的上传在读取请求体之前就被拒绝
+	upload := srv.Limiter.FastHTTP(goodHandler, maxBodySize)
 
 	// 创建 fasthttp 服务器
 	server := &fasthttp.Server{
-		Handler: requestHandler,
-		Name:    "FastHTTP-Memory-Test",
+		Handler: memserver.FastHTTPRouter(httpMetrics, map[string]fasthttp.RequestHandler{
+			"/upload": upload,
+			"/gc":     srv.FastHTTPGC,
+			"/exit":   srv.FastHTTPExit,
+		}),
+		Name: "FastHTTP-Memory-Test",
 		// 配置合理的限制
-		MaxRequestBodySize: 100 * 1024 * 1024, // 100MB
+		MaxRequestBodySize: maxBodySize,
 		ReadTimeout:        30 * time.Second,
 		WriteTimeout:       30 * time.Second,
 		StreamRequestBody:  true,
+		// 统计当前打开的连接数
+		ConnState: memserver.FastHTTPConnState(httpMetrics),
 	}
 
 	log.Printf("Starting fasthttp server on http://localhost%s", *addr)
@@ -118,7 +129,5 @@ func main() {
 	log.Printf("GC endpoint: POST http://localhost%s/gc", *addr)
 	log.Printf("Exit endpoint: POST http://localhost%s/exit", *addr)
 
-	if err := server.ListenAndServe(*addr); err != nil {
-		log.Fatalf("Error in ListenAndServe: %v", err)
-	}
+	srv.Serve(func() error { return server.ListenAndServe(*addr) }, admin.StopFunc(server.Shutdown))
 }
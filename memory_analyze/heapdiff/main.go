@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"regexp"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/profdiff"
+)
+
+var (
+	goodProfile = flag.String("good", "good_heap.prof", "heap profile of good_server (baseline)")
+	badProfile  = flag.String("bad", "bad_heap.prof", "heap profile of bad_server")
+	goodLabel   = flag.String("good-label", "good", "label of the baseline profile in the report")
+	badLabel    = flag.String("bad-label", "bad", "label of the compared profile in the report")
+	format      = flag.String("format", "text", "output format: text, json or markdown")
+	sampleType  = flag.String("sample-type", "inuse_space", "sample type used to rank allocation sites: alloc_objects, alloc_space, inuse_objects or inuse_space")
+	top         = flag.Int("top", 10, "max number of allocation sites to show (0 for all)")
+	flagShare   = flag.Float64("flag-share", 20, "flag allocation sites that account for more than this percentage of the growth")
+	handler     = flag.String("handler", `Handler$`, "trim call paths at the first function matching this regexp (empty keeps the full stack)")
+)
+
+func main() {
+	flag.Parse()
+
+	var handlerRE *regexp.Regexp
+	if *handler != "" {
+		re, err := regexp.Compile(*handler)
+		if err != nil {
+			log.Fatalf("invalid -handler: %v", err)
+		}
+		handlerRE = re
+	}
+
+	// good 作为基线，增长量表示 bad_server 多出来的内存
+	report, err := profdiff.LoadHeapDiff(*goodProfile, *badProfile, *goodLabel, *badLabel, profdiff.HeapOptions{
+		SampleType:     *sampleType,
+		Top:            *top,
+		FlagShare:      *flagShare / 100,
+		HandlerPattern: handlerRE,
+	})
+	if err != nil {
+		log.Fatalf("failed to compare heap profiles: %v", err)
+	}
+	if err := report.Write(os.Stdout, *format); err != nil {
+		log.Fatalf("failed to write report: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// 上传模式
+const (
+	// ModeContentLength 普通上传，带 Content-Length
+	ModeContentLength = "content-length"
+	// ModeChunked 使用 Transfer-Encoding: chunked，server 事先不知道请求体大小
+	ModeChunked = "chunked"
+	// ModeTrickle chunked 上传，每隔 TrickleInterval 只发送 TrickleChunk 字节，模拟慢客户端
+	ModeTrickle = "trickle"
+	// ModeAbort 声明完整的 Content-Length，但发送到 AbortAt 比例时断开连接
+	ModeAbort = "abort"
+)
+
+// Modes 支持的上传模式
+var Modes = []string{ModeContentLength, ModeChunked, ModeTrickle, ModeAbort}
+
+// errAbort 由 abort 模式的请求体返回，使 Transport 在发送中途关闭连接
+var errAbort = errors.New("upload aborted by client")
+
+func validateMode(cfg Config) error {
+	switch cfg.Mode {
+	case "", ModeContentLength, ModeChunked:
+	case ModeTrickle:
+		if cfg.TrickleChunk <= 0 || cfg.TrickleInterval <= 0 {
+			return errors.New("trickle mode requires positive chunk size and interval")
+		}
+	case ModeAbort:
+		if cfg.AbortAt < 0 || cfg.AbortAt >= 1 {
+			return fmt.Errorf("abort fraction must be in [0, 1), got %g", cfg.AbortAt)
+		}
+	default:
+		return fmt.Errorf("unknown mode %q, expected one of %v", cfg.Mode, Modes)
+	}
+	return nil
+}
+
+// newBody 按模式包装请求体，返回 reader 和请求的 ContentLength（-1 表示 chunked）
+func newBody(ctx context.Context, cfg Config, data []byte) (io.Reader, int64) {
+	switch cfg.Mode {
+	case ModeChunked:
+		// 隐藏 *bytes.Reader 的类型，net/http 就无法推断长度，只能使用 chunked 编码
+		return &sliceReader{data: data}, -1
+	case ModeTrickle:
+		return &trickleReader{ctx: ctx, data: data, chunk: int(cfg.TrickleChunk), interval: cfg.TrickleInterval}, -1
+	case ModeAbort:
+		return &sliceReader{data: data, limit: int(float64(len(data)) * cfg.AbortAt), abort: true}, int64(len(data))
+	default:
+		return &sliceReader{data: data, limit: len(data)}, int64(len(data))
+	}
+}
+
+// sliceReader 按顺序读出 data；abort 为 true 时读到 limit 后返回 errAbort
+type sliceReader struct {
+	data  []byte
+	off   int
+	limit int
+	abort bool
+}
+
+func (r *sliceReader) Read(p []byte) (int, error) {
+	end := len(r.data)
+	if r.abort {
+		end = r.limit
+	}
+	if r.off >= end {
+		if r.abort {
+			return 0, errAbort
+		}
+		return 0, io.EOF
+	}
+	n := copy(p, r.data[r.off:end])
+	r.off += n
+	return n, nil
+}
+
+// trickleReader 每次 Read 最多返回 chunk 字节，并在两次 Read 之间等待 interval
+type trickleReader struct {
+	ctx      context.Context
+	data     []byte
+	off      int
+	chunk    int
+	interval time.Duration
+	started  bool
+}
+
+func (r *trickleReader) Read(p []byte) (int, error) {
+	if r.off >= len(r.data) {
+		return 0, io.EOF
+	}
+	if r.started {
+		select {
+		case <-time.After(r.interval):
+		case <-r.ctx.Done():
+			return 0, r.ctx.Err()
+		}
+	}
+	r.started = true
+	n := copy(p[:min(len(p), r.chunk)], r.data[r.off:])
+	r.off += n
+	return n, nil
+}
@@ -0,0 +1,306 @@
+// Package loadgen 是 memory_analyze 的上传压测工具：支持按到达率（open model）
+// 或按并发数（closed model）发送请求，请求体大小服从可配置的分布，
+// 结束后汇总延迟分位数、吞吐以及按状态码分类的错误。
+package loadgen
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	mathrand "math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config 压测配置
+type Config struct {
+	// URL 上传地址，例如 http://localhost:8080/upload
+	URL string
+	// Rate 每秒到达的请求数（泊松到达）；0 表示 closed model，由 Concurrency 个 worker 循环发送
+	Rate float64
+	// Concurrency closed model 下的 worker 数；open model 下的最大在途请求数，超过时请求被丢弃并计数
+	Concurrency int
+	// Duration 压测时长，0 表示只受 Requests 限制
+	Duration time.Duration
+	// Requests 最多发送的请求数，0 表示只受 Duration 限制
+	Requests int
+	// Think closed model 下每个 worker 两次请求之间的等待时间
+	Think time.Duration
+	// Sizes 请求体大小分布
+	Sizes SizeDist
+	// Mode 上传模式：content-length、chunked、trickle、abort
+	Mode string
+	// TrickleChunk trickle 模式下每次发送的字节数
+	TrickleChunk int64
+	// TrickleInterval trickle 模式下两次发送之间的间隔
+	TrickleInterval time.Duration
+	// AbortAt abort 模式下发送到请求体的哪个比例时断开，例如 0.5
+	AbortAt float64
+	// Timeout 单个请求的超时时间
+	Timeout time.Duration
+	// Seed 随机数种子，0 表示使用当前时间
+	Seed int64
+	// Verbose 打印每个请求的结果
+	Verbose bool
+}
+
+// Result 单个请求的结果
+type Result struct {
+	Size int64
+	// Received server 在响应中报告的实际读取字节数，-1 表示响应中没有这个字段
+	Received int64
+	Status   int
+	Latency  time.Duration
+	Err      error
+	Body     string
+}
+
+// errSizeMismatch server 报告读取的字节数与发送的不一致
+var errSizeMismatch = errors.New("size mismatch")
+
+// errChecksumMismatch server 报告的 sha256 与发送的内容不一致
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// Run 按配置发送请求直到达到时长或请求数，返回汇总报告
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	if cfg.Sizes == nil {
+		return nil, errors.New("no size distribution")
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.Duration <= 0 && cfg.Requests <= 0 {
+		return nil, errors.New("either duration or requests must be set")
+	}
+	if _, err := url.Parse(cfg.URL); err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if err := validateMode(cfg); err != nil {
+		return nil, err
+	}
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	// 所有请求共享同一块随机数据，按大小截取，避免每个请求都生成一遍
+	payload := make([]byte, cfg.Sizes.Max())
+	if _, err := rand.Read(payload); err != nil {
+		return nil, fmt.Errorf("generate payload: %w", err)
+	}
+
+	// Duration 到期后只停止派发新请求，在途请求用 ctx 继续完成，不计为错误
+	dispatch := ctx
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		dispatch, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+
+	g := &generator{
+		cfg:     cfg,
+		payload: payload,
+		client:  NewClient(cfg.Concurrency, cfg.Timeout),
+		rng:     mathrand.New(mathrand.NewSource(seed)),
+	}
+	defer g.client.CloseIdleConnections()
+
+	start := time.Now()
+	if cfg.Rate > 0 {
+		g.runOpen(dispatch, ctx)
+	} else {
+		g.runClosed(dispatch, ctx)
+	}
+	return newReport(cfg, g.results, g.dropped.Load(), time.Since(start)), nil
+}
+
+// NewClient 创建共享连接池的 http.Client，连接数与并发数匹配
+func NewClient(concurrency int, timeout time.Duration) *http.Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:        concurrency,
+		MaxIdleConnsPerHost: concurrency,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
+// SiblingURL 返回与 rawURL 同一 scheme、host 的另一个路径，例如由上传地址得到 /gc 地址
+func SiblingURL(rawURL, path string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("url %q has no scheme or host", rawURL)
+	}
+	return (&url.URL{Scheme: u.Scheme, User: u.User, Host: u.Host, Path: path}).String(), nil
+}
+
+type generator struct {
+	cfg     Config
+	payload []byte
+	client  *http.Client
+
+	mu      sync.Mutex
+	rng     *mathrand.Rand
+	results []Result
+	sent    int
+	dropped atomic.Int64
+}
+
+// next 领取下一个请求的编号和大小，达到 Requests 上限时返回 false
+func (g *generator) next() (int, int64, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.cfg.Requests > 0 && g.sent >= g.cfg.Requests {
+		return 0, 0, false
+	}
+	g.sent++
+	return g.sent, g.cfg.Sizes.Next(g.rng), true
+}
+
+// interarrival 泊松到达的下一次间隔
+func (g *generator) interarrival() time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return time.Duration(g.rng.ExpFloat64() / g.cfg.Rate * float64(time.Second))
+}
+
+// runClosed Concurrency 个 worker 各自循环发送，前一个请求完成后才发下一个
+func (g *generator) runClosed(dispatch, ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < g.cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dispatch.Err() == nil {
+				id, size, ok := g.next()
+				if !ok {
+					return
+				}
+				g.do(ctx, id, size)
+				if g.cfg.Think > 0 {
+					select {
+					case <-time.After(g.cfg.Think):
+					case <-dispatch.Done():
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// runOpen 按到达率发送请求，不等待前面的请求完成；在途请求达到 Concurrency 时丢弃新请求，
+// 这样慢的 server 不会反过来降低压力
+func (g *generator) runOpen(dispatch, ctx context.Context) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, g.cfg.Concurrency)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-dispatch.Done():
+			wg.Wait()
+			return
+		case <-timer.C:
+		}
+		timer.Reset(g.interarrival())
+
+		id, size, ok := g.next()
+		if !ok {
+			wg.Wait()
+			return
+		}
+		select {
+		case sem <- struct{}{}:
+		default:
+			g.dropped.Add(1)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			g.do(ctx, id, size)
+		}()
+	}
+}
+
+func (g *generator) do(ctx context.Context, id int, size int64) {
+	res := g.upload(ctx, size)
+	if g.cfg.Verbose {
+		if res.Err != nil {
+			log.Printf("Request #%d (%s) failed after %v: %v", id, formatSize(size), res.Latency, res.Err)
+		} else {
+			log.Printf("Request #%d (%s) completed in %v, status %d, response: %s", id, formatSize(size), res.Latency, res.Status, res.Body)
+		}
+	}
+	g.mu.Lock()
+	g.results = append(g.results, res)
+	g.mu.Unlock()
+}
+
+func (g *generator) upload(ctx context.Context, size int64) Result {
+	res := Result{Size: size, Received: -1}
+	body, length := newBody(ctx, g.cfg, g.payload[:size])
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.cfg.URL, body)
+	if err != nil {
+		res.Err = fmt.Errorf("failed to create request: %w", err)
+		return res
+	}
+	req.ContentLength = length
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	start := time.Now()
+	resp, err := g.client.Do(req)
+	if err != nil {
+		res.Latency = time.Since(start)
+		res.Err = err
+		return res
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	res.Latency = time.Since(start)
+	res.Status = resp.StatusCode
+	res.Body = string(respBody)
+	if err != nil {
+		res.Err = fmt.Errorf("failed to read response: %w", err)
+		return res
+	}
+
+	// 核对 server 实际读取的字节数，chunked 上传时 Content-Length 是 -1，只有这个数字可信
+	var reply struct {
+		Size   *int64 `json:"size"`
+		SHA256 string `json:"sha256"`
+	}
+	if json.Unmarshal(respBody, &reply) == nil && reply.Size != nil {
+		res.Received = *reply.Size
+	}
+	if resp.StatusCode/100 != 2 || g.cfg.Mode == ModeAbort {
+		return res
+	}
+	if res.Received >= 0 && res.Received != size {
+		res.Err = fmt.Errorf("%w: sent %d bytes, server read %d", errSizeMismatch, size, res.Received)
+	} else if reply.SHA256 != "" {
+		if sum := sha256.Sum256(g.payload[:size]); hex.EncodeToString(sum[:]) != reply.SHA256 {
+			res.Err = fmt.Errorf("%w: server sha256 %s", errChecksumMismatch, reply.SHA256)
+		}
+	}
+	return res
+}
@@ -0,0 +1,138 @@
+package loadgen
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSliceReaderAbort(t *testing.T) {
+	data := make([]byte, 1000)
+	body, length := newBody(context.Background(), Config{Mode: ModeAbort, AbortAt: 0.25}, data)
+	if length != 1000 {
+		t.Errorf("abort mode ContentLength = %d, want the full 1000 bytes", length)
+	}
+	got, err := io.ReadAll(body)
+	if !errors.Is(err, errAbort) || len(got) != 250 {
+		t.Errorf("read %d bytes, err %v; want 250 bytes then errAbort", len(got), err)
+	}
+
+	body, length = newBody(context.Background(), Config{}, data)
+	if got, err := io.ReadAll(body); err != nil || len(got) != 1000 || length != 1000 {
+		t.Errorf("content-length mode: read %d bytes, err %v, ContentLength %d", len(got), err, length)
+	}
+}
+
+// request server 收到的上传请求
+type request struct {
+	contentLength    int64
+	transferEncoding []string
+	body             []byte
+}
+
+// uploadServer 读完请求体后按 reply 回复；reply 可以篡改 size 和 sha256
+func uploadServer(t *testing.T, reply func(body []byte) any) (*httptest.Server, <-chan request) {
+	t.Helper()
+	reqs := make(chan request, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reqs <- request{r.ContentLength, r.TransferEncoding, body}
+		json.NewEncoder(w).Encode(reply(body))
+	}))
+	t.Cleanup(ts.Close)
+	return ts, reqs
+}
+
+type reply struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func honest(body []byte) any {
+	sum := sha256.Sum256(body)
+	return reply{int64(len(body)), hex.EncodeToString(sum[:])}
+}
+
+func newGenerator(t *testing.T, cfg Config) *generator {
+	t.Helper()
+	payload := make([]byte, 4096)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	g := &generator{cfg: cfg, payload: payload, client: NewClient(1, 5*time.Second)}
+	t.Cleanup(g.client.CloseIdleConnections)
+	return g
+}
+
+func TestUploadModes(t *testing.T) {
+	for _, tt := range []struct {
+		mode          string
+		contentLength int64
+		chunked       bool
+	}{
+		{ModeContentLength, 4096, false},
+		{ModeChunked, -1, true},
+		{ModeTrickle, -1, true},
+	} {
+		ts, reqs := uploadServer(t, honest)
+		g := newGenerator(t, Config{URL: ts.URL, Mode: tt.mode, TrickleChunk: 1024, TrickleInterval: time.Millisecond})
+		res := g.upload(context.Background(), 4096)
+		if res.Err != nil || res.Status != http.StatusOK || res.Received != 4096 {
+			t.Errorf("%s: result = %+v", tt.mode, res)
+			continue
+		}
+		r := <-reqs
+		chunked := len(r.transferEncoding) == 1 && r.transferEncoding[0] == "chunked"
+		if r.contentLength != tt.contentLength || chunked != tt.chunked || len(r.body) != 4096 {
+			t.Errorf("%s: server saw ContentLength %d, Transfer-Encoding %v, %d bytes",
+				tt.mode, r.contentLength, r.transferEncoding, len(r.body))
+		}
+	}
+}
+
+// server 报告的大小或校验和与发送的内容不一致时记为错误
+func TestUploadMismatch(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		reply func([]byte) any
+		want  error
+	}{
+		{"short read", func(body []byte) any { return reply{int64(len(body)) - 1, ""} }, errSizeMismatch},
+		{"wrong sha256", func(body []byte) any {
+			r := honest(body).(reply)
+			r.SHA256 = honest(body[1:]).(reply).SHA256
+			return r
+		}, errChecksumMismatch},
+	} {
+		ts, _ := uploadServer(t, tt.reply)
+		g := newGenerator(t, Config{URL: ts.URL, Mode: ModeChunked})
+		res := g.upload(context.Background(), 1000)
+		if !errors.Is(res.Err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, res.Err, tt.want)
+		}
+		if res.Status != http.StatusOK {
+			t.Errorf("%s: status = %d, want 200", tt.name, res.Status)
+		}
+	}
+}
+
+// abort 模式发送一部分后断开，结果归类为 aborted
+func TestUploadAbort(t *testing.T) {
+	ts, _ := uploadServer(t, honest)
+	g := newGenerator(t, Config{URL: ts.URL, Mode: ModeAbort, AbortAt: 0.5})
+	res := g.upload(context.Background(), 4096)
+	if got := outcome(res); got != "aborted" {
+		t.Errorf("outcome = %q (err %v), want aborted", got, res.Err)
+	}
+}
@@ -0,0 +1,180 @@
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// Latency 延迟统计
+type Latency struct {
+	Min  time.Duration `json:"min"`
+	Mean time.Duration `json:"mean"`
+	P50  time.Duration `json:"p50"`
+	P90  time.Duration `json:"p90"`
+	P99  time.Duration `json:"p99"`
+	Max  time.Duration `json:"max"`
+}
+
+// Report 一次压测的汇总
+type Report struct {
+	URL   string `json:"url"`
+	Mode  string `json:"mode"`
+	Sizes string `json:"sizes"`
+	// Upload 上传模式
+	Upload string `json:"upload"`
+
+	Requests  int   `json:"requests"`
+	Succeeded int   `json:"succeeded"`
+	Failed    int   `json:"failed"`
+	Dropped   int64 `json:"dropped"`
+	// BytesSent 成功请求的请求体字节数
+	BytesSent int64 `json:"bytes_sent"`
+
+	Elapsed    time.Duration `json:"elapsed"`
+	Throughput float64       `json:"throughput_rps"`
+	Goodput    float64       `json:"goodput_bytes_per_second"`
+	Latency    Latency       `json:"latency"`
+	// Outcomes 按结果分类的请求数："200"、"503" 等状态码，或者 timeout、refused、reset、
+	// aborted（abort 模式主动断开）、size-mismatch（server 读取的字节数与发送的不一致）、
+	// checksum-mismatch（server 返回的 sha256 与发送的内容不一致）等
+	Outcomes map[string]int `json:"outcomes"`
+}
+
+func newReport(cfg Config, results []Result, dropped int64, elapsed time.Duration) *Report {
+	r := &Report{
+		URL:      cfg.URL,
+		Mode:     fmt.Sprintf("closed concurrency=%d think=%v", cfg.Concurrency, cfg.Think),
+		Sizes:    cfg.Sizes.String(),
+		Upload:   cfg.Mode,
+		Requests: len(results),
+		Dropped:  dropped,
+		Elapsed:  elapsed,
+		Outcomes: make(map[string]int),
+	}
+	if r.Upload == "" {
+		r.Upload = ModeContentLength
+	}
+	if cfg.Rate > 0 {
+		r.Mode = fmt.Sprintf("open rate=%g/s max-inflight=%d", cfg.Rate, cfg.Concurrency)
+	}
+
+	latencies := make([]time.Duration, 0, len(results))
+	var total time.Duration
+	for _, res := range results {
+		r.Outcomes[outcome(res)]++
+		if res.Err == nil && res.Status >= 200 && res.Status < 300 {
+			r.Succeeded++
+			r.BytesSent += res.Size
+		} else {
+			r.Failed++
+		}
+		// 只统计拿到响应的请求的延迟，连接失败的请求会拉低分位数
+		if res.Status != 0 {
+			latencies = append(latencies, res.Latency)
+			total += res.Latency
+		}
+	}
+	if secs := elapsed.Seconds(); secs > 0 {
+		r.Throughput = float64(r.Succeeded) / secs
+		r.Goodput = float64(r.BytesSent) / secs
+	}
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		r.Latency = Latency{
+			Min:  latencies[0],
+			Mean: total / time.Duration(len(latencies)),
+			P50:  percentile(latencies, 0.50),
+			P90:  percentile(latencies, 0.90),
+			P99:  percentile(latencies, 0.99),
+			Max:  latencies[len(latencies)-1],
+		}
+	}
+	return r
+}
+
+// percentile 取已排序切片的分位数（nearest-rank：第 ceil(q*n) 个值）；
+// 减去一个很小的数，避免 0.07*100 这样的浮点误差多进一位
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	idx := int(math.Ceil(q*float64(len(sorted))-1e-9)) - 1
+	return sorted[min(max(idx, 0), len(sorted)-1)]
+}
+
+// outcome 把一个结果归类为状态码或错误类型
+func outcome(res Result) string {
+	if res.Err == nil {
+		return strconv.Itoa(res.Status)
+	}
+	var netErr net.Error
+	switch {
+	case errors.Is(res.Err, errAbort):
+		return "aborted"
+	case errors.Is(res.Err, errSizeMismatch):
+		return "size-mismatch"
+	case errors.Is(res.Err, errChecksumMismatch):
+		return "checksum-mismatch"
+	case errors.Is(res.Err, context.DeadlineExceeded) || (errors.As(res.Err, &netErr) && netErr.Timeout()):
+		return "timeout"
+	case errors.Is(res.Err, context.Canceled):
+		return "canceled"
+	case errors.Is(res.Err, syscall.ECONNREFUSED):
+		return "refused"
+	case errors.Is(res.Err, syscall.ECONNRESET) || errors.Is(res.Err, syscall.EPIPE):
+		return "reset"
+	case errors.Is(res.Err, io.EOF) || errors.Is(res.Err, io.ErrUnexpectedEOF):
+		return "eof"
+	case res.Status != 0:
+		return strconv.Itoa(res.Status) + "+error"
+	default:
+		return "error"
+	}
+}
+
+// WriteJSON 以 JSON 格式输出报告
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText 以适合终端查看的格式输出报告
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "URL:\t%s\n", r.URL)
+	fmt.Fprintf(tw, "Mode:\t%s\n", r.Mode)
+	fmt.Fprintf(tw, "Body sizes:\t%s\n", r.Sizes)
+	fmt.Fprintf(tw, "Upload mode:\t%s\n", r.Upload)
+	fmt.Fprintf(tw, "Elapsed:\t%v\n", r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(tw, "Requests:\t%d (succeeded %d, failed %d, dropped %d)\n", r.Requests, r.Succeeded, r.Failed, r.Dropped)
+	fmt.Fprintf(tw, "Throughput:\t%.2f req/s, %.2f MB/s\n", r.Throughput, r.Goodput/(1<<20))
+	l := r.Latency
+	fmt.Fprintf(tw, "Latency:\tmin %v  mean %v  p50 %v  p90 %v  p99 %v  max %v\n",
+		round(l.Min), round(l.Mean), round(l.P50), round(l.P90), round(l.P99), round(l.Max))
+
+	keys := make([]string, 0, len(r.Outcomes))
+	for k := range r.Outcomes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintln(tw, "Outcomes:\t")
+	for _, k := range keys {
+		fmt.Fprintf(tw, "  %s\t%d\n", k, r.Outcomes[k])
+	}
+	return tw.Flush()
+}
+
+func round(d time.Duration) time.Duration {
+	if d >= time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(10 * time.Microsecond)
+}
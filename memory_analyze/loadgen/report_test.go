@@ -0,0 +1,83 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i))
+	}
+	tests := []struct {
+		values []time.Duration
+		q      float64
+		want   time.Duration
+	}{
+		{sorted, 0.50, 50},
+		{sorted, 0.90, 90},
+		{sorted, 0.99, 99},
+		{sorted, 0.07, 7},
+		{sorted, 1, 100},
+		{sorted, 0, 1},
+		// nearest-rank 取第 ceil(q*n) 个值，不做插值也不四舍五入
+		{sorted[:10], 0.21, 3},
+		{sorted[:10], 0.25, 3},
+		{sorted[:4], 0.50, 2},
+		{sorted[:3], 0.99, 3},
+		{sorted[:1], 0.50, 1},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.values, tt.q); got != tt.want {
+			t.Errorf("percentile(1..%d, %g) = %d, want %d", len(tt.values), tt.q, got, tt.want)
+		}
+	}
+}
+
+// timeoutError 模拟 net/http 客户端超时
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestOutcome(t *testing.T) {
+	urlErr := func(err error) error { return &url.Error{Op: "Post", URL: "http://localhost/upload", Err: err} }
+	opErr := func(op string, errno syscall.Errno) error {
+		return urlErr(&net.OpError{Op: op, Net: "tcp", Err: os.NewSyscallError(op, errno)})
+	}
+	tests := []struct {
+		res  Result
+		want string
+	}{
+		{Result{Status: 200}, "200"},
+		{Result{Status: 503}, "503"},
+		{Result{Err: urlErr(errAbort)}, "aborted"},
+		{Result{Status: 200, Err: fmt.Errorf("%w: sent 10 bytes, server read 9", errSizeMismatch)}, "size-mismatch"},
+		{Result{Status: 200, Err: fmt.Errorf("%w: server sha256 00", errChecksumMismatch)}, "checksum-mismatch"},
+		{Result{Err: urlErr(context.DeadlineExceeded)}, "timeout"},
+		{Result{Err: urlErr(timeoutError{})}, "timeout"},
+		{Result{Err: urlErr(context.Canceled)}, "canceled"},
+		{Result{Err: opErr("dial", syscall.ECONNREFUSED)}, "refused"},
+		{Result{Err: opErr("read", syscall.ECONNRESET)}, "reset"},
+		{Result{Err: opErr("write", syscall.EPIPE)}, "reset"},
+		{Result{Err: urlErr(io.EOF)}, "eof"},
+		{Result{Status: 200, Err: fmt.Errorf("failed to read response: %w", io.ErrUnexpectedEOF)}, "eof"},
+		{Result{Status: 500, Err: errors.New("failed to read response: boom")}, "500+error"},
+		{Result{Err: errors.New("boom")}, "error"},
+	}
+	for _, tt := range tests {
+		if got := outcome(tt.res); got != tt.want {
+			t.Errorf("outcome(status %d, err %v) = %q, want %q", tt.res.Status, tt.res.Err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package loadgen
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/units"
+)
+
+// SizeDist 请求体大小的分布
+type SizeDist interface {
+	// Next 返回下一个请求体的字节数
+	Next(r *rand.Rand) int64
+	// Max 可能返回的最大字节数，用于预先生成请求体数据
+	Max() int64
+	String() string
+}
+
+type fixedSize int64
+
+func (s fixedSize) Next(*rand.Rand) int64 { return int64(s) }
+func (s fixedSize) Max() int64            { return int64(s) }
+func (s fixedSize) String() string        { return "fixed:" + formatSize(int64(s)) }
+
+type uniformSize struct{ min, max int64 }
+
+func (s uniformSize) Next(r *rand.Rand) int64 { return s.min + r.Int63n(s.max-s.min+1) }
+func (s uniformSize) Max() int64              { return s.max }
+func (s uniformSize) String() string {
+	return "uniform:" + formatSize(s.min) + "-" + formatSize(s.max)
+}
+
+// lognormalSize 中位数为 median 的对数正态分布，超过 max 的值截断为 max
+type lognormalSize struct {
+	median int64
+	sigma  float64
+	max    int64
+}
+
+func (s lognormalSize) Next(r *rand.Rand) int64 {
+	v := int64(float64(s.median) * math.Exp(s.sigma*r.NormFloat64()))
+	return min(max(v, 1), s.max)
+}
+func (s lognormalSize) Max() int64 { return s.max }
+func (s lognormalSize) String() string {
+	return fmt.Sprintf("lognormal:%s,%g,%s", formatSize(s.median), s.sigma, formatSize(s.max))
+}
+
+// ParseSizeDist 解析请求体大小分布：
+//
+//	fixed:4MiB
+//	uniform:1MiB-16MiB
+//	lognormal:4MiB,1.0,64MiB   中位数、sigma、截断上限（默认中位数的 16 倍）
+func ParseSizeDist(s string) (SizeDist, error) {
+	kind, args, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid size distribution %q, expected fixed:N, uniform:MIN-MAX or lognormal:MEDIAN,SIGMA[,MAX]", s)
+	}
+	switch kind {
+	case "fixed":
+		n, err := units.ParseSize(args)
+		if err != nil {
+			return nil, err
+		}
+		return fixedSize(n), nil
+	case "uniform":
+		lo, hi, ok := strings.Cut(args, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid uniform distribution %q, expected uniform:MIN-MAX", s)
+		}
+		minSize, err := units.ParseSize(lo)
+		if err != nil {
+			return nil, err
+		}
+		maxSize, err := units.ParseSize(hi)
+		if err != nil {
+			return nil, err
+		}
+		if minSize > maxSize {
+			return nil, fmt.Errorf("invalid uniform distribution %q: min > max", s)
+		}
+		return uniformSize{min: minSize, max: maxSize}, nil
+	case "lognormal":
+		parts := strings.Split(args, ",")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid lognormal distribution %q, expected lognormal:MEDIAN,SIGMA[,MAX]", s)
+		}
+		median, err := units.ParseSize(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		sigma, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || sigma < 0 {
+			return nil, fmt.Errorf("invalid lognormal sigma %q", parts[1])
+		}
+		maxSize := median * 16
+		if len(parts) == 3 {
+			if maxSize, err = units.ParseSize(parts[2]); err != nil {
+				return nil, err
+			}
+		}
+		if median <= 0 || maxSize < median {
+			return nil, fmt.Errorf("invalid lognormal distribution %q: need 0 < median <= max", s)
+		}
+		return lognormalSize{median: median, sigma: sigma, max: maxSize}, nil
+	default:
+		return nil, fmt.Errorf("unknown size distribution %q, expected fixed, uniform or lognormal", kind)
+	}
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<30 && n%(1<<30) == 0:
+		return strconv.FormatInt(n>>30, 10) + "GiB"
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return strconv.FormatInt(n>>20, 10) + "MiB"
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return strconv.FormatInt(n>>10, 10) + "KiB"
+	default:
+		return strconv.FormatInt(n, 10) + "B"
+	}
+}
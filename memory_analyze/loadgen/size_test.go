@@ -0,0 +1,68 @@
+package loadgen
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestParseSizeDist(t *testing.T) {
+	tests := []struct {
+		in       string
+		want     string
+		wantMax  int64
+		wantFail bool
+	}{
+		{in: "fixed:4MiB", want: "fixed:4MiB", wantMax: 4 << 20},
+		{in: "fixed:1000", want: "fixed:1000B", wantMax: 1000},
+		{in: "uniform:1KiB-16KiB", want: "uniform:1KiB-16KiB", wantMax: 16 << 10},
+		{in: "uniform:1MiB-1MiB", want: "uniform:1MiB-1MiB", wantMax: 1 << 20},
+		{in: "lognormal:4MiB,1.5", want: "lognormal:4MiB,1.5,64MiB", wantMax: 64 << 20},
+		{in: "lognormal:4MiB, 0.5 ,8MiB", want: "lognormal:4MiB,0.5,8MiB", wantMax: 8 << 20},
+		{in: "4MiB", wantFail: true},
+		{in: "fixed:4XB", wantFail: true},
+		{in: "uniform:1MiB", wantFail: true},
+		{in: "uniform:16MiB-1MiB", wantFail: true},
+		{in: "lognormal:4MiB", wantFail: true},
+		{in: "lognormal:4MiB,abc", wantFail: true},
+		{in: "lognormal:4MiB,-1", wantFail: true},
+		{in: "lognormal:4MiB,1,1MiB", wantFail: true},
+		{in: "lognormal:0,1", wantFail: true},
+		{in: "pareto:1MiB", wantFail: true},
+	}
+	for _, tt := range tests {
+		d, err := ParseSizeDist(tt.in)
+		if tt.wantFail {
+			if err == nil {
+				t.Errorf("ParseSizeDist(%q) = %v, want an error", tt.in, d)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSizeDist(%q): %v", tt.in, err)
+			continue
+		}
+		if d.String() != tt.want || d.Max() != tt.wantMax {
+			t.Errorf("ParseSizeDist(%q) = %s (max %d), want %s (max %d)", tt.in, d, d.Max(), tt.want, tt.wantMax)
+		}
+	}
+}
+
+// 取样结果不超出分布的范围
+func TestSizeDistNext(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, s := range []string{"fixed:1KiB", "uniform:100-200", "lognormal:1KiB,2,4KiB"} {
+		d, err := ParseSizeDist(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lo := int64(1)
+		if u, ok := d.(uniformSize); ok {
+			lo = u.min
+		}
+		for i := 0; i < 1000; i++ {
+			if n := d.Next(rng); n < lo || n > d.Max() {
+				t.Fatalf("%s: Next = %d, want within [%d, %d]", s, n, lo, d.Max())
+			}
+		}
+	}
+}
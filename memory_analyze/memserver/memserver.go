@@ -0,0 +1,201 @@
+// Package memserver 是四个上传 server（fasthttp 和 net/http 的 bad/good）共用的启动流程：
+// 内存上限、准入控制、管理端口、heap watchdog，以及业务端口上的 /gc、/exit 测试端点。
+// 各个 server 只负责自己的上传处理器和 HTTP server。
+package memserver
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/admin"
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/metrics"
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/watchdog"
+	"github.com/gangcheng1030/ai_production_troubleshooting/memory_analyze/admission"
+	"github.com/valyala/fasthttp"
+)
+
+// Options 四个 server 共用的配置
+type Options struct {
+	Admin *admin.Options
+	// Watchdog heap 超过软/硬阈值时自动保存 heap profile；阈值默认按 -memory-limit 的比例计算
+	Watchdog *watchdog.Options
+	Memory   *watchdog.MemoryOptions
+	// Admission 准入控制：限制同时处理的上传数和在途请求体字节数，默认不限制
+	Admission *admission.Options
+}
+
+// Flags 在 fs 上注册共用的 flag；name 是 watchdog 日志中的 server 名称
+func Flags(fs *flag.FlagSet, name string) *Options {
+	return &Options{
+		Admin: admin.Flags(fs, admin.Options{Addr: ":6060"}),
+		Watchdog: watchdog.Flags(fs, watchdog.Options{
+			Name:        name,
+			Interval:    time.Second,
+			Cooldown:    30 * time.Second,
+			MaxCaptures: 10,
+		}),
+		Memory:    watchdog.MemoryFlags(fs, watchdog.MemoryOptions{}),
+		Admission: admission.Flags(fs, admission.Options{}),
+	}
+}
+
+// Server 已经启动的管理端口、准入控制和 watchdog
+type Server struct {
+	Admin *admin.Server
+	// Limiter 未配置准入控制时为 nil，nil 的 Limiter 不做任何限制
+	Limiter *admission.Limiter
+}
+
+// Start 应用内存上限，创建准入控制，启动管理端口和 heap watchdog
+func (o *Options) Start() (*Server, error) {
+	limit, softMB, hardMB, err := o.Memory.Apply()
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 {
+		log.Printf("Memory limit: %dMB, heap soft/hard thresholds: %dMB/%dMB", limit>>20, softMB, hardMB)
+	}
+
+	limiter, err := o.Admission.New(metrics.Default)
+	if err != nil {
+		return nil, err
+	}
+	if limiter != nil {
+		log.Printf("Upload admission: max uploads %d, max in-flight bytes %q, queue timeout %v",
+			o.Admission.MaxConcurrent, o.Admission.MaxInflight, o.Admission.QueueTimeout)
+	}
+
+	// 启动管理端口（pprof、/healthz、/readyz 等）
+	adm := admin.New(*o.Admin)
+	if err := adm.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start admin server: %w", err)
+	}
+	log.Printf("Heap profile: http://%s/debug/pprof/heap", adm.Addr())
+	log.Printf("Allocs profile: http://%s/debug/pprof/allocs", adm.Addr())
+	log.Printf("Metrics: http://%s/metrics", adm.Addr())
+
+	wd := watchdog.New(*o.Watchdog, append(watchdog.Rules(*o.Watchdog), watchdog.HeapRules(softMB, hardMB)...)...)
+	wd.OnTrigger(watchdog.HeapHandler(wd.Logf))
+	wdCtx, stopWatchdog := context.WithCancel(context.Background())
+	go wd.Run(wdCtx)
+	adm.OnShutdown(func(ctx context.Context) error {
+		stopWatchdog()
+		return nil
+	})
+
+	return &Server{Admin: adm, Limiter: limiter}, nil
+}
+
+// Serve 在后台运行 serve（业务 server 的 ListenAndServe），标记就绪后等待退出；
+// 退出时先调用 shutdown 关闭业务 server
+func (s *Server) Serve(serve func() error, shutdown func(ctx context.Context) error) {
+	s.Admin.OnShutdown(shutdown)
+	go func() {
+		if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Error in ListenAndServe: %v", err)
+		}
+	}()
+	s.Admin.SetReady(true)
+
+	if err := s.Admin.Wait(); err != nil {
+		log.Printf("shutdown error: %v", err)
+	}
+}
+
+// GC 强制 GC 端点（仅用于测试），只接受 POST
+func (s *Server) GC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	runtime.GC()
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"status":"gc triggered"}`)
+}
+
+// Exit 退出：交给管理端口执行优雅退出，只接受 POST
+func (s *Server) Exit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"status":"exit"}`)
+	s.Admin.Exit()
+}
+
+// FastHTTPGC fasthttp 版本的 GC
+func (s *Server) FastHTTPGC(ctx *fasthttp.RequestCtx) {
+	DrainBody(ctx)
+	if !ctx.IsPost() {
+		ctx.Error("method not allowed", fasthttp.StatusMethodNotAllowed)
+		return
+	}
+	runtime.GC()
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	fmt.Fprintf(ctx, `{"status":"gc triggered"}`)
+}
+
+// FastHTTPExit fasthttp 版本的 Exit
+func (s *Server) FastHTTPExit(ctx *fasthttp.RequestCtx) {
+	DrainBody(ctx)
+	if !ctx.IsPost() {
+		ctx.Error("method not allowed", fasthttp.StatusMethodNotAllowed)
+		return
+	}
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	fmt.Fprintf(ctx, `{"status":"exit"}`)
+	s.Admin.Exit()
+}
+
+// FastHTTPRouter 按路径分发 fasthttp 请求并记录 http_server_* 指标；
+// 未知路径返回 404，在指标中统一记为 other，避免标签无限增长
+func FastHTTPRouter(m *metrics.HTTPMetrics, routes map[string]fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		path := string(ctx.Path())
+		h, ok := routes[path]
+		route := path
+		if !ok {
+			route = "other"
+		}
+		done := m.Start(route)
+		defer func() { done(ctx.Response.StatusCode()) }()
+
+		if !ok {
+			DrainBody(ctx)
+			ctx.Error("Not Found", fasthttp.StatusNotFound)
+			return
+		}
+		h(ctx)
+	}
+}
+
+// FastHTTPConnState 返回 fasthttp.Server.ConnState 回调，统计当前打开的连接数
+func FastHTTPConnState(m *metrics.HTTPMetrics) func(net.Conn, fasthttp.ConnState) {
+	return func(_ net.Conn, state fasthttp.ConnState) {
+		switch state {
+		case fasthttp.StateNew:
+			m.ConnOpened()
+		case fasthttp.StateHijacked, fasthttp.StateClosed:
+			m.ConnClosed()
+		}
+	}
+}
+
+// DrainBody 使用 StreamRequestBody 时，不处理请求体的端点也必须读完请求体（即使可能为空），
+// 否则连接上残留的数据会被当成下一个请求
+func DrainBody(ctx *fasthttp.RequestCtx) {
+	if ctx.RequestBodyStream() != nil {
+		io.Copy(io.Discard, ctx.RequestBodyStream())
+	}
+}
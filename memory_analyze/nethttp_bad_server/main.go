@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/metrics"
+	"github.com/gangcheng1030/ai_production_troubleshooting/memory_analyze/memserver"
+	"github.com/gangcheng1030/ai_production_troubleshooting/memory_analyze/sink"
+)
+
+// net/http 版本的 bad_server：与 fasthttp 版本使用相同的 /upload、/gc、/exit 接口和 sink
+
+// maxBodySize chunked 上传大小未知时，准入控制按这个大小预留额度；badHandler 本身不限制请求体大小
+const maxBodySize = 100 * 1024 * 1024 // 100MB
+
+var (
+	addr = flag.String("addr", ":8080", "HTTP server address")
+	// 管理端口、watchdog、内存上限和准入控制
+	serverOpts = memserver.Flags(flag.CommandLine, "NetHTTPBadServer")
+	// 与 nethttp_good_server 使用同一组 sink，但不使用 -budget：请求体总是完整地读进内存
+	sinkOpts = sink.Flags(flag.CommandLine, sink.Options{})
+)
+
+var (
+	uploadSink sink.Sink
+	// 管理端口 /metrics 中的 http_server_* 指标，按路由统计
+	httpMetrics = metrics.NewHTTPMetrics(metrics.Default, "http_server")
+)
+
+// 坏的实现：io.ReadAll 把整个请求体读进内存，再一次性写入 sink；
+// 没有大小限制，ReadAll 按需翻倍扩容，峰值可能达到请求体大小的两倍
+func badHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	httpMetrics.AddReceived("/upload", int64(len(body)))
+	if err != nil {
+		log.Printf("ERROR: Failed to read body after %d bytes (Content-Length: %d): %v", len(body), r.ContentLength, err)
+		http.Error(w, "Bad Request: incomplete body", http.StatusBadRequest)
+		return
+	}
+	size := len(body)
+
+	upload, err := uploadSink.Open(r.Context(), int64(size))
+	if err != nil {
+		log.Printf("ERROR: Failed to open %s sink: %v", uploadSink.Name(), err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if _, err := upload.Write(body); err != nil {
+		upload.Abort()
+		log.Printf("ERROR: Failed to write %d bytes to %s sink: %v", size, uploadSink.Name(), err)
+		http.Error(w, "Bad Gateway: sink failed", http.StatusBadGateway)
+		return
+	}
+	res, err := upload.Commit()
+	if err != nil {
+		upload.Abort()
+		log.Printf("ERROR: Failed to commit %d bytes to %s sink: %v", size, uploadSink.Name(), err)
+		http.Error(w, "Bad Gateway: sink failed", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"status":"success","size":%d,"content_length":%d,"sha256":"%s","sink":"%s","mode":"nethttp-bad"}`,
+		size, r.ContentLength, res.SHA256, uploadSink.Name())
+}
+
+func main() {
+	flag.Parse()
+
+	srv, err := serverOpts.Start()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	uploadSink, err = sinkOpts.New()
+	if err != nil {
+		log.Fatalf("invalid sink: %v", err)
+	}
+	log.Printf("Upload sink: %s (whole body buffered in memory)", uploadSink.Name())
+
+	mux := http.NewServeMux()
+	mux.Handle("/upload", httpMetrics.Wrap("/upload", srv.Limiter.Wrap(http.HandlerFunc(badHandler), maxBodySize)))
+	mux.Handle("/gc", httpMetrics.Wrap("/gc", http.HandlerFunc(srv.GC)))
+	mux.Handle("/exit", httpMetrics.Wrap("/exit", http.HandlerFunc(srv.Exit)))
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		ConnState:         httpMetrics.ConnState,
+	}
+
+	log.Printf("Starting net/http server on http://localhost%s", *addr)
+	log.Printf("Upload endpoint: POST http://localhost%s/upload", *addr)
+	log.Printf("GC endpoint: POST http://localhost%s/gc", *addr)
+	log.Printf("Exit endpoint: POST http://localhost%s/exit", *addr)
+
+	srv.Serve(server.ListenAndServe, server.Shutdown)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/metrics"
+	"github.com/gangcheng1030/ai_production_troubleshooting/memory_analyze/memserver"
+	"github.com/gangcheng1030/ai_production_troubleshooting/memory_analyze/sink"
+)
+
+// net/http 版本的 good_server：与 fasthttp 版本使用相同的 /upload、/gc、/exit 接口和 sink
+
+var (
+	addr    = flag.String("addr", ":8080", "HTTP server address")
+	maxBody = flag.Int64("max-body", 100*1024*1024, "max request body size in bytes, enforced by http.MaxBytesReader")
+	// 管理端口、watchdog、内存上限和准入控制
+	serverOpts = memserver.Flags(flag.CommandLine, "NetHTTPGoodServer")
+	sinkOpts   = sink.Flags(flag.CommandLine, sink.Options{})
+)
+
+var (
+	uploadSink sink.Sink
+	copier     *sink.Copier
+	// 管理端口 /metrics 中的 http_server_* 指标，按路由统计
+	httpMetrics = metrics.NewHTTPMetrics(metrics.Default, "http_server")
+)
+
+// 好的实现：请求体已经由 limitBody 套上 http.MaxBytesReader，以固定大小的缓冲区流式写入 sink
+func goodHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// chunked 上传时为 -1；net/http 会自行校验 Content-Length，请求体被截断时返回 io.ErrUnexpectedEOF
+	contentLength := r.ContentLength
+	if contentLength > *maxBody {
+		// 声明的大小已经超限，不必读取请求体
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	upload, err := uploadSink.Open(r.Context(), contentLength)
+	if err != nil {
+		log.Printf("ERROR: Failed to open %s sink: %v", uploadSink.Name(), err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	n, err := copier.Copy(upload, r.Body)
+	httpMetrics.AddReceived("/upload", n)
+	if err != nil {
+		upload.Abort()
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			log.Printf("ERROR: Body exceeds %d bytes, rejected after %d bytes", tooLarge.Limit, n)
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		var writeErr *sink.WriteError
+		if errors.As(err, &writeErr) {
+			log.Printf("ERROR: Failed to write to %s sink after %d bytes: %v", uploadSink.Name(), n, writeErr.Err)
+			http.Error(w, "Bad Gateway: sink failed", http.StatusBadGateway)
+			return
+		}
+		// 客户端中途断开、请求体不完整
+		log.Printf("ERROR: Failed to stream body after %d bytes (Content-Length: %d): %v", n, contentLength, err)
+		http.Error(w, "Bad Request: incomplete body", http.StatusBadRequest)
+		return
+	}
+
+	res, err := upload.Commit()
+	if err != nil {
+		upload.Abort()
+		log.Printf("ERROR: Failed to commit %d bytes to %s sink: %v", n, uploadSink.Name(), err)
+		http.Error(w, "Bad Gateway: sink failed", http.StatusBadGateway)
+		return
+	}
+	log.Printf("DEBUG: Streamed %d bytes to %s sink (Content-Length: %d, sha256: %.12s)", n, uploadSink.Name(), contentLength, res.SHA256)
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"status":"success","size":%d,"content_length":%d,"sha256":"%s","sink":"%s","mode":"nethttp-good"}`,
+		n, contentLength, res.SHA256, uploadSink.Name())
+}
+
+// limitBody 用原始的 ResponseWriter 给请求体套上 http.MaxBytesReader，必须在指标包装的外层：
+// 超限时 net/http 通过它把连接标记为响应后关闭，包装过的 ResponseWriter 做不到
+func limitBody(n int64, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// newMux 注册 /upload、/gc 和 /exit
+func newMux(srv *memserver.Server) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/upload", limitBody(*maxBody, httpMetrics.Wrap("/upload", srv.Limiter.Wrap(http.HandlerFunc(goodHandler), *maxBody))))
+	mux.Handle("/gc", httpMetrics.Wrap("/gc", http.HandlerFunc(srv.GC)))
+	mux.Handle("/exit", httpMetrics.Wrap("/exit", http.HandlerFunc(srv.Exit)))
+	return mux
+}
+
+func main() {
+	flag.Parse()
+
+	srv, err := serverOpts.Start()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	uploadSink, err = sinkOpts.New()
+	if err != nil {
+		log.Fatalf("invalid sink: %v", err)
+	}
+	budget, err := sinkOpts.BudgetBytes()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	copier = sink.NewCopier(budget)
+	log.Printf("Upload sink: %s, per-request buffer: %d bytes", uploadSink.Name(), budget)
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           newMux(srv),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		ConnState:         httpMetrics.ConnState,
+	}
+
+	log.Printf("Starting net/http server on http://localhost%s", *addr)
+	log.Printf("Upload endpoint: POST http://localhost%s/upload", *addr)
+	log.Printf("GC endpoint: POST http://localhost%s/gc", *addr)
+	log.Printf("Exit endpoint: POST http://localhost%s/exit", *addr)
+
+	srv.Serve(server.ListenAndServe, server.Shutdown)
+}
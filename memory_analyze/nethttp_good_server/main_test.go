@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/memory_analyze/memserver"
+	"github.com/gangcheng1030/ai_production_troubleshooting/memory_analyze/sink"
+)
+
+func newTestServer(t *testing.T, limit int64) *httptest.Server {
+	t.Helper()
+	old := *maxBody
+	*maxBody = limit
+	t.Cleanup(func() { *maxBody = old })
+
+	var err error
+	if uploadSink, err = (sink.Options{}).New(); err != nil {
+		t.Fatal(err)
+	}
+	copier = sink.NewCopier(4096)
+	ts := httptest.NewServer(newMux(&memserver.Server{}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// post 发送大小未知的 chunked 请求体，只有读取时才能发现超限
+func post(t *testing.T, url, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, io.NopCloser(strings.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp
+}
+
+func TestUploadWithinLimit(t *testing.T) {
+	ts := newTestServer(t, 1024)
+	resp := post(t, ts.URL+"/upload", strings.Repeat("x", 1000))
+	if resp.StatusCode != http.StatusOK || resp.Close {
+		t.Errorf("status %d, close %v; want 200 on a kept-alive connection", resp.StatusCode, resp.Close)
+	}
+}
+
+// 超限的请求体经过指标包装后仍然返回 413，并且 net/http 在响应后关闭连接
+func TestUploadTooLargeClosesConnection(t *testing.T) {
+	ts := newTestServer(t, 1024)
+	resp := post(t, ts.URL+"/upload", strings.Repeat("x", 4096))
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", resp.StatusCode)
+	}
+	// 客户端把响应头 Connection: close 解析为 resp.Close
+	if !resp.Close {
+		t.Error("response to an oversized body should carry Connection: close")
+	}
+}
+
+// /gc 和 /exit 只接受 POST，GET 不能触发 GC 或关掉进程
+func TestControlEndpointsRequirePost(t *testing.T) {
+	ts := newTestServer(t, 1024)
+	for _, path := range []string{"/gc", "/exit"} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("GET %s: status %d, want 405", path, resp.StatusCode)
+		}
+	}
+	if resp := post(t, ts.URL+"/gc", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("POST /gc: status %d, want 200", resp.StatusCode)
+	}
+}
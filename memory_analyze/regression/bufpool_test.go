@@ -0,0 +1,55 @@
+package regression
+
+import (
+	"testing"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/memory_analyze/bufpool"
+)
+
+// TestPooledBodyBuffersCapped bad_server -pooled 把请求体读进带统计的缓冲区池：
+// 大上传之后即使只剩小请求，不限容量的池仍然留着大缓冲区；-pool-max-cap 丢弃超过上限的缓冲区后，
+// 池中只剩小缓冲区
+func TestPooledBodyBuffersCapped(t *testing.T) {
+	requireRegression(t)
+	const maxCap = 1 << 20
+	dir := artifacts(t)
+
+	uncapped := runPooled(t, dir, "bad_server_pool_uncapped", "0")
+	capped := runPooled(t, dir, "bad_server_pool_capped", "1MiB")
+	t.Logf("uncapped pool: %d idle buffers, %d bytes, largest %v", uncapped.Idle, uncapped.IdleBytes, uncapped.Largest)
+	t.Logf("capped pool:   %d idle buffers, %d bytes, largest %v, %d dropped over cap",
+		capped.Idle, capped.IdleBytes, capped.Largest, capped.DroppedCap)
+
+	if len(uncapped.Largest) == 0 || uncapped.Largest[0] <= maxCap {
+		t.Errorf("uncapped pool kept no buffer larger than %d bytes after large uploads: %v", maxCap, uncapped.Largest)
+	}
+	for _, c := range capped.Largest {
+		if c > maxCap {
+			t.Errorf("capped pool kept a %d byte buffer, cap is %d", c, maxCap)
+		}
+	}
+	if capped.DroppedCap == 0 {
+		t.Errorf("capped pool dropped no oversized buffers")
+	}
+	if float64(uncapped.IdleBytes) < *minRatio*float64(capped.IdleBytes) {
+		t.Errorf("uncapped pool idle bytes %d is less than %.1fx capped pool idle bytes %d",
+			uncapped.IdleBytes, *minRatio, capped.IdleBytes)
+	}
+}
+
+// runPooled 以 -pooled 启动 bad_server，先发送大上传，再发送同样数量的 4KiB 小上传模拟流量回落，
+// 返回此时池的统计
+func runPooled(t *testing.T, dir, label, maxCap string) bufpool.Stats {
+	t.Helper()
+	srv := startServer(t, dir, "bad_server", label, "-pooled", "-pool-max-cap", maxCap)
+	defer srv.stop()
+	upload(t, dir, srv, *uploadSizes)
+	upload(t, dir, srv, "fixed:4KiB")
+	heapProfile(t, dir, srv)
+
+	st, err := getJSON[bufpool.Stats]("http://" + srv.adminAddr + "/debug/bufpool")
+	if err != nil {
+		t.Fatalf("%s: %v", label, err)
+	}
+	return st
+}
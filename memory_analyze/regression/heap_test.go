@@ -0,0 +1,410 @@
+// Package regression 是 memory_analyze 的内存回归测试：在随机端口上以子进程启动 good/bad server，
+// 发送同样的缩减版上传负载，然后断言两者 heap profile 的差异。
+// 取代原来只打印结果、从不失败的 test.sh。
+//
+// 测试需要编译 server 并发送上百 MB 的上传，只在设置了 MEMORY_REGRESSION=1 时运行（test.sh 会设置）：
+//
+//	MEMORY_REGRESSION=1 go test ./regression -v
+//	MEMORY_REGRESSION=1 go test ./regression -v -upload-requests 200 -min-ratio 5
+//
+// 测试失败时保留 profile、server 日志、RSS 时间线和对比报告，路径会打印在测试输出中。
+package regression
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/profdiff"
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/timeline"
+	"github.com/gangcheng1030/ai_production_troubleshooting/memory_analyze/loadgen"
+)
+
+var (
+	uploadRequests = flag.Int("upload-requests", 64, "number of uploads sent to each server")
+	uploadSizes    = flag.String("upload-sizes", "uniform:1MiB-8MiB", "body size distribution of the uploads")
+	concurrency    = flag.Int("upload-concurrency", 8, "number of concurrent uploads")
+	minRatio       = flag.Float64("min-ratio", 3, "bad must use at least this many times the memory of good (inuse_space for fasthttp, alloc_space for net/http)")
+	wantTopSite    = flag.String("top-site", `ByteBuffer\)\.ReadFrom$`, "regexp the top fasthttp bad_server allocation site must match")
+	resultsDir     = flag.String("results-dir", "", "directory for profiles and logs (default: a temp dir, removed when the test passes)")
+	keepArtifacts  = flag.Bool("keep", false, "keep profiles and logs even when the test passes")
+)
+
+// enableEnv 设置后才运行回归测试
+const enableEnv = "MEMORY_REGRESSION"
+
+// requireRegression 未设置 MEMORY_REGRESSION 或使用 -short 时跳过测试，避免 go test ./... 默认编译 server 并跑上传负载
+func requireRegression(t *testing.T) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping server build and upload workload in -short mode")
+	}
+	if os.Getenv(enableEnv) == "" {
+		t.Skipf("set %s=1 (or run ./test.sh) to build the servers and run the upload workload", enableEnv)
+	}
+}
+
+// TestBadServerRetainsUploadBuffers bad_server 通过 ctx.Request.Body() 把整个请求体读进
+// bytebufferpool 的缓冲区，GC 后这些缓冲区仍被池留住；good_server 只用固定大小的缓冲区流式处理
+func TestBadServerRetainsUploadBuffers(t *testing.T) {
+	report := compareVariants(t, "good_server", "bad_server", "inuse_space")
+	assertGrowth(t, report, *minRatio)
+	assertTopSite(t, report, *wantTopSite)
+}
+
+// TestNetHTTPBadServerAllocatesWholeBody net/http 不会把请求体缓冲区放回池中，io.ReadAll 的内存
+// 在 GC 后就被回收，inuse 看不出差别，所以按累计分配量（alloc_space）对比
+func TestNetHTTPBadServerAllocatesWholeBody(t *testing.T) {
+	report := compareVariants(t, "nethttp_good_server", "nethttp_bad_server", "alloc_space")
+	assertGrowth(t, report, *minRatio)
+	assertTopSite(t, report, `^io\.ReadAll$`)
+}
+
+// compareVariants 依次运行两个 server 并按 sampleType 对比它们的 heap profile，报告同时保存到 artifacts 目录
+func compareVariants(t *testing.T, goodName, badName, sampleType string) *profdiff.HeapReport {
+	t.Helper()
+	requireRegression(t)
+	dir := artifacts(t)
+
+	good := runVariant(t, dir, goodName)
+	bad := runVariant(t, dir, badName)
+	return diffProfiles(t, dir, good, bad, goodName, badName, sampleType)
+}
+
+// diffProfiles 按 sampleType 对比两个 heap profile，报告保存为 heapdiff_<badLabel>.txt
+func diffProfiles(t *testing.T, dir, good, bad, goodLabel, badLabel, sampleType string) *profdiff.HeapReport {
+	t.Helper()
+	report, err := profdiff.LoadHeapDiff(good, bad, goodLabel, badLabel, profdiff.HeapOptions{
+		SampleType:     sampleType,
+		Top:            10,
+		FlagShare:      0.2,
+		HandlerPattern: regexp.MustCompile(`Handler$`),
+	})
+	if err != nil {
+		t.Fatalf("compare heap profiles: %v", err)
+	}
+	var text bytes.Buffer
+	report.WriteText(&text)
+	if err := os.WriteFile(filepath.Join(dir, "heapdiff_"+badLabel+".txt"), text.Bytes(), 0o644); err != nil {
+		t.Errorf("write report: %v", err)
+	}
+	t.Logf("heap diff (%s vs %s):\n%s", goodLabel, badLabel, text.String())
+	return report
+}
+
+// assertGrowth 断言 bad 在排序所用的 sample 类型上至少是 good 的 ratio 倍；
+// good 的总量为 0 或报告中没有该类型的总量时无法比较，同样视为失败
+func assertGrowth(t *testing.T, report *profdiff.HeapReport, ratio float64) {
+	t.Helper()
+	for _, total := range report.Totals {
+		if total.SampleType != report.SampleType {
+			continue
+		}
+		if total.Base <= 0 {
+			t.Errorf("%s %s is %d, cannot compare %s against it", report.BaseLabel, total.SampleType, total.Base, report.TargetLabel)
+		} else if float64(total.Target) < ratio*float64(total.Base) {
+			t.Errorf("%s %s %d is only %.1fx %s %d, want at least %.1fx",
+				report.TargetLabel, total.SampleType, total.Target, total.Growth, report.BaseLabel, total.Base, ratio)
+		}
+		return
+	}
+	t.Errorf("heap report has no %s total", report.SampleType)
+}
+
+// assertTopSite 断言增长最多的分配点（栈顶函数）匹配 pattern
+func assertTopSite(t *testing.T, report *profdiff.HeapReport, pattern string) {
+	t.Helper()
+	if len(report.Sites) == 0 {
+		t.Fatalf("%s has no allocation site above %s", report.TargetLabel, report.BaseLabel)
+	}
+	top := report.Sites[0]
+	if !regexp.MustCompile(pattern).MatchString(top.Leaf) {
+		t.Errorf("top %s allocation site is %s (%.0f%% of growth), want %s\npath: %s",
+			report.TargetLabel, top.Leaf, top.GrowthShare*100, pattern, strings.Join(top.Path, " <- "))
+	}
+}
+
+// artifacts 返回保存 profile 和日志的目录，指定 -results-dir 时每个测试使用其中以测试名命名的子目录；
+// 测试通过且没有 -keep 时自动删除临时目录
+func artifacts(t *testing.T) string {
+	t.Helper()
+	var dir string
+	var err error
+	if *resultsDir == "" {
+		dir, err = os.MkdirTemp("", "memory-regression-")
+	} else {
+		dir = filepath.Join(*resultsDir, t.Name())
+		err = os.MkdirAll(dir, 0o755)
+	}
+	if err != nil {
+		t.Fatalf("create artifacts dir: %v", err)
+	}
+	t.Cleanup(func() {
+		if t.Failed() || *keepArtifacts || *resultsDir != "" {
+			t.Logf("artifacts kept in %s", dir)
+			return
+		}
+		os.RemoveAll(dir)
+	})
+	return dir
+}
+
+// runVariant 启动一个 server，发送上传负载、触发 GC，然后保存 heap profile 并返回其路径
+func runVariant(t *testing.T, dir, name string) string {
+	t.Helper()
+	srv := startServer(t, dir, name, name)
+	defer srv.stop()
+	upload(t, dir, srv, *uploadSizes)
+	return heapProfile(t, dir, srv)
+}
+
+// server 一个以子进程运行的 server
+type server struct {
+	label     string
+	addr      string
+	adminAddr string
+	stop      func()
+}
+
+// startServer 编译并在随机端口上启动 ./<name>，label 用于区分同一个 server 的不同参数组合；
+// 测试结束时自动停止
+func startServer(t *testing.T, dir, name, label string, args ...string) *server {
+	t.Helper()
+	bin := filepath.Join(dir, name)
+	if _, err := os.Stat(bin); err != nil {
+		build := exec.Command("go", "build", "-o", bin, "./"+name)
+		build.Dir = ".."
+		if out, err := build.CombinedOutput(); err != nil {
+			t.Fatalf("build %s: %v\n%s", name, err, out)
+		}
+	}
+
+	srv := &server{label: label, addr: freeAddr(t), adminAddr: freeAddr(t)}
+	logFile, err := os.Create(filepath.Join(dir, label+".log"))
+	if err != nil {
+		t.Fatalf("create log: %v", err)
+	}
+
+	// watchdog 默认在当前目录写快照，放到 artifacts 目录中
+	args = append([]string{"-addr", srv.addr, "-admin", srv.adminAddr, "-watchdog-dir", filepath.Join(dir, "watchdog")}, args...)
+	cmd := exec.Command(bin, args...)
+	cmd.Stdout, cmd.Stderr = logFile, logFile
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		t.Fatalf("start %s: %v", label, err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	stopTimeline := func() {}
+	var once sync.Once
+	srv.stop = func() {
+		once.Do(func() {
+			// 优雅退出失败时强制结束，避免子进程泄漏
+			post("http://" + srv.adminAddr + "/exit")
+			select {
+			case <-exited:
+			case <-time.After(10 * time.Second):
+				cmd.Process.Kill()
+				<-exited
+			}
+			logFile.Close()
+			stopTimeline()
+		})
+	}
+	t.Cleanup(srv.stop)
+
+	if err := waitReady(srv.adminAddr, srv.addr, exited); err != nil {
+		t.Fatalf("%s did not start: %v (see %s)", label, err, logFile.Name())
+	}
+	stopTimeline = recordTimeline(t, dir, srv)
+	return srv
+}
+
+// recordTimeline 在后台记录 server 的 RSS 和 runtime/metrics 时间线；
+// 返回的函数结束记录并写入 <label>_timeline.csv、.json 和 .html
+func recordTimeline(t *testing.T, dir string, srv *server) func() {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	type result struct {
+		samples []timeline.Sample
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		rec := &timeline.Recorder{Source: timeline.Source{Admin: srv.adminAddr}, Interval: 250 * time.Millisecond}
+		samples, err := rec.Record(ctx)
+		done <- result{samples, err}
+	}()
+
+	return func() {
+		cancel()
+		r := <-done
+		if r.err != nil {
+			t.Logf("%s: record timeline: %v", srv.label, r.err)
+			return
+		}
+		prefix := filepath.Join(dir, srv.label+"_timeline")
+		for ext, write := range map[string]func(io.Writer) error{
+			".csv":  func(w io.Writer) error { return timeline.WriteCSV(w, r.samples) },
+			".json": func(w io.Writer) error { return timeline.WriteJSON(w, r.samples) },
+			".html": func(w io.Writer) error { return timeline.WriteHTML(w, srv.label, r.samples) },
+		} {
+			if err := writeFile(prefix+ext, write); err != nil {
+				t.Errorf("%s: write timeline: %v", srv.label, err)
+			}
+		}
+	}
+}
+
+// upload 按 sizes 分布向 server 发送 -upload-requests 个上传，任何一个失败都使测试失败
+func upload(t *testing.T, dir string, srv *server, sizes string) {
+	t.Helper()
+	dist, err := loadgen.ParseSizeDist(sizes)
+	if err != nil {
+		t.Fatalf("invalid upload sizes: %v", err)
+	}
+	report, err := loadgen.Run(context.Background(), loadgen.Config{
+		URL:         "http://" + srv.addr + "/upload",
+		Concurrency: *concurrency,
+		Requests:    *uploadRequests,
+		Sizes:       dist,
+		Mode:        loadgen.ModeContentLength,
+		Timeout:     30 * time.Second,
+		Seed:        1,
+	})
+	if err != nil {
+		t.Fatalf("%s: load test: %v", srv.label, err)
+	}
+	var text bytes.Buffer
+	report.WriteText(&text)
+	f, err := os.OpenFile(filepath.Join(dir, srv.label+"_client.txt"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err == nil {
+		f.Write(text.Bytes())
+		f.Close()
+	}
+	if report.Failed > 0 {
+		t.Fatalf("%s: %d of %d uploads failed: %v", srv.label, report.Failed, report.Requests, report.Outcomes)
+	}
+}
+
+// heapProfile 与 client 的 -gc 一样先执行一次 GC，再保存 heap profile，反映 GC 之后仍然存活的内存
+func heapProfile(t *testing.T, dir string, srv *server) string {
+	t.Helper()
+	if err := post("http://" + srv.addr + "/gc"); err != nil {
+		t.Fatalf("%s: trigger GC: %v", srv.label, err)
+	}
+	heap := filepath.Join(dir, srv.label+"_heap.prof")
+	if err := download("http://"+srv.adminAddr+"/debug/pprof/heap", heap); err != nil {
+		t.Fatalf("%s: fetch heap profile: %v", srv.label, err)
+	}
+	return heap
+}
+
+// freeAddr 返回一个当前空闲的本地端口
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("find free port: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// waitReady 等待管理端口的 /readyz 返回 200 并且业务端口可以连接
+func waitReady(adminAddr, addr string, exited <-chan error) error {
+	deadline := time.Now().Add(15 * time.Second)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-exited:
+			return fmt.Errorf("process exited: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+		resp, err := http.Get("http://" + adminAddr + "/readyz")
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			continue
+		}
+		if conn, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+			conn.Close()
+			return nil
+		}
+	}
+	return fmt.Errorf("timed out waiting for %s and %s", adminAddr, addr)
+}
+
+func post(url string) error {
+	resp, err := http.Post(url, "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("POST %s: %s", url, resp.Status)
+	}
+	return nil
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// getJSON 请求 url 并把 JSON 响应解码为 T，用于读取管理端口上的 /debug/* 统计
+func getJSON[T any](url string) (T, error) {
+	var v T
+	resp, err := http.Get(url)
+	if err != nil {
+		return v, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return v, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&v)
+	return v, err
+}
+
+func download(url, path string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,70 @@
+package regression
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/memory_analyze/retain"
+)
+
+// 引用滞留测试使用较小的请求体：每个模式都会把所有请求体留在内存中
+const retainSizes = "uniform:256KiB-1MiB"
+
+// TestRetainModesHaveIdentifiableOwner bad_server -retain 的三种坏模式都把请求体留在内存中，
+// 与 ttl 模式对比时，增长最多的分配点应该是持有这些内存的 Store，而不是 bytebufferpool 的临时分配；
+// ttl 模式在 TTL 到期后不再持有任何请求体
+func TestRetainModesHaveIdentifiableOwner(t *testing.T) {
+	requireRegression(t)
+	dir := artifacts(t)
+
+	ttlHeap, ttlStats := runRetain(t, dir, retain.ModeTTL, "-retain-ttl", "500ms")
+	if ttlStats.Items != 0 || ttlStats.Bytes != 0 {
+		t.Errorf("ttl mode still holds %d items (%d bytes) after the TTL expired", ttlStats.Items, ttlStats.Bytes)
+	}
+
+	for _, tc := range []struct {
+		mode  string
+		owner string
+		args  []string
+	}{
+		{retain.ModeMap, `retain\.\(\*mapStore\)\.Keep$`, nil},
+		{retain.ModeQueue, `retain\.\(\*queueStore\)\.Keep$`, []string{"-retain-delay", "10s"}},
+		{retain.ModeSubslice, `retain\.\(\*subsliceStore\)\.Keep$`, nil},
+	} {
+		t.Run(tc.mode, func(t *testing.T) {
+			heap, st := runRetain(t, dir, tc.mode, tc.args...)
+			t.Logf("%s: %d items, %d bytes pinned, %d bytes used (owner %s)", tc.mode, st.Items, st.Bytes, st.UsefulBytes, st.Owner)
+			if st.Items == 0 {
+				t.Fatalf("%s mode retained no request bodies", tc.mode)
+			}
+			if tc.mode == retain.ModeSubslice && st.UsefulBytes*100 > st.Bytes {
+				t.Errorf("subslice mode uses %d of %d pinned bytes, expected the sub-slices to pin whole bodies", st.UsefulBytes, st.Bytes)
+			}
+
+			report := diffProfiles(t, dir, ttlHeap, heap, "retain_ttl", "retain_"+tc.mode, "inuse_space")
+			assertTopSite(t, report, tc.owner)
+			if top := report.Sites[0]; top.GrowthShare < 0.5 {
+				t.Errorf("%s accounts for only %.0f%% of the inuse growth, want at least 50%%", top.Leaf, top.GrowthShare*100)
+			}
+		})
+	}
+}
+
+// runRetain 以 -retain mode 启动 bad_server 并发送上传，等待 ttl 模式的条目过期后保存 heap profile，
+// 返回 profile 路径和此时的滞留统计
+func runRetain(t *testing.T, dir, mode string, args ...string) (string, retain.Stats) {
+	t.Helper()
+	srv := startServer(t, dir, "bad_server", "retain_"+mode, append([]string{"-retain", mode}, args...)...)
+	defer srv.stop()
+	upload(t, dir, srv, retainSizes)
+	if mode == retain.ModeTTL {
+		time.Sleep(time.Second)
+	}
+	heap := heapProfile(t, dir, srv)
+
+	st, err := getJSON[retain.Stats]("http://" + srv.adminAddr + "/debug/retain")
+	if err != nil {
+		t.Fatalf("%s: %v", mode, err)
+	}
+	return heap, st
+}
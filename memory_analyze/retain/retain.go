@@ -0,0 +1,301 @@
+// Package retain 模拟真实服务中"把请求体传给其他函数或保存引用"导致的内存滞留，供 bad_server 的 -retain 使用：
+//
+//   - map：把请求体保存在全局 map 中，从不删除
+//   - queue：交给后台 goroutine 慢慢处理，处理速度跟不上时请求体在队列中堆积
+//   - subslice：只保留前 64 字节的子切片，但子切片引用着整个请求体的底层数组
+//   - ttl：好的实现，只拷贝需要的前 64 字节，并在 TTL 到期后删除
+//
+// fasthttp 在 handler 返回后会复用请求体缓冲区，所以每种实现都先把请求体拷贝到自己分配的内存中。
+// 这份拷贝的分配点就是滞留内存的所有者，在 heap profile 中和 bytebufferpool 的临时分配区分开。
+package retain
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/metrics"
+)
+
+// HeaderSize subslice 和 ttl 模式保留的请求体前缀长度
+const HeaderSize = 64
+
+// 支持的模式
+const (
+	ModeNone     = ""
+	ModeMap      = "map"
+	ModeQueue    = "queue"
+	ModeSubslice = "subslice"
+	ModeTTL      = "ttl"
+)
+
+// Options 配置
+type Options struct {
+	// Mode 滞留方式：map、queue、subslice、ttl，空表示不保留
+	Mode string
+	// TTL ttl 模式下条目的存活时间
+	TTL time.Duration
+	// QueueDelay queue 模式下后台 goroutine 处理每个请求体的耗时
+	QueueDelay time.Duration
+}
+
+// Flags 在 fs 上注册相关的 flag
+func Flags(fs *flag.FlagSet, defaults Options) *Options {
+	opts := defaults
+	if opts.TTL == 0 {
+		opts.TTL = 10 * time.Second
+	}
+	if opts.QueueDelay == 0 {
+		opts.QueueDelay = time.Second
+	}
+	fs.StringVar(&opts.Mode, "retain", opts.Mode, "keep references to request bodies: map (global map, never deleted), queue (slow background worker), subslice (64-byte sub-slice pinning the whole body) or ttl (good: copied 64-byte prefix with TTL eviction)")
+	fs.DurationVar(&opts.TTL, "retain-ttl", opts.TTL, "ttl mode: lifetime of each entry")
+	fs.DurationVar(&opts.QueueDelay, "retain-delay", opts.QueueDelay, "queue mode: time the background worker spends on each body")
+	return &opts
+}
+
+// Stats 滞留内存的统计
+type Stats struct {
+	Mode string `json:"mode"`
+	// Owner 持有内存的数据结构，与 heap profile 中的分配点对应
+	Owner string `json:"owner"`
+	Items int    `json:"items"`
+	// Bytes 被引用而无法回收的字节数（底层数组的容量）
+	Bytes int64 `json:"bytes"`
+	// UsefulBytes 实际用到的字节数（切片长度）
+	UsefulBytes int64 `json:"useful_bytes"`
+	// Evicted ttl 模式下已删除的条目数，queue 模式下已处理完的条目数
+	Evicted int64 `json:"evicted"`
+}
+
+// Store 保存请求体引用的地方
+type Store interface {
+	// Keep 保存一个请求体；body 在调用返回后会被复用，需要时必须拷贝
+	Keep(body []byte)
+	Stats() Stats
+	// Close 停止后台 goroutine
+	Close()
+}
+
+// New 按配置创建 Store，ModeNone 返回 nil
+func (o Options) New() (Store, error) {
+	switch o.Mode {
+	case ModeNone:
+		return nil, nil
+	case ModeMap:
+		return &mapStore{bodies: make(map[uint64][]byte)}, nil
+	case ModeQueue:
+		return newQueueStore(o.QueueDelay), nil
+	case ModeSubslice:
+		return &subsliceStore{}, nil
+	case ModeTTL:
+		if o.TTL <= 0 {
+			return nil, fmt.Errorf("retain ttl must be positive, got %v", o.TTL)
+		}
+		return newTTLStore(o.TTL), nil
+	default:
+		return nil, fmt.Errorf("unknown retain mode %q, expected map, queue, subslice or ttl", o.Mode)
+	}
+}
+
+// Handler 以 JSON 返回 Stats，挂在管理端口上
+func Handler(s Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Stats())
+	})
+}
+
+// Register 在 r 中注册 upload_retained_items、upload_retained_bytes 和 upload_retained_useful_bytes
+func Register(s Store, r *metrics.Registry) {
+	r.NewGaugeFunc("upload_retained_items", "Number of request bodies (or parts of them) still referenced.",
+		func() float64 { return float64(s.Stats().Items) })
+	r.NewGaugeFunc("upload_retained_bytes", "Bytes pinned by retained request body references, including unused parts of shared backing arrays.",
+		func() float64 { return float64(s.Stats().Bytes) })
+	r.NewGaugeFunc("upload_retained_useful_bytes", "Bytes of retained references that are actually used.",
+		func() float64 { return float64(s.Stats().UsefulBytes) })
+}
+
+// mapStore 坏的实现：全局 map，只增不删
+type mapStore struct {
+	mu     sync.Mutex
+	next   uint64
+	bodies map[uint64][]byte
+	bytes  int64
+}
+
+func (s *mapStore) Keep(body []byte) {
+	b := make([]byte, len(body))
+	copy(b, body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	s.bodies[s.next] = b
+	s.bytes += int64(cap(b))
+}
+
+func (s *mapStore) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{Mode: ModeMap, Owner: "retain.(*mapStore).bodies", Items: len(s.bodies), Bytes: s.bytes, UsefulBytes: s.bytes}
+}
+
+func (s *mapStore) Close() {}
+
+// queueStore 坏的实现：请求体交给后台 goroutine 处理，到达速度超过处理速度时在队列中堆积
+type queueStore struct {
+	ch    chan []byte
+	delay time.Duration
+	done  chan struct{}
+	once  sync.Once
+
+	items     atomic.Int64
+	bytes     atomic.Int64
+	processed atomic.Int64
+}
+
+func newQueueStore(delay time.Duration) *queueStore {
+	s := &queueStore{ch: make(chan []byte, 1<<16), delay: delay, done: make(chan struct{})}
+	go s.worker()
+	return s
+}
+
+func (s *queueStore) Keep(body []byte) {
+	b := make([]byte, len(body))
+	copy(b, body)
+	s.items.Add(1)
+	s.bytes.Add(int64(cap(b)))
+	select {
+	case s.ch <- b:
+	case <-s.done:
+	}
+}
+
+// worker 模拟一个很慢的下游处理（例如审计日志、异步转存）
+func (s *queueStore) worker() {
+	for {
+		select {
+		case b := <-s.ch:
+			select {
+			case <-time.After(s.delay):
+			case <-s.done:
+				return
+			}
+			s.items.Add(-1)
+			s.bytes.Add(-int64(cap(b)))
+			s.processed.Add(1)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *queueStore) Stats() Stats {
+	n := s.bytes.Load()
+	return Stats{Mode: ModeQueue, Owner: "retain.(*queueStore).ch", Items: int(s.items.Load()), Bytes: n, UsefulBytes: n, Evicted: s.processed.Load()}
+}
+
+func (s *queueStore) Close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// subsliceStore 坏的实现：只需要前 64 字节，却保留了整个请求体拷贝的子切片
+type subsliceStore struct {
+	mu      sync.Mutex
+	headers [][]byte
+	bytes   int64
+	useful  int64
+}
+
+func (s *subsliceStore) Keep(body []byte) {
+	msg := make([]byte, len(body))
+	copy(msg, body)
+	// header 与 msg 共用底层数组，只要 header 还被引用，整个 msg 都不能回收
+	header := msg[:min(HeaderSize, len(msg))]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.headers = append(s.headers, header)
+	s.bytes += int64(cap(header))
+	s.useful += int64(len(header))
+}
+
+func (s *subsliceStore) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{Mode: ModeSubslice, Owner: "retain.(*subsliceStore).headers", Items: len(s.headers), Bytes: s.bytes, UsefulBytes: s.useful}
+}
+
+func (s *subsliceStore) Close() {}
+
+// ttlStore 好的实现：只拷贝需要的前 64 字节，条目在 TTL 到期后由后台 goroutine 删除
+type ttlStore struct {
+	ttl  time.Duration
+	done chan struct{}
+	once sync.Once
+
+	mu      sync.Mutex
+	next    uint64
+	entries map[uint64]ttlEntry
+	bytes   int64
+	evicted int64
+}
+
+type ttlEntry struct {
+	header  []byte
+	expires time.Time
+}
+
+func newTTLStore(ttl time.Duration) *ttlStore {
+	s := &ttlStore{ttl: ttl, done: make(chan struct{}), entries: make(map[uint64]ttlEntry)}
+	go s.janitor()
+	return s
+}
+
+func (s *ttlStore) Keep(body []byte) {
+	header := make([]byte, min(HeaderSize, len(body)))
+	copy(header, body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	s.entries[s.next] = ttlEntry{header: header, expires: time.Now().Add(s.ttl)}
+	s.bytes += int64(cap(header))
+}
+
+func (s *ttlStore) janitor() {
+	ticker := time.NewTicker(max(s.ttl/2, 100*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.evict(now)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *ttlStore) evict(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, id)
+			s.bytes -= int64(cap(e.header))
+			s.evicted++
+		}
+	}
+}
+
+func (s *ttlStore) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{Mode: ModeTTL, Owner: "retain.(*ttlStore).entries", Items: len(s.entries), Bytes: s.bytes, UsefulBytes: s.bytes, Evicted: s.evicted}
+}
+
+func (s *ttlStore) Close() {
+	s.once.Do(func() { close(s.done) })
+}
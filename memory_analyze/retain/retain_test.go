@@ -0,0 +1,126 @@
+package retain
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newStore(t *testing.T, o Options) Store {
+	t.Helper()
+	s, err := o.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestNew(t *testing.T) {
+	if s, err := (Options{}).New(); s != nil || err != nil {
+		t.Errorf("ModeNone: New = %v, %v; want nil, nil", s, err)
+	}
+	for _, o := range []Options{{Mode: "lru"}, {Mode: ModeTTL}} {
+		if _, err := o.New(); err == nil {
+			t.Errorf("New(%+v) should fail", o)
+		}
+	}
+}
+
+// Keep 必须拷贝请求体：调用方随后会复用 body
+func TestMapStoreCopiesBody(t *testing.T) {
+	s := newStore(t, Options{Mode: ModeMap}).(*mapStore)
+	body := []byte("hello world")
+	s.Keep(body)
+	s.Keep(make([]byte, 1000))
+	copy(body, "XXXXX")
+
+	if got := s.bodies[1]; !bytes.Equal(got, []byte("hello world")) {
+		t.Errorf("stored body = %q, should not change when the caller reuses its buffer", got)
+	}
+	st := s.Stats()
+	if st.Items != 2 || st.Bytes != 1011 || st.UsefulBytes != 1011 {
+		t.Errorf("stats = %+v, want 2 items, 1011 bytes", st)
+	}
+}
+
+// subslice 只用到前 HeaderSize 字节，却固定住整个请求体
+func TestSubslicePinsWholeBody(t *testing.T) {
+	s := newStore(t, Options{Mode: ModeSubslice})
+	s.Keep(make([]byte, 1<<20))
+	s.Keep([]byte("short"))
+
+	st := s.Stats()
+	if st.Items != 2 {
+		t.Errorf("items = %d, want 2", st.Items)
+	}
+	if want := int64(1<<20 + 5); st.Bytes != want {
+		t.Errorf("pinned bytes = %d, want %d", st.Bytes, want)
+	}
+	if want := int64(HeaderSize + 5); st.UsefulBytes != want {
+		t.Errorf("useful bytes = %d, want %d", st.UsefulBytes, want)
+	}
+}
+
+func TestTTLStoreEvict(t *testing.T) {
+	s := newTTLStore(time.Minute)
+	defer s.Close()
+	s.Keep(make([]byte, 1<<20))
+	s.Keep([]byte("short"))
+
+	// ttl 模式只拷贝前 HeaderSize 字节
+	st := s.Stats()
+	if st.Items != 2 || st.Bytes != HeaderSize+5 || st.UsefulBytes != st.Bytes {
+		t.Fatalf("stats = %+v, want 2 items, %d bytes", st, HeaderSize+5)
+	}
+
+	now := time.Now()
+	s.evict(now)
+	if st := s.Stats(); st.Items != 2 || st.Evicted != 0 {
+		t.Errorf("entries evicted before the TTL: %+v", st)
+	}
+
+	// 第三个条目晚一些过期
+	s.Keep([]byte("late"))
+	s.mu.Lock()
+	s.entries[s.next] = ttlEntry{header: s.entries[s.next].header, expires: now.Add(2 * time.Minute)}
+	s.mu.Unlock()
+
+	s.evict(now.Add(time.Minute + time.Second))
+	if st := s.Stats(); st.Items != 1 || st.Bytes != 4 || st.Evicted != 2 {
+		t.Errorf("after TTL: %+v, want 1 item, 4 bytes, 2 evicted", st)
+	}
+	s.evict(now.Add(3 * time.Minute))
+	if st := s.Stats(); st.Items != 0 || st.Bytes != 0 || st.Evicted != 3 {
+		t.Errorf("after all expired: %+v, want empty, 3 evicted", st)
+	}
+}
+
+func TestQueueStoreProcesses(t *testing.T) {
+	s := newStore(t, Options{Mode: ModeQueue, QueueDelay: time.Millisecond})
+	for i := 0; i < 3; i++ {
+		s.Keep(make([]byte, 100))
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Stats().Evicted != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("worker did not drain the queue: %+v", s.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if st := s.Stats(); st.Items != 0 || st.Bytes != 0 {
+		t.Errorf("after processing: %+v, want empty", st)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	s := newStore(t, Options{Mode: ModeSubslice})
+	s.Keep(make([]byte, 128))
+	rec := httptest.NewRecorder()
+	Handler(s).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/retain", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `"bytes":128`) || !strings.Contains(body, `"useful_bytes":64`) {
+		t.Errorf("handler output = %s", body)
+	}
+}
@@ -0,0 +1,99 @@
+package sink
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"time"
+)
+
+// forwardSink 通过 io.Pipe 把请求体边读边转发给下游，不在本地缓存
+type forwardSink struct {
+	url    string
+	client *http.Client
+}
+
+func newForwardSink(url string, timeout time.Duration) *forwardSink {
+	return &forwardSink{
+		url: url,
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				MaxIdleConnsPerHost: 64,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+	}
+}
+
+func (s *forwardSink) Name() string { return KindForward }
+
+func (s *forwardSink) Open(ctx context.Context, contentLength int64) (Upload, error) {
+	pr, pw := io.Pipe()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, pr)
+	if err != nil {
+		return nil, fmt.Errorf("create forward request: %w", err)
+	}
+	// 大小已知时透传 Content-Length，否则以 chunked 转发
+	req.ContentLength = contentLength
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	u := &forwardUpload{url: s.url, pw: pw, h: sha256.New(), done: make(chan error, 1)}
+	go func() {
+		resp, err := s.client.Do(req)
+		if err != nil {
+			// 让还在 Write 的一方尽快失败
+			pr.CloseWithError(err)
+			u.done <- err
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		if resp.StatusCode/100 != 2 {
+			err = fmt.Errorf("downstream %s returned %d: %s", s.url, resp.StatusCode, body)
+		}
+		u.done <- err
+	}()
+	return u, nil
+}
+
+type forwardUpload struct {
+	url      string
+	pw       *io.PipeWriter
+	h        hash.Hash
+	n        int64
+	done     chan error
+	finished bool
+}
+
+func (u *forwardUpload) Write(p []byte) (int, error) {
+	n, err := u.pw.Write(p)
+	u.h.Write(p[:n])
+	u.n += int64(n)
+	return n, err
+}
+
+func (u *forwardUpload) Commit() (Result, error) {
+	res := Result{Bytes: u.n, SHA256: hex.EncodeToString(u.h.Sum(nil)), Location: u.url}
+	u.pw.Close()
+	u.finished = true
+	if err := <-u.done; err != nil {
+		return res, fmt.Errorf("forward: %w", err)
+	}
+	return res, nil
+}
+
+func (u *forwardUpload) Abort() {
+	if u.finished {
+		return
+	}
+	u.finished = true
+	u.pw.CloseWithError(errors.New("upload aborted"))
+	<-u.done
+}
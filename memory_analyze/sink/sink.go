@@ -0,0 +1,196 @@
+// Package sink 是上传请求体的去向：只计算 sha256、写入临时文件（spool）并 fsync，
+// 或者转发给下游 HTTP 服务。good server 以固定大小的缓冲区流式写入，
+// bad server 先把整个请求体读进内存再一次性写入，两者使用同一组 sink。
+package sink
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gangcheng1030/ai_production_troubleshooting/diagnostics/units"
+)
+
+// Sink 上传内容的去向
+type Sink interface {
+	// Name sink 类型，写入响应中
+	Name() string
+	// Open 开始一次上传；contentLength 为 -1 表示大小未知（chunked）
+	Open(ctx context.Context, contentLength int64) (Upload, error)
+}
+
+// Upload 一次进行中的上传
+type Upload interface {
+	io.Writer
+	// Commit 完成上传，返回写入的字节数和校验和
+	Commit() (Result, error)
+	// Abort 放弃上传并清理已写入的内容，可以在 Commit 失败后调用
+	Abort()
+}
+
+// Result 一次上传的结果
+type Result struct {
+	Bytes  int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// Location spool 文件路径或者下游地址，hash sink 为空
+	Location string `json:"location,omitempty"`
+}
+
+// 支持的 sink 类型
+const (
+	KindHash    = "hash"
+	KindSpool   = "spool"
+	KindForward = "forward"
+)
+
+// Options sink 配置
+type Options struct {
+	// Kind sink 类型：hash、spool、forward
+	Kind string
+	// SpoolDir spool 临时文件目录
+	SpoolDir string
+	// SpoolKeep 完成后保留 spool 文件（以 sha256 命名），否则 fsync 之后删除
+	SpoolKeep bool
+	// ForwardURL forward sink 的下游地址
+	ForwardURL string
+	// ForwardTimeout 转发单个请求的超时时间
+	ForwardTimeout time.Duration
+	// Budget 每个请求用于拷贝的缓冲区大小，例如 64KiB；只对流式写入生效
+	Budget string
+}
+
+// Flags 在 fs 上注册 sink 相关的 flag
+func Flags(fs *flag.FlagSet, defaults Options) *Options {
+	opts := defaults
+	if opts.Kind == "" {
+		opts.Kind = KindHash
+	}
+	if opts.SpoolDir == "" {
+		opts.SpoolDir = filepath.Join(os.TempDir(), "upload-spool")
+	}
+	if opts.ForwardTimeout == 0 {
+		opts.ForwardTimeout = 30 * time.Second
+	}
+	if opts.Budget == "" {
+		opts.Budget = "64KiB"
+	}
+	fs.StringVar(&opts.Kind, "sink", opts.Kind, "upload sink: hash (sha256 only), spool (temp file + fsync) or forward (stream to -forward-url)")
+	fs.StringVar(&opts.SpoolDir, "spool-dir", opts.SpoolDir, "spool sink: directory for temp files")
+	fs.BoolVar(&opts.SpoolKeep, "spool-keep", opts.SpoolKeep, "spool sink: keep files (named by sha256) instead of deleting them after fsync")
+	fs.StringVar(&opts.ForwardURL, "forward-url", opts.ForwardURL, "forward sink: downstream upload URL, e.g. another good_server's http://localhost:8081/upload")
+	fs.DurationVar(&opts.ForwardTimeout, "forward-timeout", opts.ForwardTimeout, "forward sink: timeout for each downstream request")
+	fs.StringVar(&opts.Budget, "budget", opts.Budget, "per-request copy buffer size for streaming uploads")
+	return &opts
+}
+
+// New 按配置创建 sink
+func (o Options) New() (Sink, error) {
+	switch o.Kind {
+	case KindHash, "":
+		return hashSink{}, nil
+	case KindSpool:
+		if err := os.MkdirAll(o.SpoolDir, 0o755); err != nil {
+			return nil, fmt.Errorf("create spool dir: %w", err)
+		}
+		return &spoolSink{dir: o.SpoolDir, keep: o.SpoolKeep}, nil
+	case KindForward:
+		if o.ForwardURL == "" {
+			return nil, fmt.Errorf("forward sink requires -forward-url")
+		}
+		return newForwardSink(o.ForwardURL, o.ForwardTimeout), nil
+	default:
+		return nil, fmt.Errorf("unknown sink %q, expected hash, spool or forward", o.Kind)
+	}
+}
+
+// BudgetBytes 解析 Budget
+func (o Options) BudgetBytes() (int, error) {
+	n, err := units.ParseSize(o.Budget)
+	if err != nil {
+		return 0, fmt.Errorf("invalid budget: %w", err)
+	}
+	if n < 512 || n > 64<<20 {
+		return 0, fmt.Errorf("budget %s out of range [512B, 64MiB]", o.Budget)
+	}
+	return int(n), nil
+}
+
+// Copier 以固定大小的缓冲区把请求体流式写入 Upload，每个请求最多占用一块缓冲区
+type Copier struct {
+	pool sync.Pool
+}
+
+// NewCopier 创建缓冲区大小为 budget 字节的 Copier
+func NewCopier(budget int) *Copier {
+	return &Copier{pool: sync.Pool{New: func() any {
+		buf := make([]byte, budget)
+		return &buf
+	}}}
+}
+
+// WriteError Copy 写入 Upload 失败，即 sink 出错；其他错误来自读取请求体
+type WriteError struct {
+	Err error
+}
+
+func (e *WriteError) Error() string { return "write to sink: " + e.Err.Error() }
+
+func (e *WriteError) Unwrap() error { return e.Err }
+
+// Copy 把 r 写入 u，返回读取的字节数；写入失败时返回 *WriteError，
+// 调用方据此区分客户端的问题（请求体不完整）和 sink 的问题
+func (c *Copier) Copy(u Upload, r io.Reader) (int64, error) {
+	buf := c.pool.Get().(*[]byte)
+	defer c.pool.Put(buf)
+	// 只暴露 Write，防止 io.CopyBuffer 走 ReaderFrom/WriterTo 绕过缓冲区上限
+	return io.CopyBuffer(uploadWriter{u}, struct{ io.Reader }{r}, *buf)
+}
+
+// uploadWriter 把 Upload 的写入错误包装成 *WriteError
+type uploadWriter struct {
+	u Upload
+}
+
+func (w uploadWriter) Write(p []byte) (int, error) {
+	n, err := w.u.Write(p)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		return n, &WriteError{Err: err}
+	}
+	return n, nil
+}
+
+// hashSink 只计算 sha256
+type hashSink struct{}
+
+func (hashSink) Name() string { return KindHash }
+
+func (hashSink) Open(context.Context, int64) (Upload, error) {
+	return &hashUpload{h: sha256.New()}, nil
+}
+
+type hashUpload struct {
+	h hash.Hash
+	n int64
+}
+
+func (u *hashUpload) Write(p []byte) (int, error) {
+	u.n += int64(len(p))
+	return u.h.Write(p)
+}
+
+func (u *hashUpload) Commit() (Result, error) {
+	return Result{Bytes: u.n, SHA256: hex.EncodeToString(u.h.Sum(nil))}, nil
+}
+
+func (u *hashUpload) Abort() {}
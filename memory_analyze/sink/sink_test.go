@@ -0,0 +1,276 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const payload = "hello upload sink"
+
+func sum(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+// fakeUpload 记录每次写入的长度；short 为 true 时少写一个字节，err 非空时写入失败
+type fakeUpload struct {
+	writes []int
+	short  bool
+	err    error
+}
+
+func (u *fakeUpload) Write(p []byte) (int, error) {
+	u.writes = append(u.writes, len(p))
+	switch {
+	case u.err != nil:
+		return 0, u.err
+	case u.short && len(p) > 0:
+		return len(p) - 1, nil
+	}
+	return len(p), nil
+}
+
+func (u *fakeUpload) Commit() (Result, error) { return Result{}, nil }
+
+func (u *fakeUpload) Abort() {}
+
+// failingReader 读出 data 后返回 err
+type failingReader struct {
+	data io.Reader
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if err == io.EOF {
+		return n, r.err
+	}
+	return n, err
+}
+
+// bytes.Reader 实现了 WriterTo，Copy 仍然只能按缓冲区大小写入
+func TestCopyUsesBudget(t *testing.T) {
+	u := &fakeUpload{}
+	n, err := NewCopier(512).Copy(u, bytes.NewReader(make([]byte, 2000)))
+	if err != nil || n != 2000 {
+		t.Fatalf("Copy = %d, %v; want 2000, nil", n, err)
+	}
+	for _, w := range u.writes {
+		if w > 512 {
+			t.Errorf("write of %d bytes exceeds the 512 byte budget", w)
+		}
+	}
+}
+
+func TestCopyErrors(t *testing.T) {
+	errRead := errors.New("client went away")
+	errDisk := errors.New("disk full")
+	tests := []struct {
+		name      string
+		u         *fakeUpload
+		r         io.Reader
+		writeErr  error
+		readErr   error
+		wantBytes int64
+	}{
+		{"read error", &fakeUpload{}, &failingReader{strings.NewReader(payload), errRead}, nil, errRead, int64(len(payload))},
+		{"write error", &fakeUpload{err: errDisk}, strings.NewReader(payload), errDisk, nil, 0},
+		{"short write", &fakeUpload{short: true}, strings.NewReader(payload), io.ErrShortWrite, nil, int64(len(payload) - 1)},
+	}
+	for _, tt := range tests {
+		n, err := NewCopier(4096).Copy(tt.u, tt.r)
+		if n != tt.wantBytes {
+			t.Errorf("%s: copied %d bytes, want %d", tt.name, n, tt.wantBytes)
+		}
+		var we *WriteError
+		if tt.writeErr != nil {
+			if !errors.As(err, &we) || !errors.Is(err, tt.writeErr) {
+				t.Errorf("%s: err = %v, want *WriteError wrapping %v", tt.name, err, tt.writeErr)
+			}
+			continue
+		}
+		if errors.As(err, &we) || !errors.Is(err, tt.readErr) {
+			t.Errorf("%s: err = %v, want the read error %v", tt.name, err, tt.readErr)
+		}
+	}
+}
+
+func TestHashSink(t *testing.T) {
+	s, err := (Options{}).New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := upload(t, s, payload)
+	if res.Bytes != int64(len(payload)) || res.SHA256 != sum(payload) || res.Location != "" {
+		t.Errorf("hash result = %+v", res)
+	}
+}
+
+// upload 通过 Copier 把 body 写入 s 并提交
+func upload(t *testing.T, s Sink, body string) Result {
+	t.Helper()
+	u, err := s.Open(context.Background(), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCopier(4096).Copy(u, strings.NewReader(body)); err != nil {
+		u.Abort()
+		t.Fatal(err)
+	}
+	res, err := u.Commit()
+	if err != nil {
+		u.Abort()
+		t.Fatalf("Commit: %v", err)
+	}
+	return res
+}
+
+func spoolFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestSpool(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		dir := t.TempDir()
+		s, err := Options{Kind: KindSpool, SpoolDir: dir, SpoolKeep: keep}.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := upload(t, s, payload)
+		if res.Bytes != int64(len(payload)) || res.SHA256 != sum(payload) {
+			t.Errorf("keep=%v: result = %+v", keep, res)
+		}
+		files := spoolFiles(t, dir)
+		if !keep {
+			if len(files) != 0 || res.Location != "" {
+				t.Errorf("keep=false: files %v, location %q; want the spool file removed", files, res.Location)
+			}
+		} else {
+			want := res.SHA256 + ".bin"
+			if len(files) != 1 || files[0] != want || res.Location != filepath.Join(dir, want) {
+				t.Fatalf("keep=true: files %v, location %q; want %s", files, res.Location, want)
+			}
+			if data, _ := os.ReadFile(res.Location); string(data) != payload {
+				t.Errorf("kept file = %q, want %q", data, payload)
+			}
+		}
+
+		// Abort 删除写了一半的文件；Commit 之后再 Abort 不影响保留的文件
+		u, err := s.Open(context.Background(), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u.Write([]byte("partial"))
+		u.Abort()
+		u.Abort()
+		if got := spoolFiles(t, dir); len(got) != len(files) {
+			t.Errorf("keep=%v: after Abort files = %v, want %v", keep, got, files)
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	for _, o := range []Options{{Kind: KindForward}, {Kind: "s3"}} {
+		if _, err := o.New(); err == nil {
+			t.Errorf("New(%+v) should fail", o)
+		}
+	}
+}
+
+// downstream 返回 status，并把收到的请求体发到返回的 channel
+func downstream(t *testing.T, status int) (*httptest.Server, <-chan string) {
+	t.Helper()
+	bodies := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			body = []byte("read error: " + err.Error())
+		}
+		bodies <- string(body)
+		w.WriteHeader(status)
+		io.WriteString(w, "downstream says no")
+	}))
+	t.Cleanup(ts.Close)
+	return ts, bodies
+}
+
+func TestForward(t *testing.T) {
+	ts, bodies := downstream(t, http.StatusOK)
+	s, err := Options{Kind: KindForward, ForwardURL: ts.URL, ForwardTimeout: 5 * time.Second}.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := upload(t, s, payload)
+	if res.SHA256 != sum(payload) || res.Location != ts.URL {
+		t.Errorf("forward result = %+v", res)
+	}
+	if got := <-bodies; got != payload {
+		t.Errorf("downstream received %q, want %q", got, payload)
+	}
+}
+
+// 下游返回非 2xx 时 Commit 失败，错误中带上状态码和响应体
+func TestForwardDownstreamError(t *testing.T) {
+	ts, bodies := downstream(t, http.StatusBadGateway)
+	s, err := Options{Kind: KindForward, ForwardURL: ts.URL, ForwardTimeout: 5 * time.Second}.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := s.Open(context.Background(), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCopier(4096).Copy(u, strings.NewReader(payload)); err != nil {
+		t.Fatal(err)
+	}
+	_, err = u.Commit()
+	if err == nil || !strings.Contains(err.Error(), "returned 502") || !strings.Contains(err.Error(), "downstream says no") {
+		t.Errorf("Commit err = %v, want the downstream 502", err)
+	}
+	u.Abort() // Commit 之后 Abort 不再阻塞
+	<-bodies
+}
+
+// Abort 中断转发，下游读到的请求体不完整
+func TestForwardAbort(t *testing.T) {
+	ts, bodies := downstream(t, http.StatusOK)
+	s, err := Options{Kind: KindForward, ForwardURL: ts.URL, ForwardTimeout: 5 * time.Second}.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := s.Open(context.Background(), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Write([]byte("partial"))
+	u.Abort()
+	select {
+	case got := <-bodies:
+		if got == "partial" {
+			t.Errorf("downstream received a complete body %q after Abort", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("downstream request still open after Abort")
+	}
+}
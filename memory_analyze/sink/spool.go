@@ -0,0 +1,74 @@
+package sink
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// spoolSink 把请求体写入临时文件，完成时 fsync，模拟先落盘再处理的上传服务
+type spoolSink struct {
+	dir  string
+	keep bool
+}
+
+func (s *spoolSink) Name() string { return KindSpool }
+
+func (s *spoolSink) Open(context.Context, int64) (Upload, error) {
+	f, err := os.CreateTemp(s.dir, "upload-*.part")
+	if err != nil {
+		return nil, fmt.Errorf("create spool file: %w", err)
+	}
+	u := &spoolUpload{sink: s, f: f, h: sha256.New()}
+	u.w = io.MultiWriter(f, u.h)
+	return u, nil
+}
+
+type spoolUpload struct {
+	sink *spoolSink
+	f    *os.File
+	h    hash.Hash
+	w    io.Writer
+	n    int64
+	done bool
+}
+
+func (u *spoolUpload) Write(p []byte) (int, error) {
+	n, err := u.w.Write(p)
+	u.n += int64(n)
+	return n, err
+}
+
+func (u *spoolUpload) Commit() (Result, error) {
+	res := Result{Bytes: u.n, SHA256: hex.EncodeToString(u.h.Sum(nil))}
+	if err := u.f.Sync(); err != nil {
+		return res, fmt.Errorf("fsync spool file: %w", err)
+	}
+	if err := u.f.Close(); err != nil {
+		return res, fmt.Errorf("close spool file: %w", err)
+	}
+	u.done = true
+	if !u.sink.keep {
+		return res, os.Remove(u.f.Name())
+	}
+	res.Location = filepath.Join(u.sink.dir, res.SHA256+".bin")
+	if err := os.Rename(u.f.Name(), res.Location); err != nil {
+		os.Remove(u.f.Name())
+		return res, fmt.Errorf("rename spool file: %w", err)
+	}
+	return res, nil
+}
+
+func (u *spoolUpload) Abort() {
+	if u.done {
+		return
+	}
+	u.done = true
+	u.f.Close()
+	os.Remove(u.f.Name())
+}